@@ -46,8 +46,21 @@ func main() {
 	// Set up the application with the database connection
 	s := app.Setup(dbPool, version, environment)
 
-	fmt.Printf("Listening to http://localhost%s (version: %s, env: %s)\n", s.Addr, version, environment)
-	err := http.ListenAndServe(s.Addr, s.Router)
+	srv := &http.Server{
+		Addr:      s.Addr,
+		Handler:   s.Router,
+		TLSConfig: s.TLSConfig,
+	}
+
+	var err error
+	if s.TLSConfig != nil {
+		// Certificates are already loaded into TLSConfig
+		fmt.Printf("Listening to https://localhost%s (version: %s, env: %s)\n", s.Addr, version, environment)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		fmt.Printf("Listening to http://localhost%s (version: %s, env: %s)\n", s.Addr, version, environment)
+		err = srv.ListenAndServe()
+	}
 	if err != nil && err != http.ErrServerClosed {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 		os.Exit(1)
@@ -1,41 +1,132 @@
 package app
 
 import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/subrat-dwi/shubserver/internal/attachments"
 	"github.com/subrat-dwi/shubserver/internal/auth"
+	"github.com/subrat-dwi/shubserver/internal/batch"
+	"github.com/subrat-dwi/shubserver/internal/blobstore"
+	"github.com/subrat-dwi/shubserver/internal/clientcerts"
+	"github.com/subrat-dwi/shubserver/internal/config"
 	"github.com/subrat-dwi/shubserver/internal/health"
+	"github.com/subrat-dwi/shubserver/internal/mailer"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+	"github.com/subrat-dwi/shubserver/internal/notebooks"
 	"github.com/subrat-dwi/shubserver/internal/notes"
+	"github.com/subrat-dwi/shubserver/internal/notifications"
 	passwordmanager "github.com/subrat-dwi/shubserver/internal/password-manager"
+	"github.com/subrat-dwi/shubserver/internal/reminders"
+	"github.com/subrat-dwi/shubserver/internal/sharelinks"
+	"github.com/subrat-dwi/shubserver/internal/tags"
+	"github.com/subrat-dwi/shubserver/internal/trash"
 
 	"github.com/subrat-dwi/shubserver/internal/users"
 )
 
-func Routes(db *pgxpool.Pool, version, env string) chi.Router {
+func Routes(db *pgxpool.Pool, cfg *config.Config, version, env string) chi.Router {
 
 	// Initialize repositories and services
 	userRepo := users.NewUsersPostgresRepository(db)
-	notesRepo := notes.NewNotesPostgresRepository(db)
+	notesRepo := notes.NewNotesPostgresRepository(db, notes.RevisionRetention{
+		MaxCount: cfg.NoteRevisionsMaxCount,
+		MaxAge:   cfg.NoteRevisionsMaxAge,
+	})
 	passwordRepo := passwordmanager.NewPasswordsPostgresRepository(db)
+	notificationsRepo := notifications.NewNotificationsPostgresRepository(db)
+	clientIdentitiesRepo := clientcerts.NewClientIdentitiesPostgresRepository(db)
+	tagsRepo := tags.NewTagsPostgresRepository(db)
+	notebooksRepo := notebooks.NewNotebooksPostgresRepository(db)
+	trashRepo := trash.NewTrashPostgresRepository(db)
+	attachmentsRepo := attachments.NewAttachmentsPostgresRepository(db)
+	shareLinksRepo := sharelinks.NewShareLinksPostgresRepository(db)
+	importJobsRepo := notes.NewImportJobsPostgresRepository(db)
+	remindersRepo := reminders.NewRemindersPostgresRepository(db)
 	// notesRepo := notes.NewMemoryRepository() // Use in-memory repository for testing
 
 	// Initialize services and handlers
-	authService := auth.NewAuthService(userRepo)
+	mail := mailer.New(cfg)
+	notificationService := notifications.NewNotificationService(notificationsRepo, mail)
+	authService := auth.NewAuthService(userRepo, notificationService, mail, cfg.PublicURL)
 	passwordService := passwordmanager.NewPasswordService(passwordRepo)
 
+	// Attachment files live in the configured blob store
+	blobStore, err := blobstore.New(cfg)
+	if err != nil {
+		log.Fatalf("can't open blob store: %v", err)
+	}
+	blobCollector := attachments.NewCollector(attachmentsRepo, blobStore)
+	attachmentService := attachments.NewAttachmentService(attachmentsRepo, blobStore, blobCollector,
+		cfg.AttachmentMaxBytes, cfg.AttachmentAllowedTypes, cfg.StorageQuotaBytes)
+
+	// Let the auth middleware reject revoked sessions and accept mapped client certificates
+	middleware.SetSessionChecker(authService)
+	middleware.SetCertificateResolver(clientcerts.NewResolver(clientIdentitiesRepo))
+
+	// Background jobs run for the lifetime of the process
+	go trash.NewPurger(trashRepo, cfg.TrashRetention).Run(context.Background())
+	go blobCollector.Run(context.Background())
+	go notes.NewLinkBackfill(notesRepo).Run(context.Background())
+
+	// Reminders are delivered by email, in-app notification or webhook
+	go reminders.NewScheduler(remindersRepo, map[string]reminders.Deliverer{
+		reminders.ChannelEmail:   reminders.NewEmailDeliverer(mail),
+		reminders.ChannelInApp:   reminders.NewInAppDeliverer(notificationService),
+		reminders.ChannelWebhook: reminders.NewWebhookDeliverer(),
+	}).Run(context.Background())
+
 	// Initialize handlers
 	authHandler := auth.NewAuthHandler(authService)
-	notesHandler := notes.NewNotesHandler(notesRepo)
+	notesHandler := notes.NewNotesHandler(notesRepo, notebooksRepo, importJobsRepo, cfg.SearchLanguage, cfg.NoteMaxContentBytes)
 	passwordHandler := passwordmanager.NewPasswordHandler(passwordService)
+	notificationsHandler := notifications.NewNotificationsHandler(notificationService)
+	tagsHandler := tags.NewTagsHandler(tagsRepo)
+	notebooksHandler := notebooks.NewNotebooksHandler(notebooksRepo)
+	trashHandler := trash.NewTrashHandler(trashRepo, cfg.TrashRetention)
+	attachmentsHandler := attachments.NewAttachmentsHandler(attachmentService)
+	shareLinksHandler := sharelinks.NewShareLinksHandler(shareLinksRepo, cfg.PublicURL)
+	remindersHandler := reminders.NewRemindersHandler(remindersRepo)
+	batchHandler := batch.NewBatchHandler(db, notesRepo, passwordRepo, cfg.SearchLanguage, cfg.NoteMaxContentBytes, cfg.BatchMaxOperations)
+
+	// Imports from other note apps run in the background too
+	go notesHandler.RunImports(context.Background())
 
 	// Set up the router
 	r := chi.NewRouter()
 
+	// Route groups listed in MTLS_ROUTES or MTLS_ONLY_ROUTES need a client certificate
+	if len(cfg.MTLSRoutes)+len(cfg.MTLSOnlyRoutes) > 0 && cfg.TLSClientCAFile == "" {
+		log.Fatal("MTLS_ROUTES and MTLS_ONLY_ROUTES need TLS_CLIENT_CA_FILE")
+	}
+	mount := func(pattern string, h http.Handler) {
+		switch {
+		case slices.Contains(cfg.MTLSOnlyRoutes, pattern):
+			h = middleware.ClientCertAuth(h)
+		case slices.Contains(cfg.MTLSRoutes, pattern):
+			h = middleware.RequireClientCert(h)
+		}
+		r.Mount(pattern, h)
+	}
+
 	// Mount routes
-	r.Mount("/health", health.Routes(db, version, env))
-	r.Mount("/users", auth.Routes(authHandler))
-	r.Mount("/notes", notes.Routes(notesHandler))
-	r.Mount("/passwords", passwordmanager.Routes(passwordHandler))
+	mount("/health", health.Routes(db, version, env))
+	mount("/users", auth.Routes(authHandler, middleware.AuthMiddleware))
+	mount("/notes", notes.Routes(notesHandler))
+	mount("/notes/{noteID}/attachments", attachments.Routes(attachmentsHandler))
+	mount("/notes/{noteID}/links", sharelinks.Routes(shareLinksHandler))
+	mount("/passwords", passwordmanager.Routes(passwordHandler))
+	mount("/notifications", notifications.Routes(notificationsHandler))
+	mount("/tags", tags.Routes(tagsHandler))
+	mount("/notebooks", notebooks.Routes(notebooksHandler))
+	mount("/trash", trash.Routes(trashHandler))
+	mount("/storage", attachments.StorageRoutes(attachmentsHandler))
+	mount("/batch", batch.Routes(batchHandler))
+	mount("/reminders", reminders.Routes(remindersHandler))
 
 	return r
 }
@@ -1,23 +1,39 @@
 package app
 
 import (
+	"crypto/tls"
+	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/subrat-dwi/shubserver/internal/config"
+	"github.com/subrat-dwi/shubserver/internal/sharelinks"
 )
 
 // Server struct to hold the router and address
 type Server struct {
 	Router chi.Router
 	Addr   string
+	// TLSConfig is nil when the server should listen on plain HTTP
+	TLSConfig *tls.Config
 }
 
 func Setup(db *pgxpool.Pool, version, env string) *Server {
+	cfg := config.Load()
+
+	tlsConfig, err := loadTLSConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Set up the router with middleware
 	r := chi.NewRouter()
+	if cfg.TrustProxy {
+		// Behind a reverse proxy, take the client IP from X-Forwarded-For / X-Real-IP
+		r.Use(middleware.RealIP)
+	}
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
@@ -30,12 +46,17 @@ func Setup(db *pgxpool.Pool, version, env string) *Server {
 	fs := http.FileServer(http.Dir("./web/static"))
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
 
+	// Public note links work without an account, outside of /api
+	shareLinks := sharelinks.NewShareLinksHandler(sharelinks.NewShareLinksPostgresRepository(db), cfg.PublicURL)
+	r.Mount("/s", sharelinks.PublicRoutes(shareLinks))
+
 	// Mount API routes
-	r.Mount("/api", Routes(db, version, env))
+	r.Mount("/api", Routes(db, cfg, version, env))
 
 	// Return the server instance
 	return &Server{
-		Router: r,
-		Addr:   config.Load().Port,
+		Router:    r,
+		Addr:      cfg.Port,
+		TLSConfig: tlsConfig,
 	}
 }
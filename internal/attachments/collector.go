@@ -0,0 +1,76 @@
+package attachments
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/subrat-dwi/shubserver/internal/blobstore"
+)
+
+// CollectInterval is how often the collector looks for blobs to delete when not woken up
+const CollectInterval = 10 * time.Minute
+
+// Collector deletes the blobs queued in blob_deletions, whether their attachment was
+// deleted directly or removed by a cascade (trash purge, user deletion)
+type Collector struct {
+	repo  AttachmentsRepository
+	store blobstore.BlobStore
+	wake  chan struct{}
+}
+
+// NewCollector creates the background blob collector
+func NewCollector(repo AttachmentsRepository, store blobstore.BlobStore) *Collector {
+	return &Collector{repo: repo, store: store, wake: make(chan struct{}, 1)}
+}
+
+// Wake asks the collector to run soon, without waiting for the next interval
+func (c *Collector) Wake() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run collects right away and then on every wake up or CollectInterval until ctx is done
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(CollectInterval)
+	defer ticker.Stop()
+
+	for {
+		c.collect(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+	}
+}
+
+// collect drains the deletion queue, errors are logged and retried on the next run
+func (c *Collector) collect(ctx context.Context) {
+	for {
+		keys, err := c.repo.PendingBlobDeletions(ctx, 100)
+		if err != nil {
+			log.Printf("attachments: listing blobs to delete: %v", err)
+			return
+		}
+
+		for _, key := range keys {
+			if err := c.store.Delete(ctx, key); err != nil {
+				log.Printf("attachments: deleting blob %s: %v", key, err)
+				return
+			}
+			if err := c.repo.BlobDeleted(ctx, key); err != nil {
+				log.Printf("attachments: dequeuing blob %s: %v", key, err)
+				return
+			}
+		}
+
+		if len(keys) < 100 {
+			return
+		}
+	}
+}
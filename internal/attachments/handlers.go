@@ -0,0 +1,203 @@
+package attachments
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/blobstore"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// multipartOverhead allows for the multipart headers and boundaries around the file
+const multipartOverhead = 64 << 10
+
+// Handler struct for attachments
+type AttachmentsHandler struct {
+	service *AttachmentService
+}
+
+// Constructor for handler
+func NewAttachmentsHandler(service *AttachmentService) *AttachmentsHandler {
+	return &AttachmentsHandler{service: service}
+}
+
+// attachmentError writes the response for a service error
+func attachmentError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrNoteNotFound):
+		utils.Error(w, http.StatusNotFound, "note not found")
+	case errors.Is(err, ErrAttachmentNotFound), errors.Is(err, blobstore.ErrNotFound):
+		utils.Error(w, http.StatusNotFound, "attachment not found")
+	case errors.Is(err, ErrTooLarge), errors.As(err, &tooLarge):
+		utils.Error(w, http.StatusRequestEntityTooLarge, "attachment too large")
+	case errors.Is(err, ErrQuotaExceeded):
+		utils.Error(w, http.StatusInsufficientStorage, "storage quota exceeded")
+	case utils.IsValidationError(err):
+		utils.Error(w, http.StatusUnsupportedMediaType, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, message)
+	}
+}
+
+// urlIDs parses the note and attachment IDs of the URL, attachmentID is uuid.Nil on collection routes
+func urlIDs(r *http.Request) (noteID, attachmentID uuid.UUID, err error) {
+	noteID, err = uuid.Parse(chi.URLParam(r, "noteID"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, errors.New("invalid note ID")
+	}
+	if v := chi.URLParam(r, "attachmentID"); v != "" {
+		attachmentID, err = uuid.Parse(v)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, errors.New("invalid attachment ID")
+		}
+	}
+	return noteID, attachmentID, nil
+}
+
+// AttachmentsHandler to upload a file to a note, streamed from the "file" part of a multipart form
+func (h *AttachmentsHandler) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	noteID, _, err := urlIDs(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.service.MaxBytes()+multipartOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "expected a multipart/form-data body")
+		return
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			utils.Error(w, http.StatusBadRequest, "file is required")
+			return
+		}
+		if err != nil {
+			attachmentError(w, err, "invalid multipart body")
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		a, err := h.service.Upload(r.Context(), userID, noteID, part.FileName(), part.Header.Get("Content-Type"), part)
+		part.Close()
+		if err != nil {
+			attachmentError(w, err, "can't store attachment")
+			return
+		}
+
+		utils.JSON(w, http.StatusCreated, a)
+		return
+	}
+}
+
+// AttachmentsHandler to list the attachments of a note
+func (h *AttachmentsHandler) listAttachments(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	noteID, _, err := urlIDs(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := h.service.List(r.Context(), userID, noteID)
+	if err != nil {
+		attachmentError(w, err, "can't access attachments")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"attachments": list,
+	})
+}
+
+// AttachmentsHandler to download an attachment, with support for range requests
+func (h *AttachmentsHandler) downloadAttachment(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, false)
+}
+
+// AttachmentsHandler to download the thumbnail of an image attachment
+func (h *AttachmentsHandler) downloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, true)
+}
+
+// serve writes an attachment file or its thumbnail
+func (h *AttachmentsHandler) serve(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	noteID, attachmentID, err := urlIDs(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a, blob, err := h.service.Open(r.Context(), userID, noteID, attachmentID, thumbnail)
+	if err != nil {
+		attachmentError(w, err, "can't access attachment")
+		return
+	}
+	defer blob.Close()
+
+	contentType := a.ContentType
+	disposition := "attachment"
+	etag := a.SHA256
+	if thumbnail {
+		contentType = "image/jpeg"
+		if a.ContentType != "image/jpeg" {
+			contentType = "image/png"
+		}
+		disposition = "inline"
+		etag += "-thumbnail"
+	}
+
+	// User files are never rendered as part of the app
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("ETag", fmt.Sprintf("%q", etag))
+
+	http.ServeContent(w, r, "", a.CreatedAt, blob)
+}
+
+// AttachmentsHandler to delete an attachment
+func (h *AttachmentsHandler) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	noteID, attachmentID, err := urlIDs(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, noteID, attachmentID); err != nil {
+		attachmentError(w, err, "can't delete attachment")
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// AttachmentsHandler to report the storage used by the user and their quota
+func (h *AttachmentsHandler) getUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	usage, err := h.service.Usage(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access storage usage")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, usage)
+}
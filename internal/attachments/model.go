@@ -0,0 +1,29 @@
+package attachments
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Attachment struct {
+	ID           uuid.UUID `json:"id"`
+	NoteID       uuid.UUID `json:"noteId"`
+	UserID       uuid.UUID `json:"-"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	HasThumbnail bool      `json:"hasThumbnail"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	BlobKey      string  `json:"-"`
+	ThumbnailKey *string `json:"-"`
+}
+
+// Usage is the attachment storage used by a user
+type Usage struct {
+	BytesUsed       int64  `json:"bytesUsed"` // attachments and their thumbnails
+	AttachmentCount int    `json:"attachmentCount"`
+	QuotaBytes      *int64 `json:"quotaBytes"` // null when unlimited
+}
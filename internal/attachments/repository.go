@@ -0,0 +1,233 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errors returned by the attachments repository
+var (
+	ErrNoteNotFound       = errors.New("note not found")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+)
+
+// Repository Interface
+type AttachmentsRepository interface {
+	CheckNote(ctx context.Context, userID, noteID uuid.UUID) error
+	Create(ctx context.Context, a *Attachment, quota int64) error
+	SetThumbnail(ctx context.Context, id uuid.UUID, key string, size int64) error
+	List(ctx context.Context, userID, noteID uuid.UUID) ([]*Attachment, error)
+	Get(ctx context.Context, userID, noteID, id uuid.UUID) (*Attachment, error)
+	Delete(ctx context.Context, userID, noteID, id uuid.UUID) error
+	Usage(ctx context.Context, userID uuid.UUID) (*Usage, error)
+	PendingBlobDeletions(ctx context.Context, limit int) ([]string, error)
+	BlobDeleted(ctx context.Context, key string) error
+}
+
+// Postgres Repository
+type AttachmentsPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewAttachmentsPostgresRepository(db *pgxpool.Pool) *AttachmentsPostgresRepository {
+	return &AttachmentsPostgresRepository{db: db}
+}
+
+// attachmentColumns is the column list selected for an Attachment, in scanAttachment order
+const attachmentColumns = `a.id, a.note_id, a.user_id, a.filename, a.content_type, a.size, a.sha256,
+	a.blob_key, a.thumbnail_key, a.created_at`
+
+// scanAttachment scans a row selected with attachmentColumns
+func scanAttachment(row pgx.Row, a *Attachment) error {
+	err := row.Scan(&a.ID, &a.NoteID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256,
+		&a.BlobKey, &a.ThumbnailKey, &a.CreatedAt)
+	a.HasThumbnail = a.ThumbnailKey != nil
+	return err
+}
+
+// CheckNote returns ErrNoteNotFound unless the note exists, belongs to the user and is not trashed
+func (p *AttachmentsPostgresRepository) CheckNote(ctx context.Context, userID, noteID uuid.UUID) error {
+	var exists bool
+	err := p.db.QueryRow(ctx, `
+	SELECT EXISTS(SELECT 1 FROM notes WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, noteID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoteNotFound
+	}
+	return nil
+}
+
+// Create records an uploaded attachment, failing with ErrQuotaExceeded when it would take
+// the user's storage over quota (0 is unlimited)
+func (p *AttachmentsPostgresRepository) Create(ctx context.Context, a *Attachment, quota int64) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user's usage row so concurrent uploads can't both slip under the quota
+	_, err = tx.Exec(ctx, `INSERT INTO user_storage(user_id) VALUES ($1) ON CONFLICT DO NOTHING`, a.UserID)
+	if err != nil {
+		return err
+	}
+	var used int64
+	err = tx.QueryRow(ctx, `SELECT bytes_used FROM user_storage WHERE user_id = $1 FOR UPDATE`, a.UserID).Scan(&used)
+	if err != nil {
+		return err
+	}
+	if quota > 0 && used+a.Size > quota {
+		return ErrQuotaExceeded
+	}
+
+	// The note may have been trashed while the file was uploading
+	cmd, err := tx.Exec(ctx, `
+	INSERT INTO attachments(id, note_id, user_id, filename, content_type, size, sha256, blob_key)
+	SELECT $1, id, user_id, $3, $4, $5, $6, $7
+	FROM notes
+	WHERE id = $2 AND user_id = $8 AND deleted_at IS NULL
+	`, a.ID, a.NoteID, a.Filename, a.ContentType, a.Size, a.SHA256, a.BlobKey, a.UserID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+
+	err = tx.QueryRow(ctx, `SELECT created_at FROM attachments WHERE id = $1`, a.ID).Scan(&a.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetThumbnail records the generated thumbnail of an attachment
+func (p *AttachmentsPostgresRepository) SetThumbnail(ctx context.Context, id uuid.UUID, key string, size int64) error {
+	cmd, err := p.db.Exec(ctx, `
+	UPDATE attachments
+	SET thumbnail_key = $2, thumbnail_size = $3
+	WHERE id = $1
+	`, id, key, size)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
+
+// List the attachments of a note, oldest first
+func (p *AttachmentsPostgresRepository) List(ctx context.Context, userID, noteID uuid.UUID) ([]*Attachment, error) {
+	query := `
+	SELECT ` + attachmentColumns + `
+	FROM attachments a JOIN notes n ON n.id = a.note_id
+	WHERE a.note_id = $1 AND n.user_id = $2 AND n.deleted_at IS NULL
+	ORDER BY a.created_at, a.id
+	`
+
+	rows, err := p.db.Query(ctx, query, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return nil, err
+		}
+		list = append(list, &a)
+	}
+
+	return list, rows.Err()
+}
+
+// Get an attachment of a note
+func (p *AttachmentsPostgresRepository) Get(ctx context.Context, userID, noteID, id uuid.UUID) (*Attachment, error) {
+	query := `
+	SELECT ` + attachmentColumns + `
+	FROM attachments a JOIN notes n ON n.id = a.note_id
+	WHERE a.id = $1 AND a.note_id = $2 AND n.user_id = $3 AND n.deleted_at IS NULL
+	`
+
+	var a Attachment
+	if err := scanAttachment(p.db.QueryRow(ctx, query, id, noteID, userID), &a); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Delete an attachment, its blobs are queued for deletion by the storage trigger
+func (p *AttachmentsPostgresRepository) Delete(ctx context.Context, userID, noteID, id uuid.UUID) error {
+	query := `
+	DELETE FROM attachments a
+	USING notes n
+	WHERE a.id = $1 AND a.note_id = $2 AND n.id = a.note_id AND n.user_id = $3 AND n.deleted_at IS NULL
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, noteID, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+}
+
+// Usage returns the attachment storage used by a user
+func (p *AttachmentsPostgresRepository) Usage(ctx context.Context, userID uuid.UUID) (*Usage, error) {
+	var u Usage
+	err := p.db.QueryRow(ctx, `
+	SELECT bytes_used, attachment_count FROM user_storage WHERE user_id = $1
+	`, userID).Scan(&u.BytesUsed, &u.AttachmentCount)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// PendingBlobDeletions returns blob keys waiting to be deleted, oldest first
+func (p *AttachmentsPostgresRepository) PendingBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	rows, err := p.db.Query(ctx, `
+	SELECT blob_key FROM blob_deletions ORDER BY created_at LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// BlobDeleted removes a key from the deletion queue once its blob is gone
+func (p *AttachmentsPostgresRepository) BlobDeleted(ctx context.Context, key string) error {
+	_, err := p.db.Exec(ctx, `DELETE FROM blob_deletions WHERE blob_key = $1`, key)
+	return err
+}
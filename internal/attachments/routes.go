@@ -0,0 +1,30 @@
+package attachments
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the attachment routes, mounted under /notes/{noteID}/attachments
+func Routes(h *AttachmentsHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.listAttachments)
+	r.Post("/", h.uploadAttachment)
+	r.Get("/{attachmentID}", h.downloadAttachment)
+	r.Get("/{attachmentID}/thumbnail", h.downloadThumbnail)
+	r.Delete("/{attachmentID}", h.deleteAttachment)
+
+	return r
+}
+
+// StorageRoutes sets up the storage usage routes, mounted under /storage
+func StorageRoutes(h *AttachmentsHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.getUsage)
+
+	return r
+}
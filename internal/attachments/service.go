@@ -0,0 +1,248 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/blobstore"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// ErrTooLarge is returned when an upload exceeds the size limit
+var ErrTooLarge = errors.New("attachment too large")
+
+// MaxFilenameLength matches the attachment_filename_max_length constraint
+const MaxFilenameLength = 255
+
+// AttachmentService stores attachment files in the blob store and their metadata in the database
+type AttachmentService struct {
+	repo         AttachmentsRepository
+	store        blobstore.BlobStore
+	collector    *Collector
+	maxBytes     int64
+	allowedTypes map[string]bool
+	quota        int64
+}
+
+// NewAttachmentService creates the attachment service.
+// maxBytes limits one attachment, quota the storage of one user (0 is unlimited).
+func NewAttachmentService(repo AttachmentsRepository, store blobstore.BlobStore, collector *Collector, maxBytes int64, allowedTypes []string, quota int64) *AttachmentService {
+	allowed := make(map[string]bool, len(allowedTypes))
+	for _, t := range allowedTypes {
+		allowed[t] = true
+	}
+	return &AttachmentService{
+		repo:         repo,
+		store:        store,
+		collector:    collector,
+		maxBytes:     maxBytes,
+		allowedTypes: allowed,
+		quota:        quota,
+	}
+}
+
+// blobKey is the blob store key of an attachment file
+func blobKey(userID, id uuid.UUID) string {
+	return fmt.Sprintf("attachments/%s/%s", userID, id)
+}
+
+// thumbnailKey is the blob store key of an attachment's thumbnail, a sibling of the file
+// since the file key can't also be a directory in the local store
+func thumbnailKey(userID, id uuid.UUID) string {
+	return blobKey(userID, id) + ".thumb"
+}
+
+// detectContentType sniffs the type of an upload from its first bytes. Text is reported
+// as the declared text type when there is one, since sniffing can't tell Markdown from CSV.
+func detectContentType(head []byte, declared string) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	declared, _, _ = mime.ParseMediaType(declared)
+
+	if sniffed == "text/plain" && strings.HasPrefix(declared, "text/") {
+		return declared
+	}
+	return sniffed
+}
+
+// cleanFilename keeps the base name of an uploaded file and bounds its length
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "attachment"
+	}
+	if len(name) > MaxFilenameLength {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:MaxFilenameLength-len(ext)], "") + ext
+	}
+	return name
+}
+
+// Upload streams a file into the blob store and records it as an attachment of a note.
+// The content type is sniffed from the data and must be on the allowlist.
+func (s *AttachmentService) Upload(ctx context.Context, userID, noteID uuid.UUID, filename, declaredType string, r io.Reader) (*Attachment, error) {
+	if err := s.repo.CheckNote(ctx, userID, noteID); err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := detectContentType(head, declaredType)
+	if !s.allowedTypes[contentType] {
+		return nil, utils.NewValidationError(fmt.Sprintf("attachments of type %s are not allowed", contentType))
+	}
+
+	a := &Attachment{
+		ID:          uuid.New(),
+		NoteID:      noteID,
+		UserID:      userID,
+		Filename:    cleanFilename(filename),
+		ContentType: contentType,
+	}
+	a.BlobKey = blobKey(userID, a.ID)
+
+	// Read at most one byte past the limit to detect oversized files without buffering them
+	hash := sha256.New()
+	body := io.TeeReader(io.LimitReader(io.MultiReader(bytes.NewReader(head), r), s.maxBytes+1), hash)
+
+	size, err := s.store.Put(ctx, a.BlobKey, body, contentType)
+	if err != nil {
+		s.discard(a.BlobKey)
+		return nil, err
+	}
+	if size > s.maxBytes {
+		s.discard(a.BlobKey)
+		return nil, ErrTooLarge
+	}
+	a.Size = size
+	a.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := s.repo.Create(ctx, a, s.quota); err != nil {
+		s.discard(a.BlobKey)
+		return nil, err
+	}
+
+	s.thumbnail(ctx, a)
+	return a, nil
+}
+
+// thumbnail generates and stores the thumbnail of an image attachment.
+// Failures are logged only, the attachment stays usable without a thumbnail.
+func (s *AttachmentService) thumbnail(ctx context.Context, a *Attachment) {
+	data, contentType, err := makeThumbnail(func() (io.ReadCloser, error) {
+		return s.store.Open(ctx, a.BlobKey)
+	}, a.ContentType)
+	if errors.Is(err, errNoThumbnail) {
+		return
+	}
+	if err != nil {
+		log.Printf("attachments: thumbnail of %s: %v", a.ID, err)
+		return
+	}
+
+	key := thumbnailKey(a.UserID, a.ID)
+	size, err := s.store.Put(ctx, key, bytes.NewReader(data), contentType)
+	if err == nil {
+		err = s.repo.SetThumbnail(ctx, a.ID, key, size)
+	}
+	if err != nil {
+		log.Printf("attachments: storing thumbnail of %s: %v", a.ID, err)
+		s.discard(key)
+		return
+	}
+
+	a.ThumbnailKey = &key
+	a.HasThumbnail = true
+}
+
+// discard deletes a blob that was stored but never recorded, without the request's context
+// so a cancelled upload still cleans up after itself
+func (s *AttachmentService) discard(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := s.store.Delete(ctx, key); err != nil {
+		log.Printf("attachments: deleting unrecorded blob %s: %v", key, err)
+	}
+}
+
+// List the attachments of a note
+func (s *AttachmentService) List(ctx context.Context, userID, noteID uuid.UUID) ([]*Attachment, error) {
+	if err := s.repo.CheckNote(ctx, userID, noteID); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, userID, noteID)
+}
+
+// Open returns an attachment with its file, or its thumbnail
+func (s *AttachmentService) Open(ctx context.Context, userID, noteID, id uuid.UUID, thumbnail bool) (*Attachment, blobstore.Blob, error) {
+	a, err := s.repo.Get(ctx, userID, noteID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := a.BlobKey
+	if thumbnail {
+		if a.ThumbnailKey == nil {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		key = *a.ThumbnailKey
+	}
+
+	blob, err := s.store.Open(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, blob, nil
+}
+
+// Delete an attachment, its files are removed in the background
+func (s *AttachmentService) Delete(ctx context.Context, userID, noteID, id uuid.UUID) error {
+	if err := s.repo.Delete(ctx, userID, noteID, id); err != nil {
+		return err
+	}
+	s.collector.Wake()
+	return nil
+}
+
+// Usage returns the storage used by a user and their quota
+func (s *AttachmentService) Usage(ctx context.Context, userID uuid.UUID) (*Usage, error) {
+	u, err := s.repo.Usage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.quota > 0 {
+		u.QuotaBytes = &s.quota
+	}
+	return u, nil
+}
+
+// MaxBytes is the size limit of one attachment
+func (s *AttachmentService) MaxBytes() int64 {
+	return s.maxBytes
+}
@@ -0,0 +1,89 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Thumbnail limits
+const (
+	ThumbnailSize      = 256              // longest side in pixels
+	maxThumbnailPixels = 50 * 1000 * 1000 // larger images are not decoded, to bound memory use
+)
+
+// errNoThumbnail is returned for content types that don't get a thumbnail
+var errNoThumbnail = errors.New("no thumbnail for this content type")
+
+// thumbnailTypes maps the image types that get thumbnails to their decoders
+var thumbnailTypes = map[string]struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}{
+	"image/png":  {png.Decode, png.DecodeConfig},
+	"image/jpeg": {jpeg.Decode, jpeg.DecodeConfig},
+	"image/gif":  {gif.Decode, gif.DecodeConfig},
+	"image/webp": {webp.Decode, webp.DecodeConfig},
+}
+
+// makeThumbnail scales an image down to fit ThumbnailSize and encodes it as JPEG,
+// or as PNG for formats that may be transparent. It returns the encoded bytes and their type.
+func makeThumbnail(open func() (io.ReadCloser, error), contentType string) ([]byte, string, error) {
+	codec, ok := thumbnailTypes[contentType]
+	if !ok {
+		return nil, "", errNoThumbnail
+	}
+
+	// Check the dimensions before decoding the pixels
+	r, err := open()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := codec.decodeConfig(r)
+	r.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, "", errors.New("image too large for a thumbnail")
+	}
+
+	r, err = open()
+	if err != nil {
+		return nil, "", err
+	}
+	src, err := codec.decode(r)
+	r.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	width, height := cfg.Width, cfg.Height
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			height = max(1, height*ThumbnailSize/width)
+			width = ThumbnailSize
+		} else {
+			width = max(1, width*ThumbnailSize/height)
+			height = ThumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, dst)
+	return buf.Bytes(), "image/png", err
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/users"
+)
+
+// ClientInfo describes where a sign-in request came from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// newDevice fingerprints a client by its user agent family and IP prefix.
+// Minor browser upgrades or a new address within the same network keep the same fingerprint.
+func newDevice(userID uuid.UUID, client ClientInfo) *users.Device {
+	family := userAgentFamily(client.UserAgent)
+	prefix := ipPrefix(client.IP)
+
+	sum := sha256.Sum256([]byte(family + "|" + prefix))
+
+	return &users.Device{
+		UserID:          userID,
+		Fingerprint:     hex.EncodeToString(sum[:]),
+		UserAgentFamily: family,
+		IPPrefix:        prefix,
+	}
+}
+
+// userAgentFamily reduces a User-Agent header to "<client> on <os>", ignoring versions
+func userAgentFamily(ua string) string {
+	lower := strings.ToLower(ua)
+
+	// Order matters: most browsers also claim to be Chrome/Safari/Mozilla
+	client := "Unknown client"
+	switch {
+	case strings.Contains(lower, "edg/") || strings.Contains(lower, "edge/"):
+		client = "Edge"
+	case strings.Contains(lower, "opr/") || strings.Contains(lower, "opera"):
+		client = "Opera"
+	case strings.Contains(lower, "firefox/") || strings.Contains(lower, "fxios/"):
+		client = "Firefox"
+	case strings.Contains(lower, "chrome/") || strings.Contains(lower, "crios/"):
+		client = "Chrome"
+	case strings.Contains(lower, "safari/"):
+		client = "Safari"
+	case strings.HasPrefix(lower, "curl/"):
+		client = "curl"
+	case strings.HasPrefix(lower, "go-http-client/"):
+		client = "Go HTTP client"
+	default:
+		// Fall back to the product token without its version, e.g. "shub-sync/1.2" -> "shub-sync"
+		if fields := strings.Fields(ua); len(fields) > 0 && !strings.HasPrefix(fields[0], "/") {
+			client = strings.SplitN(fields[0], "/", 2)[0]
+		}
+	}
+
+	platform := "unknown OS"
+	switch {
+	case strings.Contains(lower, "android"):
+		platform = "Android"
+	case strings.Contains(lower, "iphone") || strings.Contains(lower, "ipad") || strings.Contains(lower, "ios"):
+		platform = "iOS"
+	case strings.Contains(lower, "windows"):
+		platform = "Windows"
+	case strings.Contains(lower, "mac os") || strings.Contains(lower, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(lower, "cros"):
+		platform = "ChromeOS"
+	case strings.Contains(lower, "linux"):
+		platform = "Linux"
+	}
+
+	return client + " on " + platform
+}
+
+// ipPrefix masks an IP address to its /24 (IPv4) or /48 (IPv6) network
+func ipPrefix(addr string) string {
+	// RemoteAddr carries a port, X-Real-IP does not
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "unknown"
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "testing"
+
+func TestUserAgentFamily(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want string
+	}{
+		{"", "Unknown client on unknown OS"},
+		{"   ", "Unknown client on unknown OS"},
+		{"/1.0", "Unknown client on unknown OS"},
+		{"curl/8.0", "curl on unknown OS"},
+		{"Go-http-client/2.0", "Go HTTP client on unknown OS"},
+		{"shub-sync/1.2 (Linux)", "shub-sync on Linux"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0", "Firefox on Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0 Mobile/15E148 Safari/604.1", "Chrome on iOS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ua, func(t *testing.T) {
+			if got := userAgentFamily(tt.ua); got != tt.want {
+				t.Errorf("userAgentFamily(%q) = %q, want %q", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
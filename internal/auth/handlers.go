@@ -2,8 +2,11 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/subrat-dwi/shubserver/internal/utils"
 )
@@ -44,6 +47,38 @@ type LoginResponse struct {
 	Salt  string `json:"salt"`
 }
 
+// ReauthRequest struct to hold the reauthentication request data
+type ReauthRequest struct {
+	Password string `json:"password"`
+}
+
+// ReauthResponse struct to hold the elevated token issued after reauthentication
+type ReauthResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ChangePasswordRequest struct to hold the password change request data
+type ChangePasswordRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+	ResetToken      string `json:"reset_token"` // from the report link, replaces current_password on a locked account
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetRequest struct to hold the email of a locked account asking for a new reset token
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// clientInfo extracts the device details used for new sign-in detection
+func clientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        r.RemoteAddr,
+	}
+}
+
 // registerUser handles the user registration endpoint
 func (h *AuthHandler) registerUser(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
@@ -55,7 +90,7 @@ func (h *AuthHandler) registerUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call the Register method of the auth service to create a new user and generate a token
-	user, token, err := h.authservice.Register(r.Context(), req.Email, req.Password)
+	user, token, err := h.authservice.Register(r.Context(), req.Email, req.Password, clientInfo(r))
 	if err != nil {
 		utils.Error(w, http.StatusBadRequest, err.Error())
 		return
@@ -84,8 +119,12 @@ func (h *AuthHandler) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call the Login method of the auth service to authenticate the user and generate a token
-	token, salt, err := h.authservice.Login(r.Context(), req.Email, req.Password)
+	token, salt, err := h.authservice.Login(r.Context(), req.Email, req.Password, clientInfo(r))
 
+	if errors.Is(err, ErrPasswordChangeRequired) {
+		utils.Error(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		utils.Error(w, http.StatusUnauthorized, err.Error())
 		return
@@ -99,3 +138,152 @@ func (h *AuthHandler) loginUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// reauthUser handles the step-up reauthentication endpoint
+func (h *AuthHandler) reauthUser(w http.ResponseWriter, r *http.Request) {
+	var req ReauthRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Password == "" {
+		utils.Error(w, http.StatusBadRequest, "password is required")
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	// Re-check the password and issue a short-lived elevated token
+	token, expiresAt, err := h.authservice.Reauthenticate(r.Context(), userID, req.Password)
+	if err != nil {
+		utils.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, ReauthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// changePassword handles the password change endpoint, also used to unlock an account after a reported sign-in
+func (h *AuthHandler) changePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, salt, err := h.authservice.ChangePassword(r.Context(), req.Email, req.CurrentPassword, req.ResetToken, req.NewPassword)
+	if errors.Is(err, ErrResetTokenRequired) {
+		utils.Error(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, LoginResponse{
+		Token: token,
+		Salt:  salt,
+	})
+}
+
+// confirmReportDevice shows the "this wasn't me" link from a new sign-in alert, asking to confirm the report
+func (h *AuthHandler) confirmReportDevice(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if err := h.authservice.CheckReportLink(token); err != nil {
+		writeReportPage(w, http.StatusBadRequest, reportPage{Title: "Link expired", Message: "This link is invalid or expired."})
+		return
+	}
+
+	writeReportPage(w, http.StatusOK, reportPage{
+		Title:   "Report a sign-in",
+		Message: "If you didn't sign in from this device, confirm below. Every session is signed out and the account stays locked until you set a new password with the token we email you.",
+		Token:   token,
+	})
+}
+
+// reportDevice handles a confirmed "this wasn't me" link, the token comes from the confirmation form
+func (h *AuthHandler) reportDevice(w http.ResponseWriter, r *http.Request) {
+	err := h.authservice.ReportDevice(r.Context(), r.FormValue("token"))
+	if errors.Is(err, ErrReportLinkUsed) {
+		writeReportPage(w, http.StatusGone, reportPage{Title: "Already reported", Message: err.Error() + "."})
+		return
+	}
+	if errors.Is(err, ErrInvalidReportLink) {
+		writeReportPage(w, http.StatusBadRequest, reportPage{Title: "Link expired", Message: "This link is invalid or expired."})
+		return
+	}
+	if err != nil {
+		writeReportPage(w, http.StatusInternalServerError, reportPage{Title: "Something went wrong", Message: "The sign-in couldn't be reported, please try again."})
+		return
+	}
+
+	writeReportPage(w, http.StatusOK, reportPage{
+		Title:   "Account locked",
+		Message: "Every session has been signed out. We've emailed you a token to set a new password, valid for 24 hours.",
+	})
+}
+
+// requestPasswordReset handles a locked account asking for a new reset token by email
+func (h *AuthHandler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Email == "" {
+		utils.Error(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	if err := h.authservice.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to request a reset token")
+		return
+	}
+
+	// The same answer for every account, so it doesn't tell which exist or are locked
+	utils.JSON(w, http.StatusAccepted, map[string]string{
+		"message": "if the account is locked, a new reset token has been emailed",
+	})
+}
+
+// listDevices handles listing the devices the user has signed in from
+func (h *AuthHandler) listDevices(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	devices, err := h.authservice.ListDevices(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access devices")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"devices": devices,
+	})
+}
+
+// forgetDevice handles removing a known device
+func (h *AuthHandler) forgetDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid device ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.authservice.ForgetDevice(r.Context(), userID, deviceID); err != nil {
+		utils.Error(w, http.StatusNotFound, "device not found")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "device removed",
+	})
+}
@@ -11,19 +11,64 @@ import (
 // JWT secret key loaded from environment variable
 var jwtSecret = []byte(os.Getenv("JWT_SECRET_KEY"))
 
+const (
+	// TokenTTL is the lifetime of a regular session token
+	TokenTTL = 12 * time.Hour
+	// ElevatedTokenTTL is the lifetime of a step-up token issued after reauthentication
+	ElevatedTokenTTL = 10 * time.Minute
+	// ReauthWindow is how long after authenticating a user may perform sensitive operations
+	ReauthWindow = 5 * time.Minute
+	// DeviceReportTokenTTL is how long a "this wasn't me" link stays valid
+	DeviceReportTokenTTL = 7 * 24 * time.Hour
+)
+
+// Token purposes, session tokens have no purpose
+const (
+	PurposeDeviceReport = "device_report"
+)
+
 // Claims struct to hold the JWT claims
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID   string `json:"user_id"`
+	AuthTime int64  `json:"auth_time"`          // Unix time the user last presented credentials
+	Elevated bool   `json:"elevated,omitempty"` // Set on short-lived tokens issued by reauth
+	Purpose  string `json:"purpose,omitempty"`  // Set on single-purpose tokens that must not be used as sessions
 	jwt.RegisteredClaims
 }
 
+// AuthenticatedAt returns the time the user last presented credentials
+func (c *Claims) AuthenticatedAt() time.Time {
+	if c.AuthTime == 0 && c.IssuedAt != nil {
+		// Tokens issued before auth_time existed were minted at login
+		return c.IssuedAt.Time
+	}
+	return time.Unix(c.AuthTime, 0)
+}
+
 // GenerateToken generates a JWT token for the given user ID
 func GenerateToken(userID string) (string, error) {
+	return signToken(userID, time.Now(), TokenTTL, false)
+}
+
+// GenerateElevatedToken generates a short-lived JWT token for a user who has just reauthenticated
+func GenerateElevatedToken(userID string) (string, time.Time, error) {
+	now := time.Now()
+	token, err := signToken(userID, now, ElevatedTokenTTL, true)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, now.Add(ElevatedTokenTTL), nil
+}
+
+// signToken builds and signs a token whose auth_time is the given time
+func signToken(userID string, authTime time.Time, ttl time.Duration, elevated bool) (string, error) {
 	claims := Claims{
-		UserID: userID,
+		UserID:   userID,
+		AuthTime: authTime.Unix(),
+		Elevated: elevated,
 		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(12 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(authTime),
+			ExpiresAt: jwt.NewNumericDate(authTime.Add(ttl)),
 		},
 	}
 	// Create a new JWT token with the claims and sign it using the secret key
@@ -32,8 +77,30 @@ func GenerateToken(userID string) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-// VerifyToken verifies the given JWT token and returns the claims if valid
+// GenerateDeviceReportToken generates a token for the "this wasn't me" link of a new sign-in alert
+func GenerateDeviceReportToken(userID, deviceID string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:  userID,
+		Purpose: PurposeDeviceReport,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        deviceID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(DeviceReportTokenTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString(jwtSecret)
+}
+
+// VerifyToken verifies the given session token and returns the claims if valid
 func VerifyToken(tokenStr string) (*Claims, error) {
+	return VerifyPurposeToken(tokenStr, "")
+}
+
+// VerifyPurposeToken verifies the given JWT token was issued for the given purpose and returns the claims if valid
+func VerifyPurposeToken(tokenStr string, purpose string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
@@ -50,5 +117,10 @@ func VerifyToken(tokenStr string) (*Claims, error) {
 		return nil, errors.New("could not parse claims")
 	}
 
+	// Single-purpose tokens must never be accepted anywhere else
+	if claims.Purpose != purpose {
+		return nil, errors.New("token not valid for this use")
+	}
+
 	return claims, nil
 }
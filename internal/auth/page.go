@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// reportPageTemplate is the page a "this wasn't me" link opens in a browser. Opening the link only
+// shows it, so mail scanners and link previews can't lock the account; the form confirms the report.
+var reportPageTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 36rem; margin: 2rem auto; padding: 0 1rem; font: 16px/1.6 system-ui, sans-serif; color: #222; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Token}}<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Sign out everywhere and lock my account</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// reportPage is the data of reportPageTemplate, Token shows the confirmation form
+type reportPage struct {
+	Title   string
+	Message string
+	Token   string
+}
+
+// writeReportPage renders reportPageTemplate
+func writeReportPage(w http.ResponseWriter, status int, p reportPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	reportPageTemplate.Execute(w, p)
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// ReauthChallenge is the WWW-Authenticate challenge sent with the 401 of an operation that needs
+// a recent authentication (RFC 9470), hinting the client to step up with POST /users/reauth
+const ReauthChallenge = `Bearer error="insufficient_user_authentication"`
+
+// IsRecentlyAuthenticated reports whether the authenticated user of the request
+// presented credentials within ReauthWindow
+func IsRecentlyAuthenticated(ctx context.Context) bool {
+	authTime, ok := ctx.Value("authTime").(time.Time)
+	if !ok {
+		return false
+	}
+	return time.Since(authTime) <= ReauthWindow
+}
@@ -1,13 +1,33 @@
 package auth
 
-import "github.com/go-chi/chi/v5"
+import (
+	"net/http"
 
-// Routes sets up the routes for the auth handler
-func Routes(h *AuthHandler) chi.Router {
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes sets up the routes for the auth handler.
+// requireAuth is the bearer-token middleware; it is passed in because the
+// middleware package itself depends on auth for token verification.
+func Routes(h *AuthHandler, requireAuth func(http.Handler) http.Handler) chi.Router {
 	r := chi.NewRouter()
 
 	r.Post("/register", h.registerUser)
 	r.Post("/login", h.loginUser)
+	r.Post("/password", h.changePassword)
+	r.Post("/password/reset", h.requestPasswordReset)
+
+	// Link from new sign-in alerts, authenticated by its own signed token.
+	// Opening it only asks for confirmation, the form posts the report.
+	r.Get("/devices/report", h.confirmReportDevice)
+	r.Post("/devices/report", h.reportDevice)
+
+	// Step-up authentication for sensitive operations
+	r.With(requireAuth).Post("/reauth", h.reauthUser)
+
+	// Known devices
+	r.With(requireAuth).Get("/devices", h.listDevices)
+	r.With(requireAuth).Delete("/devices/{id}", h.forgetDevice)
 
 	return r
 }
@@ -3,22 +3,62 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"log"
+	"net/url"
+	"time"
 
 	"fmt"
 
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/mailer"
 	"github.com/subrat-dwi/shubserver/internal/users"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Session errors returned by CheckSession and Login
+var (
+	ErrSessionRevoked         = errors.New("session has been revoked")
+	ErrPasswordChangeRequired = errors.New("password change required")
+)
+
+// Recovery errors returned by ReportDevice and ChangePassword
+var (
+	ErrInvalidReportLink  = errors.New("invalid or expired link")
+	ErrReportLinkUsed     = errors.New("this link was already used")
+	ErrResetTokenRequired = errors.New("the account is locked, a reset token from the recovery email is required")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+)
+
+// Reset tokens of locked accounts
+const (
+	PasswordResetTTL      = 24 * time.Hour   // how long an emailed reset token stays valid
+	PasswordResetInterval = 10 * time.Minute // how often a locked account can request a new one
+)
+
+// Notification kind of the alert sent for sign-ins from unknown devices
+const notificationKindNewSignIn = "new_sign_in"
+
+// Notifier delivers a notification to a user in-app and by email.
+// Implemented by the notifications module; an interface here avoids an import cycle through middleware.
+type Notifier interface {
+	NotifyUser(ctx context.Context, userID uuid.UUID, email, kind, title, body string, data map[string]string) error
+}
+
 // AuthService struct to hold the user repository
 type AuthService struct {
-	users *users.UsersPostgresRepository
+	users     *users.UsersPostgresRepository
+	notifier  Notifier
+	mailer    mailer.Mailer // reset tokens are only emailed, never stored as notifications
+	publicURL string
 }
 
-// NewAuthService creates a new instance of AuthService
-func NewAuthService(users *users.UsersPostgresRepository) *AuthService {
-	return &AuthService{users: users}
+// NewAuthService creates a new instance of AuthService.
+// publicURL is used to build the links sent in security alerts.
+func NewAuthService(users *users.UsersPostgresRepository, notifier Notifier, mailer mailer.Mailer, publicURL string) *AuthService {
+	return &AuthService{users: users, notifier: notifier, mailer: mailer, publicURL: publicURL}
 }
 
 // GenerateSalt generates a random salt of the specified length.
@@ -32,7 +72,7 @@ func GenerateSalt() ([]byte, error) {
 }
 
 // Register registers a new user and returns the user and JWT token
-func (a *AuthService) Register(ctx context.Context, email string, password string) (*users.User, string, error) {
+func (a *AuthService) Register(ctx context.Context, email string, password string, client ClientInfo) (*users.User, string, error) {
 	// check if user exists
 	existing, err := a.users.GetByEmail(ctx, email)
 	if existing != nil {
@@ -60,6 +100,9 @@ func (a *AuthService) Register(ctx context.Context, email string, password strin
 		return nil, "", err
 	}
 
+	// The registering device is the first known device, it never triggers an alert
+	a.recordSignIn(ctx, user, client)
+
 	// Encode the salt as a base64 string to include in the response
 	saltBase64 := base64.RawStdEncoding.EncodeToString(user.Salt)
 
@@ -73,7 +116,7 @@ func (a *AuthService) Register(ctx context.Context, email string, password strin
 }
 
 // Login authenticates a user and returns a JWT token if successful
-func (a *AuthService) Login(ctx context.Context, email string, password string) (string, string, error) {
+func (a *AuthService) Login(ctx context.Context, email string, password string, client ClientInfo) (string, string, error) {
 	// check if email is registered
 	user, err := a.users.GetByEmail(ctx, email)
 	if err != nil {
@@ -85,13 +128,270 @@ func (a *AuthService) Login(ctx context.Context, email string, password string)
 		return "", "", fmt.Errorf("invalid credentials")
 	}
 
+	// a reported sign-in locks the account until the password is changed
+	if user.MustChangePassword {
+		return "", "", ErrPasswordChangeRequired
+	}
+
 	token, err := GenerateToken(user.Id.String())
 	if err != nil {
 		return "", "", err
 	}
 
+	// remember the device and alert the user if it is new
+	a.recordSignIn(ctx, user, client)
+
 	// Encode the salt as a base64 string to include in the response
 	saltBase64 := base64.RawStdEncoding.EncodeToString(user.Salt)
 
 	return token, saltBase64, nil
 }
+
+// Reauthenticate re-checks the password of an already signed-in user and returns a short-lived elevated token
+func (a *AuthService) Reauthenticate(ctx context.Context, userID uuid.UUID, password string) (string, time.Time, error) {
+	user, err := a.users.GetAuthByID(ctx, userID.String())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid credentials")
+	}
+
+	// verify password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid credentials")
+	}
+
+	return GenerateElevatedToken(user.Id.String())
+}
+
+// ChangePassword replaces the user's password after checking the current one.
+// An account locked by a reported sign-in needs the reset token of the report link instead:
+// whoever signed in already knows the current password. The token is used up.
+// All existing sessions are revoked and a fresh token is returned.
+func (a *AuthService) ChangePassword(ctx context.Context, email string, currentPassword string, resetToken string, newPassword string) (string, string, error) {
+	user, err := a.users.GetByEmail(ctx, email)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid credentials")
+	}
+
+	if resetToken == "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+			return "", "", fmt.Errorf("invalid credentials")
+		}
+		if user.MustChangePassword {
+			return "", "", ErrResetTokenRequired
+		}
+	}
+
+	if newPassword == "" {
+		return "", "", fmt.Errorf("new password is required")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(newPassword)) == nil {
+		return "", "", fmt.Errorf("new password must be different from the current password")
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+
+	if resetToken != "" {
+		ok, err := a.users.ResetPassword(ctx, user.Id.String(), hashResetToken(resetToken), string(passwordHash))
+		if err != nil {
+			return "", "", err
+		}
+		if !ok {
+			return "", "", ErrInvalidResetToken
+		}
+	} else if err := a.users.UpdatePassword(ctx, user.Id.String(), string(passwordHash)); err != nil {
+		return "", "", err
+	}
+
+	token, err := GenerateToken(user.Id.String())
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, base64.RawStdEncoding.EncodeToString(user.Salt), nil
+}
+
+// CheckSession verifies that a token issued at issuedAt still belongs to a live session
+func (a *AuthService) CheckSession(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error {
+	user, err := a.users.GetAuthByID(ctx, userID.String())
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	// iat has second precision, so compare against the revocation time truncated the same way
+	if user.SessionsRevokedAt != nil && issuedAt.Before(user.SessionsRevokedAt.Truncate(time.Second)) {
+		return ErrSessionRevoked
+	}
+
+	if user.MustChangePassword {
+		return ErrPasswordChangeRequired
+	}
+
+	return nil
+}
+
+// CheckReportLink verifies the token of a "this wasn't me" link without using it
+func (a *AuthService) CheckReportLink(reportToken string) error {
+	claims, err := VerifyPurposeToken(reportToken, PurposeDeviceReport)
+	if err != nil || claims.ExpiresAt == nil {
+		return ErrInvalidReportLink
+	}
+	return nil
+}
+
+// ReportDevice handles a confirmed "this wasn't me" link of a new sign-in alert: the device is forgotten,
+// every session is revoked and a password change is forced. Each link works once. The single-use
+// reset token ChangePassword then needs is emailed to the account, not returned to whoever opened the link.
+func (a *AuthService) ReportDevice(ctx context.Context, reportToken string) error {
+	claims, err := VerifyPurposeToken(reportToken, PurposeDeviceReport)
+	if err != nil || claims.ExpiresAt == nil {
+		return ErrInvalidReportLink
+	}
+
+	resetToken, err := newResetToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(PasswordResetTTL)
+
+	ok, err := a.users.LockForRecovery(ctx, claims.UserID, claims.ID, claims.ExpiresAt.Time, hashResetToken(resetToken), expiresAt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrReportLinkUsed
+	}
+
+	user, err := a.users.GetAuthByID(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	a.sendResetToken(ctx, user, resetToken, expiresAt)
+	return nil
+}
+
+// RequestPasswordReset emails a new reset token to a locked account, for a token that was lost or expired.
+// Unknown and unlocked accounts, and accounts that got a token in the last PasswordResetInterval, are
+// ignored without an error so the answer doesn't tell which accounts exist.
+func (a *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := a.users.GetByEmail(ctx, email)
+	if err != nil || !user.MustChangePassword {
+		return nil
+	}
+
+	resetToken, err := newResetToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(PasswordResetTTL)
+
+	ok, err := a.users.RenewPasswordReset(ctx, user.Id.String(), time.Now().Add(-PasswordResetInterval), hashResetToken(resetToken), expiresAt)
+	if err != nil || !ok {
+		return err
+	}
+
+	a.sendResetToken(ctx, user, resetToken, expiresAt)
+	return nil
+}
+
+// sendResetToken emails a reset token to the owner of a locked account. Failures are logged only,
+// a new token can be requested.
+func (a *AuthService) sendResetToken(ctx context.Context, user *users.UserDB, resetToken string, expiresAt time.Time) {
+	body := fmt.Sprintf("Your ShubServer account was locked and every session signed out after a sign-in was reported.\n\n"+
+		"Set a new password with this reset token, valid until %s:\n\n%s\n\n"+
+		"Send it as reset_token with your email and a new_password to:\n\nPOST %s/api/users/password\n\n"+
+		"If it expires, request a new one with POST %s/api/users/password/reset.\n",
+		expiresAt.UTC().Format(time.RFC1123), resetToken, a.publicURL, a.publicURL)
+
+	if err := a.mailer.Send(ctx, user.Email, "Reset the password of your account", body); err != nil {
+		log.Printf("auth: reset token email for user %s: %v", user.Id, err)
+	}
+}
+
+// newResetToken returns a random single-use reset token
+func newResetToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashResetToken returns the SHA-256 of a reset token, only the hash is stored
+func hashResetToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// ListDevices lists the devices a user has signed in from
+func (a *AuthService) ListDevices(ctx context.Context, userID uuid.UUID) ([]*users.Device, error) {
+	return a.users.ListDevices(ctx, userID.String())
+}
+
+// ForgetDevice removes a known device, the next sign-in from it will trigger an alert
+func (a *AuthService) ForgetDevice(ctx context.Context, userID, deviceID uuid.UUID) error {
+	return a.users.DeleteDevice(ctx, userID.String(), deviceID.String())
+}
+
+// recordSignIn remembers the device a user signed in from and sends a
+// new sign-in alert when it was never seen before. Tracking failures are
+// logged only, they must never block a sign-in.
+func (a *AuthService) recordSignIn(ctx context.Context, user *users.UserDB, client ClientInfo) {
+	device := newDevice(user.Id, client)
+
+	known, err := a.users.CountDevices(ctx, user.Id.String())
+	if err != nil {
+		log.Printf("auth: counting devices for user %s: %v", user.Id, err)
+		return
+	}
+
+	isNew, err := a.users.TouchDevice(ctx, device)
+	if err != nil {
+		log.Printf("auth: recording device for user %s: %v", user.Id, err)
+		return
+	}
+
+	// the very first device of an account is not suspicious
+	if !isNew || known == 0 {
+		return
+	}
+
+	// deliver in the background so a slow mail server doesn't delay the login response
+	go a.alertNewSignIn(user.Id, user.Email, device)
+}
+
+// alertNewSignIn emits the "new sign-in" notification for a device
+func (a *AuthService) alertNewSignIn(userID uuid.UUID, email string, device *users.Device) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	reportToken, err := GenerateDeviceReportToken(userID.String(), device.ID.String())
+	if err != nil {
+		log.Printf("auth: creating report link for user %s: %v", userID, err)
+		return
+	}
+	reportURL := a.publicURL + "/api/users/devices/report?token=" + url.QueryEscape(reportToken)
+
+	body := fmt.Sprintf("We noticed a new sign-in to your ShubServer account.\n\n"+
+		"Device:  %s\n"+
+		"Network: %s\n"+
+		"Time:    %s\n\n"+
+		"If this was you, you can ignore this message.\n\n"+
+		"If this wasn't you, open the link below and confirm. It signs out every session\n"+
+		"and emails you a token to set a new password before the account can be used again:\n\n%s\n",
+		device.UserAgentFamily, device.IPPrefix, device.LastSeenAt.UTC().Format(time.RFC1123), reportURL)
+
+	data := map[string]string{
+		"device_id":         device.ID.String(),
+		"user_agent_family": device.UserAgentFamily,
+		"ip_prefix":         device.IPPrefix,
+		"report_url":        reportURL,
+	}
+
+	err = a.notifier.NotifyUser(ctx, userID, email, notificationKindNewSignIn, "New sign-in to your account", body, data)
+	if err != nil {
+		log.Printf("auth: new sign-in alert for user %s: %v", userID, err)
+	}
+}
@@ -0,0 +1,214 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/subrat-dwi/shubserver/internal/notes"
+	passwordmanager "github.com/subrat-dwi/shubserver/internal/password-manager"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// maxBodyBytes limits the size of a batch request
+const maxBodyBytes = 32 << 20
+
+// Handler struct for batches
+type BatchHandler struct {
+	db            *pgxpool.Pool
+	notes         *notes.NotesPostgresRepository
+	notesService  *notes.NotesService
+	passwords     *passwordmanager.PasswordsPostgresRepository
+	maxOperations int
+}
+
+// Constructor for handler, searchLanguage and maxContent are passed on to the notes service,
+// maxOperations limits the operations of one batch
+func NewBatchHandler(db *pgxpool.Pool, notesRepo *notes.NotesPostgresRepository,
+	passwordsRepo *passwordmanager.PasswordsPostgresRepository, searchLanguage string, maxContent, maxOperations int) *BatchHandler {
+	return &BatchHandler{
+		db:            db,
+		notes:         notesRepo,
+		notesService:  notes.NewNotesService(notesRepo, searchLanguage, maxContent),
+		passwords:     passwordsRepo,
+		maxOperations: maxOperations,
+	}
+}
+
+// BatchHandler to run many operations on notes and vault entries in one transaction.
+// Every operation goes through the same service as its single endpoint, so it is validated
+// and answered the same way.
+func (h *BatchHandler) runBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	if err := h.validate(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "batch failed")
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	resp := BatchResponse{Mode: req.Mode, Results: make([]*Result, 0, len(req.Operations))}
+	failed := false
+	for i, op := range req.Operations {
+		// An atomic batch stops at the first failure
+		if failed && req.Mode == ModeAtomic {
+			resp.Results = append(resp.Results, &Result{Index: i, Status: http.StatusFailedDependency, ID: op.ID})
+			continue
+		}
+
+		result, err := h.run(r.Context(), tx, op)
+		if err != nil {
+			log.Printf("batch: operation %d: %v", i, err)
+			utils.Error(w, http.StatusInternalServerError, "batch failed")
+			return
+		}
+		result.Index = i
+		resp.Results = append(resp.Results, result)
+		if result.Status >= 400 {
+			failed = true
+		}
+	}
+
+	if !failed || req.Mode == ModeBestEffort {
+		if err := tx.Commit(r.Context()); err != nil {
+			utils.Error(w, http.StatusInternalServerError, "batch failed")
+			return
+		}
+		resp.Committed = true
+	}
+
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// validate checks the mode and operations of a batch before anything runs
+func (h *BatchHandler) validate(req *BatchRequest) error {
+	switch req.Mode {
+	case "":
+		req.Mode = ModeAtomic
+	case ModeAtomic, ModeBestEffort:
+	default:
+		return utils.NewValidationError("mode must be atomic or best_effort")
+	}
+
+	if len(req.Operations) == 0 {
+		return utils.NewValidationError("operations is required")
+	}
+	if len(req.Operations) > h.maxOperations {
+		return utils.NewValidationError(fmt.Sprintf("at most %d operations are allowed", h.maxOperations))
+	}
+
+	for i, op := range req.Operations {
+		if op.Kind != "note" && op.Kind != "password" {
+			return utils.NewValidationError(fmt.Sprintf("operations[%d]: kind must be note or password", i))
+		}
+		switch op.Action {
+		case ActionCreate:
+		case ActionUpdate, ActionPatch, ActionDelete:
+			if _, err := uuid.Parse(op.ID); err != nil {
+				return utils.NewValidationError(fmt.Sprintf("operations[%d]: id is required", i))
+			}
+		default:
+			return utils.NewValidationError(fmt.Sprintf("operations[%d]: action must be create, update, patch or delete", i))
+		}
+		if op.Action != ActionDelete && len(op.Body) == 0 {
+			return utils.NewValidationError(fmt.Sprintf("operations[%d]: body is required", i))
+		}
+	}
+
+	return nil
+}
+
+// run executes one operation in a savepoint of tx, which is rolled back when the operation fails
+func (h *BatchHandler) run(ctx context.Context, tx pgx.Tx, op Operation) (*Result, error) {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer savepoint.Rollback(ctx)
+
+	userID := ctx.Value("userID").(uuid.UUID)
+
+	var result *Result
+	if op.Kind == "note" {
+		repo := h.notes.WithTx(savepoint)
+		result = runNote(ctx, repo, h.notesService.WithRepo(repo), userID, op)
+	} else {
+		result = runPassword(ctx, passwordmanager.NewPasswordService(h.passwords.WithTx(savepoint)), userID, op)
+	}
+	if result.ID == "" {
+		result.ID = op.ID
+	}
+
+	if result.Status >= 400 {
+		return result, nil
+	}
+	return result, savepoint.Commit(ctx)
+}
+
+// succeeded is the result of an operation with the body and ETag the single endpoint answers with
+func succeeded(status int, id string, version int64, body interface{}) *Result {
+	result := &Result{Status: status, ID: id, Body: marshal(body)}
+	if version != 0 {
+		result.ETag = utils.ETag(version)
+	}
+	return result
+}
+
+// failed is the result of an operation the single endpoint answers with an error
+func failed(status int, message string) *Result {
+	return &Result{Status: status, Body: marshal(map[string]string{
+		"status":  fmt.Sprint(status),
+		"message": message,
+	})}
+}
+
+// preconditionFailed is the 412 result of an operation with the current server copy of the item,
+// current is nil when the user can't see it anymore
+func preconditionFailed(version int64, current interface{}) *Result {
+	if current == nil {
+		return failed(http.StatusPreconditionFailed, "precondition failed")
+	}
+	return &Result{Status: http.StatusPreconditionFailed, ETag: utils.ETag(version), Body: marshal(map[string]interface{}{
+		"status":  fmt.Sprint(http.StatusPreconditionFailed),
+		"message": "the resource was changed, current is the server copy",
+		"current": current,
+	})}
+}
+
+// marshal encodes the body of a result, nil stays empty
+func marshal(body interface{}) json.RawMessage {
+	if body == nil {
+		return nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("batch: encoding result: %v", err)
+		return nil
+	}
+	return data
+}
+
+// decodeObject decodes the body of an update or patch into a JSON object, like a merge patch
+func decodeObject(body json.RawMessage) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, errors.New("body must be a JSON object")
+	}
+	return fields, nil
+}
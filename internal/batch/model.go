@@ -0,0 +1,48 @@
+package batch
+
+import "encoding/json"
+
+// Batch modes
+const (
+	ModeAtomic     = "atomic"      // all operations are committed, or none when one fails
+	ModeBestEffort = "best_effort" // successful operations are committed, failed ones are rolled back alone
+)
+
+// Operation actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update" // replaces the item like PUT
+	ActionPatch  = "patch"  // JSON Merge Patch like PATCH
+	ActionDelete = "delete"
+)
+
+// Operation is one create, update, patch or delete of a note or vault entry
+type Operation struct {
+	Action  string          `json:"action"`
+	Kind    string          `json:"kind"`               // note or password
+	ID      string          `json:"id,omitempty"`       // required except for create
+	IfMatch string          `json:"if_match,omitempty"` // ETag the item must still have
+	Body    json.RawMessage `json:"body,omitempty"`     // request body of the single endpoint
+}
+
+// Request struct for running a batch
+type BatchRequest struct {
+	Mode       string      `json:"mode"` // atomic (default) or best_effort
+	Operations []Operation `json:"operations"`
+}
+
+// Result is the response the single endpoint would give to an operation
+type Result struct {
+	Index  int             `json:"index"`
+	Status int             `json:"status"`
+	ID     string          `json:"id,omitempty"`
+	ETag   string          `json:"etag,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response struct for a batch, Committed is false when an atomic batch was rolled back
+type BatchResponse struct {
+	Mode      string    `json:"mode"`
+	Committed bool      `json:"committed"`
+	Results   []*Result `json:"results"`
+}
@@ -0,0 +1,207 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/auth"
+	"github.com/subrat-dwi/shubserver/internal/notes"
+	passwordmanager "github.com/subrat-dwi/shubserver/internal/password-manager"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// runNote runs an operation on a note like the notes endpoints, without rewriting links on renames
+func runNote(ctx context.Context, repo notes.NotesRepository, service *notes.NotesService, userID uuid.UUID, op Operation) *Result {
+	if op.Action == ActionCreate {
+		var note notes.Note
+		if err := json.Unmarshal(op.Body, &note); err != nil {
+			return failed(http.StatusBadRequest, "invalid JSON")
+		}
+		created, err := service.CreateNote(ctx, userID, &note)
+		if err != nil {
+			return noteError(ctx, repo, userID, op.ID, err)
+		}
+		return succeeded(http.StatusCreated, created.ID.String(), created.Version, created)
+	}
+
+	existing, err := repo.Get(ctx, userID, op.ID)
+	if err != nil {
+		if op.Action == ActionDelete {
+			return failed(http.StatusNotFound, "cannot delete note")
+		}
+		return failed(http.StatusNotFound, "note not found")
+	}
+	expected, ok := utils.MatchIfMatch(op.IfMatch, existing.Version)
+	if !ok {
+		return preconditionFailed(existing.Version, existing)
+	}
+
+	switch op.Action {
+	case ActionDelete:
+		if err := repo.Delete(ctx, userID, op.ID, expected); err != nil {
+			if errors.Is(err, notes.ErrNotOwner) {
+				return failed(http.StatusForbidden, err.Error())
+			}
+			if errors.Is(err, notes.ErrVersionConflict) {
+				return noteError(ctx, repo, userID, op.ID, err)
+			}
+			return failed(http.StatusNotFound, "cannot delete note")
+		}
+		return succeeded(http.StatusOK, op.ID, 0, map[string]string{"message": "note deleted successfully"})
+
+	case ActionUpdate:
+		var payload notes.Note
+		if err := json.Unmarshal(op.Body, &payload); err != nil {
+			return failed(http.StatusBadRequest, "invalid JSON")
+		}
+		fields, decodeErr := decodeObject(op.Body)
+		if decodeErr != nil {
+			return failed(http.StatusBadRequest, "invalid JSON")
+		}
+		err = service.SaveNote(ctx, userID, existing, &payload, fields, expected, false)
+
+	case ActionPatch:
+		patch, decodeErr := decodeObject(op.Body)
+		if decodeErr != nil {
+			return failed(http.StatusBadRequest, "a merge patch must be a JSON object")
+		}
+		err = service.PatchNote(ctx, userID, existing, patch, expected, false)
+	}
+
+	if err != nil {
+		return noteError(ctx, repo, userID, op.ID, err)
+	}
+	return succeeded(http.StatusOK, op.ID, existing.Version, existing)
+}
+
+// noteError is the result of a failed note operation, with the status the notes endpoints answer
+func noteError(ctx context.Context, repo notes.NotesRepository, userID uuid.UUID, id string, err error) *Result {
+	var conflict *notes.MergeConflict
+	switch {
+	case utils.IsValidationError(err), errors.Is(err, notes.ErrNotebookNotFound):
+		return failed(http.StatusBadRequest, err.Error())
+	case errors.Is(err, notes.ErrOwnerOnly), errors.Is(err, notes.ErrReadOnly):
+		return failed(http.StatusForbidden, err.Error())
+	case errors.Is(err, notes.ErrNoteExists):
+		return failed(http.StatusConflict, err.Error())
+	case errors.As(err, &conflict):
+		return &Result{Status: http.StatusConflict, Body: marshal(conflict)}
+	case errors.Is(err, notes.ErrEditNotMerged):
+		return failed(http.StatusConflict, err.Error())
+	case errors.Is(err, notes.ErrVersionConflict):
+		current, err := repo.Get(ctx, userID, id)
+		if err != nil {
+			return preconditionFailed(0, nil)
+		}
+		return preconditionFailed(current.Version, current)
+	default:
+		return failed(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// runPassword runs an operation on a vault entry like the password endpoints
+func runPassword(ctx context.Context, service *passwordmanager.PasswordService, userID uuid.UUID, op Operation) *Result {
+	if op.Action == ActionCreate {
+		var req passwordmanager.CreatePasswordRequest
+		if err := json.Unmarshal(op.Body, &req); err != nil {
+			return failed(http.StatusBadRequest, "Invalid request payload")
+		}
+		var id uuid.UUID
+		if req.ID != "" {
+			var err error
+			if id, err = uuid.Parse(req.ID); err != nil {
+				return failed(http.StatusBadRequest, "invalid password ID")
+			}
+		}
+		password, err := req.NewPassword(id, userID)
+		if err != nil {
+			return failed(http.StatusBadRequest, err.Error())
+		}
+		created, err := service.CreatePassword(ctx, password)
+		if err != nil {
+			return passwordError(ctx, service, userID, id, err)
+		}
+		return succeeded(http.StatusCreated, created.ID.String(), created.Version,
+			passwordmanager.CreatePasswordResponse{PasswordItem: passwordmanager.ToPasswordItem(created)})
+	}
+
+	// Deleting an entry needs a recent authentication like DELETE /passwords/{id}
+	if op.Action == ActionDelete && !auth.IsRecentlyAuthenticated(ctx) {
+		return failed(http.StatusUnauthorized, "Recent Authentication Required")
+	}
+
+	id := uuid.MustParse(op.ID)
+	var expected int64
+	if op.IfMatch != "" {
+		current, err := service.GetPassword(ctx, userID, id)
+		if err != nil {
+			return failed(http.StatusNotFound, "password not found")
+		}
+		var ok bool
+		if expected, ok = utils.MatchIfMatch(op.IfMatch, current.Version); !ok {
+			return preconditionFailed(current.Version, passwordmanager.ServerCopy(ctx, current))
+		}
+	}
+
+	var updated *passwordmanager.Password
+	var err error
+	switch op.Action {
+	case ActionDelete:
+		if err := service.DeletePassword(ctx, userID, id, expected); err != nil {
+			return passwordError(ctx, service, userID, id, err)
+		}
+		return succeeded(http.StatusNoContent, op.ID, 0, nil)
+
+	case ActionUpdate:
+		var req passwordmanager.CreatePasswordRequest
+		if err := json.Unmarshal(op.Body, &req); err != nil {
+			return failed(http.StatusBadRequest, "Invalid request payload")
+		}
+		password, decodeErr := req.NewPassword(id, userID)
+		if decodeErr != nil {
+			return failed(http.StatusBadRequest, decodeErr.Error())
+		}
+		updated, err = service.UpdatePassword(ctx, password, req.RequireReauth, expected)
+
+	case ActionPatch:
+		fields, decodeErr := decodeObject(op.Body)
+		if decodeErr != nil {
+			return failed(http.StatusBadRequest, "a merge patch must be a JSON object")
+		}
+		patch, decodeErr := passwordmanager.DecodePasswordPatch(fields)
+		if decodeErr != nil {
+			return failed(http.StatusBadRequest, decodeErr.Error())
+		}
+		updated, err = service.PatchPassword(ctx, userID, id, patch, expected)
+	}
+
+	if err != nil {
+		return passwordError(ctx, service, userID, id, err)
+	}
+	return succeeded(http.StatusOK, op.ID, updated.Version, passwordmanager.ToPasswordItem(updated))
+}
+
+// passwordError is the result of a failed vault entry operation, with the status the password endpoints answer
+func passwordError(ctx context.Context, service *passwordmanager.PasswordService, userID, id uuid.UUID, err error) *Result {
+	switch {
+	case utils.IsValidationError(err):
+		return failed(http.StatusBadRequest, err.Error())
+	case errors.Is(err, passwordmanager.ErrReauthRequired):
+		return failed(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, passwordmanager.ErrPasswordNotFound):
+		return failed(http.StatusNotFound, "password not found")
+	case errors.Is(err, passwordmanager.ErrPasswordExists):
+		return failed(http.StatusConflict, err.Error())
+	case errors.Is(err, passwordmanager.ErrVersionConflict):
+		current, err := service.GetPassword(ctx, userID, id)
+		if err != nil {
+			return preconditionFailed(0, nil)
+		}
+		return preconditionFailed(current.Version, passwordmanager.ServerCopy(ctx, current))
+	default:
+		return failed(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,16 @@
+package batch
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the routes for the batch module
+func Routes(h *BatchHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Post("/", h.runBatch)
+
+	return r
+}
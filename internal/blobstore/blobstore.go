@@ -0,0 +1,48 @@
+// Package blobstore stores binary objects such as note attachments.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/subrat-dwi/shubserver/internal/config"
+)
+
+// ErrNotFound is returned when a blob doesn't exist
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is an open blob. Seeking is cheap, so it can serve range requests.
+type Blob interface {
+	io.ReadSeekCloser
+}
+
+// BlobStore stores blobs under keys chosen by the caller
+type BlobStore interface {
+	// Put streams r into the blob at key, replacing any existing blob, and returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error)
+	// Open opens the blob at key for reading
+	Open(ctx context.Context, key string) (Blob, error)
+	// Delete removes the blob at key, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the blob store selected by the configuration
+func New(cfg *config.Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case "", "local":
+		return NewLocalStore(cfg.BlobLocalDir)
+	case "s3":
+		return NewS3Store(context.Background(), S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("blobstore: unknown BLOB_STORE %q, expected local or s3", cfg.BlobStore)
+	}
+}
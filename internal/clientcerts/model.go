@@ -0,0 +1,23 @@
+package clientcerts
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Match types of a client identity
+const (
+	MatchSubject = "subject"
+	MatchSANURI  = "san_uri"
+)
+
+// ClientIdentity maps a certificate subject or URI SAN to a user or service principal
+type ClientIdentity struct {
+	ID          uuid.UUID
+	MatchType   string
+	MatchValue  string
+	UserID      *uuid.UUID
+	ServiceName *string
+	CreatedAt   time.Time
+}
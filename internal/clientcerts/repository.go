@@ -0,0 +1,48 @@
+package clientcerts
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Client Identities Repository Interface
+type ClientIdentitiesRepository interface {
+	FindMatch(ctx context.Context, matchType string, values []string) (*ClientIdentity, error)
+}
+
+// Postgres Repository
+type ClientIdentitiesPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewClientIdentitiesPostgresRepository(db *pgxpool.Pool) *ClientIdentitiesPostgresRepository {
+	return &ClientIdentitiesPostgresRepository{db: db}
+}
+
+// FindMatch returns the identity whose match value equals one of the given values
+func (p *ClientIdentitiesPostgresRepository) FindMatch(ctx context.Context, matchType string, values []string) (*ClientIdentity, error) {
+	query := `
+	SELECT id, match_type, match_value, user_id, service_name, created_at
+	FROM client_identities
+	WHERE match_type = $1 AND match_value = ANY($2)
+	ORDER BY match_value
+	LIMIT 1
+	`
+
+	var c ClientIdentity
+	err := p.db.QueryRow(ctx, query, matchType, values).Scan(
+		&c.ID,
+		&c.MatchType,
+		&c.MatchValue,
+		&c.UserID,
+		&c.ServiceName,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,54 @@
+package clientcerts
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Resolver maps verified client certificates to principals using the client_identities table
+type Resolver struct {
+	repo ClientIdentitiesRepository
+}
+
+// NewResolver creates a new certificate resolver
+func NewResolver(repo ClientIdentitiesRepository) *Resolver {
+	return &Resolver{repo: repo}
+}
+
+// ResolveCertificate looks up the certificate's URI SANs first, then its subject DN.
+// The certificate must already be verified against the client CA.
+func (r *Resolver) ResolveCertificate(ctx context.Context, cert *x509.Certificate) (*middleware.Principal, error) {
+	if len(cert.URIs) > 0 {
+		uris := make([]string, 0, len(cert.URIs))
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+		}
+
+		if identity, err := r.repo.FindMatch(ctx, MatchSANURI, uris); err == nil {
+			return toPrincipal(identity), nil
+		}
+	}
+
+	identity, err := r.repo.FindMatch(ctx, MatchSubject, []string{cert.Subject.String()})
+	if err != nil {
+		return nil, errors.New("client certificate is not mapped to a principal")
+	}
+
+	return toPrincipal(identity), nil
+}
+
+// toPrincipal converts a stored identity to the principal used by the middleware
+func toPrincipal(identity *ClientIdentity) *middleware.Principal {
+	principal := &middleware.Principal{UserID: uuid.Nil}
+	if identity.UserID != nil {
+		principal.UserID = *identity.UserID
+	}
+	if identity.ServiceName != nil {
+		principal.Service = *identity.ServiceName
+	}
+	return principal
+}
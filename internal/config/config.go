@@ -1,10 +1,76 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAttachmentTypes are the attachment MIME types accepted when ATTACHMENT_ALLOWED_TYPES is unset
+var DefaultAttachmentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp",
+	"application/pdf", "application/zip",
+	"text/plain", "text/markdown", "text/csv",
+}
 
 type Config struct {
 	Port string
 	Env  string
+
+	// PublicURL is the externally reachable base URL, used for links in emails and share links
+	PublicURL string
+	// TrustProxy makes the server take client IPs from X-Forwarded-For / X-Real-IP
+	TrustProxy bool
+
+	// TLS is served when a certificate and key are configured
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile enables client certificate verification against this CA bundle
+	TLSClientCAFile string
+	// TLSClientAuth is "optional" (default, tokens still work) or "require"
+	TLSClientAuth string
+	// MTLSRoutes are API groups, e.g. "/passwords", that require a mapped client certificate
+	// in addition to the bearer token
+	MTLSRoutes []string
+	// MTLSOnlyRoutes are API groups authenticated by a client certificate instead, service principals included
+	MTLSOnlyRoutes []string
+
+	// SearchLanguage is the default Postgres text search configuration for notes
+	SearchLanguage string
+	// NoteRevisionsMaxCount and NoteRevisionsMaxAge limit the revisions kept per note, 0 keeps all
+	NoteRevisionsMaxCount int
+	NoteRevisionsMaxAge   time.Duration
+	// NoteMaxContentBytes limits the size of the content of a note
+	NoteMaxContentBytes int
+	// TrashRetention is how long deleted notes and vault entries stay in the trash
+	TrashRetention time.Duration
+
+	// BlobStore is "local" (default, files below BlobLocalDir) or "s3"
+	BlobStore    string
+	BlobLocalDir string
+	S3Endpoint   string
+	S3Region     string
+	S3Bucket     string
+	S3AccessKey  string
+	S3SecretKey  string
+	S3UseSSL     bool
+
+	// AttachmentMaxBytes limits the size of one attachment
+	AttachmentMaxBytes int64
+	// AttachmentAllowedTypes lists the accepted attachment MIME types
+	AttachmentAllowedTypes []string
+	// StorageQuotaBytes limits the attachment storage of each user, 0 is unlimited
+	StorageQuotaBytes int64
+
+	// BatchMaxOperations limits the operations of one POST /batch request
+	BatchMaxOperations int
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 func Load() *Config {
@@ -16,6 +82,94 @@ func Load() *Config {
 	if env == "" {
 		env = "dev"
 	}
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+	searchLanguage := os.Getenv("SEARCH_LANGUAGE")
+	if searchLanguage == "" {
+		searchLanguage = "english"
+	}
+	clientAuth := os.Getenv("TLS_CLIENT_AUTH")
+	if clientAuth == "" {
+		clientAuth = "optional"
+	}
+	blobLocalDir := os.Getenv("BLOB_LOCAL_DIR")
+	if blobLocalDir == "" {
+		blobLocalDir = "./data/blobs"
+	}
+	allowedTypes := DefaultAttachmentTypes
+	if v := os.Getenv("ATTACHMENT_ALLOWED_TYPES"); v != "" {
+		allowedTypes = nil
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				allowedTypes = append(allowedTypes, strings.ToLower(t))
+			}
+		}
+	}
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+
+	return &Config{
+		Port:       ":" + port,
+		Env:        env,
+		PublicURL:  publicURL,
+		TrustProxy: os.Getenv("TRUST_PROXY") == "true",
+
+		TLSCertFile:     os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:      os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		TLSClientAuth:   clientAuth,
+		MTLSRoutes:      envList("MTLS_ROUTES"),
+		MTLSOnlyRoutes:  envList("MTLS_ONLY_ROUTES"),
+
+		SearchLanguage:        searchLanguage,
+		NoteRevisionsMaxCount: envInt("NOTE_REVISIONS_MAX_COUNT", 50),
+		NoteRevisionsMaxAge:   time.Duration(envInt("NOTE_REVISIONS_MAX_AGE_DAYS", 90)) * 24 * time.Hour,
+		NoteMaxContentBytes:   envInt("NOTE_MAX_CONTENT_MB", 5) << 20,
+		TrashRetention:        time.Duration(envInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+
+		BlobStore:    os.Getenv("BLOB_STORE"),
+		BlobLocalDir: blobLocalDir,
+		S3Endpoint:   os.Getenv("S3_ENDPOINT"),
+		S3Region:     os.Getenv("S3_REGION"),
+		S3Bucket:     os.Getenv("S3_BUCKET"),
+		S3AccessKey:  os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:  os.Getenv("S3_SECRET_KEY"),
+		S3UseSSL:     os.Getenv("S3_USE_SSL") != "false",
+
+		AttachmentMaxBytes:     int64(envInt("ATTACHMENT_MAX_MB", 25)) << 20,
+		AttachmentAllowedTypes: allowedTypes,
+		StorageQuotaBytes:      int64(envInt("STORAGE_QUOTA_MB", 0)) << 20,
+
+		BatchMaxOperations: envInt("BATCH_MAX_OPERATIONS", 500),
 
-	return &Config{Port: ":" + port, Env: env}
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// envList reads a comma separated environment variable, skipping empty entries
+func envList(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envInt reads a non-negative integer environment variable, falling back to def when unset or invalid
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return def
+	}
+	return value
 }
@@ -5,9 +5,25 @@ import (
 	"log"
 	"os"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Conn is implemented by both the pool and transactions, so a repository can run inside
+// a transaction of its caller. Begin on a transaction starts a savepoint.
+type Conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+var (
+	_ Conn = (*pgxpool.Pool)(nil)
+	_ Conn = (pgx.Tx)(nil)
+)
+
 func ConnectDB() *pgxpool.Pool {
 
 	connStr := os.Getenv("DATABASE_URL")
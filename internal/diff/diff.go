@@ -0,0 +1,278 @@
+// Package diff computes line and word differences between texts.
+package diff
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrTooDifferent is returned when two texts differ in more places than a comparison is allowed to look at
+var ErrTooDifferent = errors.New("the texts differ in too many places to compare")
+
+// Bounds of Diff, so comparing large texts costs bounded time. Memory is linear in the input either way.
+const (
+	MaxEdits = 2000       // inserted and deleted tokens
+	maxSteps = 50_000_000 // steps of the search
+)
+
+// Op is the kind of an edit
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Edit is a run of tokens that are kept, inserted or deleted
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines splits a text into lines, each keeping its line ending
+func Lines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Words splits a text into words and the whitespace between them, so joining the tokens gives back the text
+func Words(s string) []string {
+	var tokens []string
+	start := 0
+	prevSpace := false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > start && space != prevSpace {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// Diff returns the shortest edit script turning a into b, consecutive edits of the same kind merged.
+// It returns ErrTooDifferent when the texts differ by more than MaxEdits tokens.
+func Diff(a, b []string) ([]Edit, error) {
+	blocks, err := MatchWithin(a, b, MaxEdits)
+	if err != nil {
+		return nil, err
+	}
+
+	edits := []Edit{}
+	add := func(op Op, tokens []string) {
+		if len(tokens) == 0 {
+			return
+		}
+		text := strings.Join(tokens, "")
+		if n := len(edits); n > 0 && edits[n-1].Op == op {
+			edits[n-1].Text += text
+			return
+		}
+		edits = append(edits, Edit{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for _, block := range blocks {
+		add(Delete, a[i:block.A])
+		add(Insert, b[j:block.B])
+		add(Equal, a[block.A:block.A+block.Length])
+		i, j = block.A+block.Length, block.B+block.Length
+	}
+
+	return edits, nil
+}
+
+// Stats counts the inserted and deleted tokens of an edit script split with split
+func Stats(edits []Edit, split func(string) []string) (insertions, deletions int) {
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			insertions += len(split(e.Text))
+		case Delete:
+			deletions += len(split(e.Text))
+		}
+	}
+	return insertions, deletions
+}
+
+// Block is a run of Length tokens equal in a (from index A) and b (from index B)
+type Block struct {
+	A, B, Length int
+}
+
+// Match returns the blocks of a longest common subsequence of a and b, in order.
+// The last block is always the empty block at the end of both sequences.
+func Match(a, b []string) []Block {
+	blocks, _ := (&matcher{a: a, b: b, steps: -1}).match(-1)
+	return blocks
+}
+
+// MatchWithin is Match for sequences that differ by at most maxEdits tokens, it returns
+// ErrTooDifferent for sequences differing by more or taking too long to compare
+func MatchWithin(a, b []string, maxEdits int) ([]Block, error) {
+	return (&matcher{a: a, b: b, steps: maxSteps}).match(maxEdits)
+}
+
+// matcher finds a longest common subsequence with the linear space variant of Myers' O(ND)
+// algorithm: the middle snake of an optimal path splits the comparison in two halves,
+// which are compared the same way
+type matcher struct {
+	a, b   []string
+	blocks []Block
+	steps  int // steps left before giving up, -1 for no limit
+}
+
+// match compares all of a and b, maxEdits bounds the edit distance (-1 for none)
+func (m *matcher) match(maxEdits int) ([]Block, error) {
+	if err := m.compare(0, len(m.a), 0, len(m.b), maxEdits); err != nil {
+		return nil, err
+	}
+	return append(m.blocks, Block{A: len(m.a), B: len(m.b)}), nil
+}
+
+// add appends a block, joining it to the previous one when they touch
+func (m *matcher) add(a, b, length int) {
+	if length == 0 {
+		return
+	}
+	if n := len(m.blocks); n > 0 {
+		last := &m.blocks[n-1]
+		if last.A+last.Length == a && last.B+last.Length == b {
+			last.Length += length
+			return
+		}
+	}
+	m.blocks = append(m.blocks, Block{A: a, B: b, Length: length})
+}
+
+// compare appends the blocks of a[aLo:aHi] and b[bLo:bHi] in order
+func (m *matcher) compare(aLo, aHi, bLo, bHi, maxEdits int) error {
+	prefix := 0
+	for aLo+prefix < aHi && bLo+prefix < bHi && m.a[aLo+prefix] == m.b[bLo+prefix] {
+		prefix++
+	}
+	m.add(aLo, bLo, prefix)
+	aLo, bLo = aLo+prefix, bLo+prefix
+
+	suffix := 0
+	for aHi-suffix > aLo && bHi-suffix > bLo && m.a[aHi-suffix-1] == m.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	// Each token only one side has left is an edit
+	if maxEdits >= 0 && (aHi-aLo-(bHi-bLo) > maxEdits || bHi-bLo-(aHi-aLo) > maxEdits ||
+		((aLo == aHi || bLo == bHi) && aHi-aLo+bHi-bLo > maxEdits)) {
+		return ErrTooDifferent
+	}
+
+	// Only insertions or deletions are left, unless both sides still have tokens
+	if aLo < aHi && bLo < bHi {
+		x, y, u, v, err := m.middleSnake(aLo, aHi, bLo, bHi, maxEdits)
+		if err != nil {
+			return err
+		}
+		if err := m.compare(aLo, x, bLo, y, -1); err != nil {
+			return err
+		}
+		m.add(x, y, u-x)
+		if err := m.compare(u, aHi, v, bHi, -1); err != nil {
+			return err
+		}
+	}
+
+	m.add(aHi, bHi, suffix)
+	return nil
+}
+
+// middleSnake finds the snake in the middle of a shortest edit path from (aLo, bLo) to (aHi, bHi),
+// searching forward from the start and backward from the end at the same time. The snake runs
+// from (x, y) to (u, v). Both ranges must be non-empty and differ in their first and last tokens.
+func (m *matcher) middleSnake(aLo, aHi, bLo, bHi, maxEdits int) (x, y, u, v int, err error) {
+	lenA, lenB := aHi-aLo, bHi-bLo
+	delta := lenA - lenB
+	odd := delta%2 != 0
+	max := (lenA + lenB + 1) / 2
+	offset := max + 1
+	forward := make([]int, 2*max+3)  // furthest x on each diagonal from the start
+	backward := make([]int, 2*max+3) // furthest x on each diagonal from the end, counted backwards
+
+	for d := 0; d <= max; d++ {
+		if maxEdits >= 0 && 2*d-1 > maxEdits {
+			return 0, 0, 0, 0, ErrTooDifferent
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				px = forward[offset+k+1]
+			} else {
+				px = forward[offset+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < lenA && py < lenB && m.a[aLo+px] == m.b[bLo+py] {
+				px++
+				py++
+			}
+			forward[offset+k] = px
+			if m.spend(px - sx + 1) {
+				return 0, 0, 0, 0, ErrTooDifferent
+			}
+
+			// With an odd delta the paths meet after a forward step, 2d-1 edits in all
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && px+backward[offset+delta-k] >= lenA {
+				return aLo + sx, bLo + sy, aLo + px, bLo + py, nil
+			}
+		}
+
+		if maxEdits >= 0 && 2*d > maxEdits && !odd {
+			return 0, 0, 0, 0, ErrTooDifferent
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				px = backward[offset+k+1]
+			} else {
+				px = backward[offset+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < lenA && py < lenB && m.a[aHi-1-px] == m.b[bHi-1-py] {
+				px++
+				py++
+			}
+			backward[offset+k] = px
+			if m.spend(px - sx + 1) {
+				return 0, 0, 0, 0, ErrTooDifferent
+			}
+
+			// With an even delta the paths meet after a backward step, 2d edits in all
+			if !odd && delta-k >= -d && delta-k <= d && px+forward[offset+delta-k] >= lenA {
+				return aHi - px, bHi - py, aHi - sx, bHi - sy, nil
+			}
+		}
+	}
+
+	// Unreachable, the paths meet after at most lenA+lenB edits
+	return aLo, bLo, aLo, bLo, nil
+}
+
+// spend uses up steps of the search and reports whether the budget is exhausted
+func (m *matcher) spend(steps int) bool {
+	if m.steps < 0 {
+		return false
+	}
+	m.steps -= steps
+	return m.steps < 0
+}
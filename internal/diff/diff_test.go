@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []Edit
+	}{
+		{
+			name: "equal",
+			a:    Lines("a\nb\n"),
+			b:    Lines("a\nb\n"),
+			want: []Edit{{Equal, "a\nb\n"}},
+		},
+		{
+			name: "changed line",
+			a:    Lines("a\nb\nc\n"),
+			b:    Lines("a\nx\nc\n"),
+			want: []Edit{{Equal, "a\n"}, {Delete, "b\n"}, {Insert, "x\n"}, {Equal, "c\n"}},
+		},
+		{
+			name: "inserted lines",
+			a:    Lines("a\nd\n"),
+			b:    Lines("a\nb\nc\nd\n"),
+			want: []Edit{{Equal, "a\n"}, {Insert, "b\nc\n"}, {Equal, "d\n"}},
+		},
+		{
+			name: "from empty",
+			a:    nil,
+			b:    Lines("a\n"),
+			want: []Edit{{Insert, "a\n"}},
+		},
+		{
+			name: "words",
+			a:    Words("the quick fox"),
+			b:    Words("the slow fox"),
+			want: []Edit{{Equal, "the "}, {Delete, "quick"}, {Insert, "slow"}, {Equal, " fox"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// distinctLines returns n lines no other call with a different prefix shares
+func distinctLines(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s %d\n", prefix, i)
+	}
+	return lines
+}
+
+func TestDiffEditLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    []string
+		wantErr bool
+	}{
+		{"at the limit", distinctLines("a", MaxEdits/2), distinctLines("b", MaxEdits/2), false},
+		{"over the limit", distinctLines("a", MaxEdits/2+1), distinctLines("b", MaxEdits/2), true},
+		{"inserts only over the limit", nil, distinctLines("b", MaxEdits+1), true},
+		{"large but similar", distinctLines("a", 10*MaxEdits), append(distinctLines("a", 10*MaxEdits), "end\n"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Diff(tt.a, tt.b)
+			if tt.wantErr != errors.Is(err, ErrTooDifferent) {
+				t.Errorf("Diff() error = %v, want ErrTooDifferent: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	// Joining the kept lines of both sides must give the same longest common subsequence
+	a := Lines("a\nb\nc\na\nb\nb\na\n")
+	b := Lines("c\nb\na\nb\na\nc\n")
+	var fromA, fromB strings.Builder
+	kept := 0
+	for _, blk := range Match(a, b) {
+		for i := 0; i < blk.Length; i++ {
+			fromA.WriteString(a[blk.A+i])
+			fromB.WriteString(b[blk.B+i])
+		}
+		kept += blk.Length
+	}
+	if fromA.String() != fromB.String() {
+		t.Errorf("Match() kept %q of a but %q of b", fromA.String(), fromB.String())
+	}
+	if kept != 4 {
+		t.Errorf("Match() kept %d lines, want 4", kept)
+	}
+}
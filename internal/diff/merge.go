@@ -0,0 +1,121 @@
+package diff
+
+import "strings"
+
+// Conflict markers written around the two sides of a conflicting region, like git does
+const (
+	MarkerOurs      = "<<<<<<<"
+	MarkerSeparator = "======="
+	MarkerTheirs    = ">>>>>>>"
+)
+
+// MergeResult is the outcome of a three-way merge
+type MergeResult struct {
+	Text      string // merged text, with conflict markers around conflicting regions
+	Conflicts int    // number of conflicting regions, 0 for a clean merge
+}
+
+// Merge3 merges the changes ours and theirs made to base line by line.
+// A region changed on one side only takes that change, a region changed the same way on both
+// sides is kept once, and a region changed differently on both sides is a conflict, written as
+// both versions between markers labelled with labelOurs and labelTheirs.
+// It returns ErrTooDifferent when a side differs from base by more than MaxEdits lines.
+func Merge3(base, ours, theirs, labelOurs, labelTheirs string) (MergeResult, error) {
+	b, o, t := Lines(base), Lines(ours), Lines(theirs)
+	inOurs, err := matchIndex(b, o)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	inTheirs, err := matchIndex(b, t)
+	if err != nil {
+		return MergeResult{}, err
+	}
+
+	var out strings.Builder
+	result := MergeResult{}
+
+	i, j, k := 0, 0, 0
+	for i < len(b) || j < len(o) || k < len(t) {
+		// The next base line kept by both sides ends the current region
+		p := i
+		for p < len(b) && (inOurs[p] < 0 || inTheirs[p] < 0) {
+			p++
+		}
+		nextOurs, nextTheirs := len(o), len(t)
+		if p < len(b) {
+			nextOurs, nextTheirs = inOurs[p], inTheirs[p]
+		}
+
+		if p == i && nextOurs == j && nextTheirs == k {
+			out.WriteString(b[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+
+		baseLines, ourLines, theirLines := b[i:p], o[j:nextOurs], t[k:nextTheirs]
+		switch {
+		case equalLines(ourLines, baseLines):
+			writeLines(&out, theirLines)
+		case equalLines(theirLines, baseLines), equalLines(ourLines, theirLines):
+			writeLines(&out, ourLines)
+		default:
+			result.Conflicts++
+			out.WriteString(MarkerOurs + " " + labelOurs + "\n")
+			writeLines(&out, terminate(ourLines))
+			out.WriteString(MarkerSeparator + "\n")
+			writeLines(&out, terminate(theirLines))
+			out.WriteString(MarkerTheirs + " " + labelTheirs + "\n")
+		}
+		i, j, k = p, nextOurs, nextTheirs
+	}
+
+	result.Text = out.String()
+	return result, nil
+}
+
+// matchIndex maps every token of a to the index of the token of b it is matched with, -1 when deleted
+func matchIndex(a, b []string) ([]int, error) {
+	blocks, err := MatchWithin(a, b, MaxEdits)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make([]int, len(a))
+	for i := range index {
+		index[i] = -1
+	}
+	for _, block := range blocks {
+		for n := 0; n < block.Length; n++ {
+			index[block.A+n] = block.B + n
+		}
+	}
+	return index, nil
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// terminate makes sure the last line ends with a line break, so a marker can follow it
+func terminate(lines []string) []string {
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		terminated := append([]string(nil), lines...)
+		terminated[n-1] += "\n"
+		return terminated
+	}
+	return lines
+}
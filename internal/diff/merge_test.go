@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name          string
+		base          string
+		ours, theirs  string
+		want          string
+		wantConflicts int
+	}{
+		{
+			name:   "unchanged",
+			base:   "a\nb\n",
+			ours:   "a\nb\n",
+			theirs: "a\nb\n",
+			want:   "a\nb\n",
+		},
+		{
+			name:   "different lines changed",
+			base:   "a\nb\nc\n",
+			ours:   "A\nb\nc\n",
+			theirs: "a\nb\nC\n",
+			want:   "A\nb\nC\n",
+		},
+		{
+			name:   "same change on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nB\nc\n",
+			want:   "a\nB\nc\n",
+		},
+		{
+			name:   "one side only",
+			base:   "a\nb\n",
+			ours:   "a\nb\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "conflict",
+			base:   "a\nb\nc\n",
+			ours:   "a\nours\nc\n",
+			theirs: "a\ntheirs\nc\n",
+			want: "a\n" +
+				MarkerOurs + " mine\nours\n" +
+				MarkerSeparator + "\ntheirs\n" +
+				MarkerTheirs + " other\nc\n",
+			wantConflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge3(tt.base, tt.ours, tt.theirs, "mine", "other")
+			if err != nil {
+				t.Fatalf("Merge3() error = %v", err)
+			}
+			if got.Text != tt.want || got.Conflicts != tt.wantConflicts {
+				t.Errorf("Merge3() = %q with %d conflicts, want %q with %d",
+					got.Text, got.Conflicts, tt.want, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestMerge3EditLimit(t *testing.T) {
+	base := strings.Join(distinctLines("base", MaxEdits), "")
+	rewritten := strings.Join(distinctLines("new", MaxEdits), "")
+
+	tests := []struct {
+		name         string
+		ours, theirs string
+	}{
+		{"ours over the limit", rewritten, base},
+		{"theirs over the limit", base, rewritten},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Merge3(base, tt.ours, tt.theirs, "mine", "other"); !errors.Is(err, ErrTooDifferent) {
+				t.Errorf("Merge3() error = %v, want ErrTooDifferent", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package envelope validates the client-side encryption envelope shared by the vault and encrypted notes:
+// an AES-256-GCM ciphertext, its 12-byte nonce and the version of the encryption scheme.
+// The server never decrypts, it only checks the envelope is well formed.
+package envelope
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Envelope limits
+const (
+	MaxCiphertextSize = 1024 * 1024 // 1 MB
+	MinCiphertextSize = 1           // At least 1 byte
+	NonceSize         = 12          // GCM standard: 96 bits = 12 bytes
+	TagSize           = 16          // GCM authentication tag appended to the ciphertext
+	MaxVersion        = 1
+)
+
+// ValidateCiphertext validates encrypted data of at most MaxCiphertextSize bytes
+func ValidateCiphertext(ciphertext []byte) error {
+	return ValidateCiphertextSize(ciphertext, MaxCiphertextSize)
+}
+
+// ValidateCiphertextSize validates encrypted data of at most max bytes, for data with a limit of its own
+func ValidateCiphertextSize(ciphertext []byte, max int) error {
+	if len(ciphertext) == 0 {
+		return fmt.Errorf("ciphertext cannot be empty")
+	}
+
+	if len(ciphertext) < MinCiphertextSize {
+		return fmt.Errorf("ciphertext must be at least %d byte(s), got %d", MinCiphertextSize, len(ciphertext))
+	}
+
+	if len(ciphertext) > max {
+		return fmt.Errorf("ciphertext must not exceed %d bytes, got %d bytes", max, len(ciphertext))
+	}
+
+	return nil
+}
+
+// ValidateNonce validates the encryption nonce (GCM expects exactly 12 bytes)
+func ValidateNonce(nonce []byte) error {
+	if len(nonce) == 0 {
+		return fmt.Errorf("nonce cannot be empty")
+	}
+
+	if len(nonce) != NonceSize {
+		return fmt.Errorf("nonce must be exactly %d bytes for AES-GCM, got %d bytes", NonceSize, len(nonce))
+	}
+
+	return nil
+}
+
+// ValidateVersion validates the encryption version for future compatibility
+func ValidateVersion(version int) error {
+	if version <= 0 {
+		return fmt.Errorf("encryption version must be greater than 0, got %d", version)
+	}
+
+	if version > MaxVersion {
+		return fmt.Errorf("unsupported encryption version %d (current supported: %d)", version, MaxVersion)
+	}
+
+	return nil
+}
+
+// Bytes is binary data encoded in JSON as unpadded standard base64, like the vault API.
+// Padded base64 is accepted as well.
+type Bytes []byte
+
+// MarshalJSON encodes the bytes as unpadded base64, nil as null
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	if b == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(base64.RawStdEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes padded or unpadded base64, null leaves the bytes nil
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*b = nil
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64: %w", err)
+	}
+	*b = decoded
+	return nil
+}
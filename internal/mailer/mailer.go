@@ -0,0 +1,80 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/subrat-dwi/shubserver/internal/config"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// New returns an SMTP mailer if SMTP is configured, otherwise a mailer that only logs
+func New(cfg *config.Config) Mailer {
+	if cfg.SMTPHost == "" {
+		return &LogMailer{}
+	}
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		host:     cfg.SMTPHost,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.SMTPFrom,
+	}
+}
+
+// ------ SMTP Mailer ------
+
+// SMTPMailer delivers emails through an SMTP relay
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// Send delivers a plain-text email to a single recipient
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	// Reject header injection through the recipient or subject
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	// net/smtp has no context support, so honour cancellation before dialing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, auth, m.from, []string{to}, []byte(msg))
+}
+
+// ------ Log Mailer ------
+
+// LogMailer writes emails to the server log, used when SMTP is not configured
+type LogMailer struct{}
+
+// Send logs the email instead of delivering it
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("mailer: to=%s subject=%q\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package markdown renders note content (CommonMark with GitHub extensions) to sanitized HTML.
+package markdown
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// WordsPerMinute is the reading speed used for reading time estimates
+const WordsPerMinute = 200
+
+// Heading is an entry of the table of contents
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"` // anchor of the heading in the rendered HTML
+}
+
+// Document is rendered Markdown with the metadata derived from it
+type Document struct {
+	HTML        string
+	TOC         []Heading
+	WordCount   int
+	ReadingTime int // minutes, rounded up
+}
+
+// md parses CommonMark with tables, strikethrough, autolinks, task lists and footnotes.
+// Raw HTML in the source is dropped by the renderer.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// policy is the allowlist the rendered HTML is filtered through
+var policy = newPolicy()
+
+// newPolicy extends the user generated content policy with what task lists, footnotes and heading anchors need
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_:-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6", "li", "sup")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(footnotes|footnote-ref|footnote-backref)$`)).OnElements("a", "div")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(endnotes|noteref|backlink)$`)).OnElements("a", "div")
+
+	p.AllowElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	return p
+}
+
+// Render converts Markdown to sanitized HTML and derives its table of contents, word count and reading time
+func Render(source string) (*Document, error) {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src))
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, doc); err != nil {
+		return nil, err
+	}
+
+	words := len(strings.Fields(plainText(doc, src)))
+
+	return &Document{
+		HTML:        policy.Sanitize(buf.String()),
+		TOC:         tableOfContents(doc, src),
+		WordCount:   words,
+		ReadingTime: int(math.Ceil(float64(words) / WordsPerMinute)),
+	}, nil
+}
+
+// Sanitize filters HTML through the same allowlist as rendered Markdown
+func Sanitize(html string) string {
+	return policy.Sanitize(html)
+}
+
+// tableOfContents lists the headings of a document in order
+func tableOfContents(doc ast.Node, src []byte) []Heading {
+	toc := []Heading{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+
+		var id string
+		if value, ok := heading.AttributeString("id"); ok {
+			if b, ok := value.([]byte); ok {
+				id = string(b)
+			}
+		}
+
+		toc = append(toc, Heading{
+			Level: heading.Level,
+			Text:  strings.TrimSpace(plainText(heading, src)),
+			ID:    id,
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// plainText collects the text of a node and its descendants, including code
+func plainText(node ast.Node, src []byte) string {
+	var b strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(src))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte('\n')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				b.Write(segment.Value(src))
+			}
+		}
+
+		// Separate blocks so words don't run together
+		if n.Type() == ast.TypeBlock {
+			b.WriteByte('\n')
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
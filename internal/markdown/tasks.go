@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Task is an item of a Markdown task list, with one level of subtasks
+type Task struct {
+	Text     string
+	Checked  bool
+	Subtasks []Task
+}
+
+// taskLine matches a task list item: indentation, box and text
+var taskLine = regexp.MustCompile(`^([ \t]*)[-*+] \[([ xX])\](?:[ \t]+(.*))?$`)
+
+// TaskList writes tasks as a GitHub task list, subtasks indented below their task
+func TaskList(tasks []Task) string {
+	var b strings.Builder
+	for _, t := range tasks {
+		writeTask(&b, "", t)
+		for _, sub := range t.Subtasks {
+			writeTask(&b, "  ", sub)
+		}
+	}
+	return b.String()
+}
+
+func writeTask(b *strings.Builder, indent string, t Task) {
+	box := "[ ]"
+	if t.Checked {
+		box = "[x]"
+	}
+	b.WriteString(indent + "- " + box + " " + strings.Join(strings.Fields(t.Text), " ") + "\n")
+}
+
+// SplitTaskList splits the task list that ends source from the text before it, trailing
+// blank lines aside. Indented items are subtasks of the item above them, deeper levels
+// are flattened into one. tasks is empty when source doesn't end with a task list.
+func SplitTaskList(source string) (string, []Task) {
+	lines := strings.Split(strings.TrimRight(source, "\n"), "\n")
+
+	start := len(lines)
+	for start > 0 && taskLine.MatchString(lines[start-1]) {
+		start--
+	}
+	if start == len(lines) {
+		return source, nil
+	}
+
+	tasks := []Task{}
+	for _, line := range lines[start:] {
+		m := taskLine.FindStringSubmatch(line)
+		t := Task{Text: strings.TrimSpace(m[3]), Checked: m[2] != " "}
+		if t.Text == "" {
+			continue
+		}
+		if m[1] != "" && len(tasks) > 0 {
+			last := &tasks[len(tasks)-1]
+			last.Subtasks = append(last.Subtasks, t)
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+
+	return strings.TrimRight(strings.Join(lines[:start], "\n"), "\n"), tasks
+}
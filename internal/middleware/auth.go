@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/subrat-dwi/shubserver/internal/auth"
@@ -11,9 +13,30 @@ import (
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// ClientCertAuth already authenticated the request for its route group. Routes behind
+		// AuthMiddleware act as a user, which service principals don't have.
+		if authenticatedByCert(r.Context()) {
+			if principal, _ := r.Context().Value("principal").(*Principal); principal.UserID == uuid.Nil {
+				http.Error(w, "Service Principal Has No User", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Extract the token from the Authorization header
 		header := r.Header.Get("Authorization")
 		if header == "" {
+			// Machine clients may authenticate with a client certificate mapped to a user instead,
+			// issued when the certificate became valid: a revocation rejects certificates issued before it
+			if principal := clientCertPrincipal(r); principal != nil && principal.UserID != uuid.Nil {
+				if !checkSession(w, r, principal.UserID, r.TLS.PeerCertificates[0].NotBefore) {
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
+				return
+			}
+
 			http.Error(w, "Missing Authorization Header", http.StatusUnauthorized)
 			return
 		}
@@ -45,8 +68,40 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Add userID to the request context
+		// Reject tokens of revoked sessions or accounts locked for a password change
+		if claims.IssuedAt != nil && !checkSession(w, r, userID, claims.IssuedAt.Time) {
+			return
+		}
+
+		// A client certificate required for the route group must belong to the same user
+		if principal, ok := r.Context().Value("principal").(*Principal); ok &&
+			principal.UserID != uuid.Nil && principal.UserID != userID {
+			http.Error(w, "Client Certificate Does Not Match User", http.StatusForbidden)
+			return
+		}
+
+		// Add userID and authentication time to the request context
 		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx = context.WithValue(ctx, "authTime", claims.AuthenticatedAt())
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// checkSession rejects credentials of a revoked session, issued at issuedAt, or of an account
+// locked for a password change. It writes the error response and returns false when rejected.
+func checkSession(w http.ResponseWriter, r *http.Request, userID uuid.UUID, issuedAt time.Time) bool {
+	if sessionChecker == nil {
+		return true
+	}
+
+	err := sessionChecker.CheckSession(r.Context(), userID, issuedAt)
+	if errors.Is(err, auth.ErrPasswordChangeRequired) {
+		http.Error(w, "Password Change Required", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Session Revoked", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
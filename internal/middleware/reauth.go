@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/subrat-dwi/shubserver/internal/auth"
+)
+
+// RequireRecentAuth only lets the request through if the user presented credentials
+// within auth.ReauthWindow. Must be used after AuthMiddleware.
+func RequireRecentAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsRecentlyAuthenticated(r.Context()) {
+			w.Header().Set("WWW-Authenticate", auth.ReauthChallenge)
+			http.Error(w, "Recent Authentication Required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
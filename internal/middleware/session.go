@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionChecker confirms that a verified token still belongs to a live session,
+// e.g. that it was not revoked by a password change
+type SessionChecker interface {
+	CheckSession(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error
+}
+
+// sessionChecker is consulted by AuthMiddleware after the token signature is verified
+var sessionChecker SessionChecker
+
+// SetSessionChecker registers the checker used by AuthMiddleware, set once at startup
+func SetSessionChecker(c SessionChecker) {
+	sessionChecker = c
+}
@@ -0,0 +1,212 @@
+package notebooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// MaxNameLength matches the notebook_name_max_length constraint
+const MaxNameLength = 255
+
+// Handler struct for notebooks
+type NotebooksHandler struct {
+	repo NotebooksRepository
+}
+
+// Constructor for handler
+func NewNotebooksHandler(repo NotebooksRepository) *NotebooksHandler {
+	return &NotebooksHandler{repo: repo}
+}
+
+// Request struct for creating a notebook
+type CreateNotebookRequest struct {
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parentId"` // omitted or null for a top-level notebook
+}
+
+// Request struct for renaming a notebook
+type RenameNotebookRequest struct {
+	Name string `json:"name"`
+}
+
+// Request struct for moving or reordering a notebook
+type MoveNotebookRequest struct {
+	ParentID *uuid.UUID `json:"parentId"` // null moves it to the top level
+	Position *int       `json:"position"` // omitted appends it after its new siblings
+}
+
+// validateName trims a notebook name and checks its length
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", utils.NewValidationError("name is required")
+	}
+	if len(name) > MaxNameLength {
+		return "", utils.NewValidationError("name must be less than 255 characters")
+	}
+	return name, nil
+}
+
+// notebookError writes the response for a repository error
+func notebookError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, ErrNotebookNotFound):
+		utils.Error(w, http.StatusNotFound, "notebook not found")
+	case errors.Is(err, ErrNotebookCycle):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, message)
+	}
+}
+
+// NotebooksHandler to list the notebook tree of the user
+func (h *NotebooksHandler) listNotebooks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	tree, err := h.repo.Tree(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access notebooks")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"notebooks": tree,
+	})
+}
+
+// NotebooksHandler to get a notebook with its subtree and note counts
+func (h *NotebooksHandler) getNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid notebook ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	notebook, err := h.repo.Subtree(r.Context(), userID, id)
+	if err != nil {
+		notebookError(w, err, "can't access notebook")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, notebook)
+}
+
+// NotebooksHandler to create a notebook
+func (h *NotebooksHandler) createNotebook(w http.ResponseWriter, r *http.Request) {
+	var req CreateNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	name, err := validateName(req.Name)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	notebook, err := h.repo.Create(r.Context(), userID, name, req.ParentID)
+	if err != nil {
+		notebookError(w, err, "failed to create notebook")
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, notebook)
+}
+
+// NotebooksHandler to rename a notebook
+func (h *NotebooksHandler) renameNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid notebook ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req RenameNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	name, err := validateName(req.Name)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.repo.Rename(r.Context(), userID, id, name); err != nil {
+		notebookError(w, err, "failed to update")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "notebook renamed successfully",
+	})
+}
+
+// NotebooksHandler to move a notebook to another parent and/or position
+func (h *NotebooksHandler) moveNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid notebook ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req MoveNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Position != nil && *req.Position < 0 {
+		utils.Error(w, http.StatusBadRequest, "position cannot be negative")
+		return
+	}
+
+	if err := h.repo.Move(r.Context(), userID, id, req.ParentID, req.Position); err != nil {
+		notebookError(w, err, "failed to move notebook")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "notebook moved successfully",
+	})
+}
+
+// NotebooksHandler to delete a notebook, ?notes= chooses what happens to its contents
+func (h *NotebooksHandler) deleteNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid notebook ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	policy := r.URL.Query().Get("notes")
+	switch policy {
+	case "":
+		policy = DeleteMoveToParent
+	case DeleteMoveToParent, DeleteCascade:
+	default:
+		utils.Error(w, http.StatusBadRequest, "notes must be move_to_parent or cascade")
+		return
+	}
+
+	if err := h.repo.Delete(r.Context(), userID, id, policy); err != nil {
+		notebookError(w, err, "cannot delete notebook")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "notebook deleted successfully",
+	})
+}
@@ -0,0 +1,61 @@
+package notebooks
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Notebook struct {
+	ID             uuid.UUID   `json:"id"`
+	ParentID       *uuid.UUID  `json:"parentId"`
+	Name           string      `json:"name"`
+	Position       int         `json:"position"`
+	NoteCount      int         `json:"noteCount"`      // notes directly in this notebook
+	TotalNoteCount int         `json:"totalNoteCount"` // notes in this notebook and all its descendants
+	Children       []*Notebook `json:"children"`
+	CreatedAt      time.Time   `json:"createdAt"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+}
+
+// What happens to the contents of a deleted notebook
+const (
+	DeleteMoveToParent = "move_to_parent" // notes and child notebooks move to the parent, or to the top level
+	DeleteCascade      = "cascade"        // child notebooks are deleted and every note in the subtree is trashed
+)
+
+// buildTree links a flat list of notebooks into trees, ordered by position,
+// and fills in the total note counts. It returns the notebooks whose parent is not in the list.
+func buildTree(list []*Notebook) []*Notebook {
+	byID := make(map[uuid.UUID]*Notebook, len(list))
+	for _, nb := range list {
+		nb.Children = []*Notebook{}
+		byID[nb.ID] = nb
+	}
+
+	roots := []*Notebook{}
+	for _, nb := range list {
+		if nb.ParentID != nil {
+			if parent, ok := byID[*nb.ParentID]; ok {
+				parent.Children = append(parent.Children, nb)
+				continue
+			}
+		}
+		roots = append(roots, nb)
+	}
+
+	for _, root := range roots {
+		sumNoteCounts(root)
+	}
+
+	return roots
+}
+
+// sumNoteCounts sets TotalNoteCount on a notebook and its descendants
+func sumNoteCounts(nb *Notebook) int {
+	nb.TotalNoteCount = nb.NoteCount
+	for _, child := range nb.Children {
+		nb.TotalNoteCount += sumNoteCounts(child)
+	}
+	return nb.TotalNoteCount
+}
@@ -0,0 +1,338 @@
+package notebooks
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errors returned by the notebooks repository
+var (
+	ErrNotebookNotFound = errors.New("notebook not found")
+	ErrNotebookCycle    = errors.New("a notebook cannot be moved into itself or one of its descendants")
+)
+
+// Repository Interface
+type NotebooksRepository interface {
+	Create(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*Notebook, error)
+	Tree(ctx context.Context, userID uuid.UUID) ([]*Notebook, error)
+	Subtree(ctx context.Context, userID, id uuid.UUID) (*Notebook, error)
+	Rename(ctx context.Context, userID, id uuid.UUID, name string) error
+	Move(ctx context.Context, userID, id uuid.UUID, parentID *uuid.UUID, position *int) error
+	Delete(ctx context.Context, userID, id uuid.UUID, policy string) error
+}
+
+// Postgres Repository
+type NotebooksPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewNotebooksPostgresRepository(db *pgxpool.Pool) *NotebooksPostgresRepository {
+	return &NotebooksPostgresRepository{db: db}
+}
+
+// notebookColumns is the column list selected for a Notebook, including its direct note count without trashed notes
+const notebookColumns = `id, parent_id, name, position, created_at, updated_at,
+	(SELECT COUNT(*) FROM notes WHERE notes.notebook_id = notebooks.id AND notes.deleted_at IS NULL)`
+
+// subtreeIDs selects the ids of a notebook ($1) of a user ($2) and all its descendants
+const subtreeIDs = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM notebooks WHERE id = $1 AND user_id = $2
+		UNION ALL
+		SELECT c.id FROM notebooks c JOIN subtree s ON c.parent_id = s.id
+	)
+	SELECT id FROM subtree`
+
+// scanNotebooks scans rows selected with notebookColumns
+func scanNotebooks(rows pgx.Rows) ([]*Notebook, error) {
+	defer rows.Close()
+
+	list := []*Notebook{}
+	for rows.Next() {
+		var nb Notebook
+		err := rows.Scan(&nb.ID, &nb.ParentID, &nb.Name, &nb.Position, &nb.CreatedAt, &nb.UpdatedAt, &nb.NoteCount)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &nb)
+	}
+
+	return list, rows.Err()
+}
+
+// lockTree serializes changes to the notebook hierarchy of a user, so concurrent moves can't create a cycle
+func lockTree(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('notebooks:' || $1::text))`, userID)
+	return err
+}
+
+// checkOwned returns ErrNotebookNotFound unless the notebook exists and belongs to the user
+func checkOwned(ctx context.Context, tx pgx.Tx, userID, id uuid.UUID) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM notebooks WHERE id = $1 AND user_id = $2)`, id, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotebookNotFound
+	}
+	return nil
+}
+
+// Create a notebook at the end of its parent's children, or of the top level when parentID is nil
+func (p *NotebooksPostgresRepository) Create(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*Notebook, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTree(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if err := checkOwned(ctx, tx, userID, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+	INSERT INTO notebooks(user_id, parent_id, name, position)
+	VALUES ($1, $2, $3, (
+		SELECT COUNT(*) FROM notebooks WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2
+	))
+	RETURNING id, position, created_at, updated_at
+	`
+
+	nb := Notebook{ParentID: parentID, Name: name, Children: []*Notebook{}}
+	err = tx.QueryRow(ctx, query, userID, parentID, name).Scan(&nb.ID, &nb.Position, &nb.CreatedAt, &nb.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nb, tx.Commit(ctx)
+}
+
+// Tree returns all notebooks of a user as a forest of top-level notebooks
+func (p *NotebooksPostgresRepository) Tree(ctx context.Context, userID uuid.UUID) ([]*Notebook, error) {
+	query := `
+	SELECT ` + notebookColumns + `
+	FROM notebooks
+	WHERE user_id = $1
+	ORDER BY position, name, id
+	`
+
+	rows, err := p.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := scanNotebooks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildTree(list), nil
+}
+
+// Subtree returns a notebook with all its descendants and note counts
+func (p *NotebooksPostgresRepository) Subtree(ctx context.Context, userID, id uuid.UUID) (*Notebook, error) {
+	query := `
+	SELECT ` + notebookColumns + `
+	FROM notebooks
+	WHERE id IN (` + subtreeIDs + `)
+	ORDER BY position, name, id
+	`
+
+	rows, err := p.db.Query(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := scanNotebooks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, root := range buildTree(list) {
+		if root.ID == id {
+			return root, nil
+		}
+	}
+
+	return nil, ErrNotebookNotFound
+}
+
+// Rename a notebook
+func (p *NotebooksPostgresRepository) Rename(ctx context.Context, userID, id uuid.UUID, name string) error {
+	query := `
+	UPDATE notebooks
+	SET name = $3, updated_at = NOW()
+	WHERE id = $1 AND user_id = $2
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, userID, name)
+	if err != nil {
+		return err
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return ErrNotebookNotFound
+	}
+
+	return nil
+}
+
+// Move a notebook under a new parent (nil for the top level) at the given position among its new siblings.
+// A nil position appends it; moving within the same parent reorders it.
+func (p *NotebooksPostgresRepository) Move(ctx context.Context, userID, id uuid.UUID, parentID *uuid.UUID, position *int) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	var oldParent *uuid.UUID
+	var oldPosition int
+	err = tx.QueryRow(ctx, `SELECT parent_id, position FROM notebooks WHERE id = $1 AND user_id = $2`, id, userID).Scan(&oldParent, &oldPosition)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotebookNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if parentID != nil {
+		if err := checkOwned(ctx, tx, userID, *parentID); err != nil {
+			return err
+		}
+
+		// The new parent must not be the notebook itself or one of its descendants
+		var cycle bool
+		err := tx.QueryRow(ctx, `SELECT $3 IN (`+subtreeIDs+`)`, id, userID, *parentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrNotebookCycle
+		}
+	}
+
+	// Close the gap left among the old siblings
+	_, err = tx.Exec(ctx, `
+	UPDATE notebooks SET position = position - 1
+	WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND position > $3
+	`, userID, oldParent, oldPosition)
+	if err != nil {
+		return err
+	}
+
+	var siblings int
+	err = tx.QueryRow(ctx, `
+	SELECT COUNT(*) FROM notebooks
+	WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND id != $3
+	`, userID, parentID, id).Scan(&siblings)
+	if err != nil {
+		return err
+	}
+
+	target := siblings
+	if position != nil && *position < siblings {
+		target = max(*position, 0)
+	}
+
+	// Open a gap among the new siblings
+	_, err = tx.Exec(ctx, `
+	UPDATE notebooks SET position = position + 1
+	WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND id != $3 AND position >= $4
+	`, userID, parentID, id, target)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE notebooks SET parent_id = $2, position = $3, updated_at = NOW()
+	WHERE id = $1
+	`, id, parentID, target)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Delete a notebook. With DeleteMoveToParent its notes and child notebooks move to its parent,
+// with DeleteCascade the whole subtree is deleted and its notes are moved to the trash.
+func (p *NotebooksPostgresRepository) Delete(ctx context.Context, userID, id uuid.UUID, policy string) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	var parentID *uuid.UUID
+	var position int
+	err = tx.QueryRow(ctx, `SELECT parent_id, position FROM notebooks WHERE id = $1 AND user_id = $2`, id, userID).Scan(&parentID, &position)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotebookNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case DeleteCascade:
+		_, err = tx.Exec(ctx, `
+		UPDATE notes SET deleted_at = NOW()
+		WHERE user_id = $2 AND deleted_at IS NULL AND notebook_id IN (`+subtreeIDs+`)
+		`, id, userID)
+		if err != nil {
+			return err
+		}
+
+	default:
+		_, err = tx.Exec(ctx, `UPDATE notes SET notebook_id = $2 WHERE notebook_id = $1`, id, parentID)
+		if err != nil {
+			return err
+		}
+
+		// Children are appended after the existing siblings, keeping their order
+		_, err = tx.Exec(ctx, `
+		UPDATE notebooks SET parent_id = $3, position = position + (
+			SELECT COUNT(*) FROM notebooks WHERE user_id = $2 AND parent_id IS NOT DISTINCT FROM $3
+		), updated_at = NOW()
+		WHERE parent_id = $1
+		`, id, userID, parentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Child notebooks still attached are removed by the parent_id cascade
+	if _, err := tx.Exec(ctx, `DELETE FROM notebooks WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE notebooks SET position = position - 1
+	WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND position > $3
+	`, userID, parentID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
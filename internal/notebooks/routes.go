@@ -0,0 +1,21 @@
+package notebooks
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the routes for the notebooks module
+func Routes(h *NotebooksHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.listNotebooks)
+	r.Post("/", h.createNotebook)
+	r.Get("/{id}", h.getNotebook)
+	r.Patch("/{id}", h.renameNotebook)
+	r.Post("/{id}/move", h.moveNotebook)
+	r.Delete("/{id}", h.deleteNotebook)
+
+	return r
+}
@@ -0,0 +1,572 @@
+package notes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+	"github.com/subrat-dwi/shubserver/internal/notebooks"
+	"gopkg.in/yaml.v3"
+)
+
+// Limits of an imported archive
+const (
+	MaxImportBytes     = 64 << 20  // size of the uploaded zip
+	MaxImportFiles     = 10000     // files in the zip
+	importFileOverhead = 256 << 10 // room for the front matter, task list or JSON around the content of one file
+)
+
+// maxImportFileBytes is the size of one imported file, enough for a note at the content limit
+func (h *NotesHandler) maxImportFileBytes() int {
+	return h.maxContent + importFileOverhead
+}
+
+// ImportedNote is a note created or updated by an import
+type ImportedNote struct {
+	ID   uuid.UUID `json:"id"`
+	Path string    `json:"path"`
+}
+
+// SkippedFile is a file of an archive an import left alone
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ImportReport lists what an import did with every note of the archive or export.
+// Warnings name the parts of imported notes that could not be converted, like attachments.
+type ImportReport struct {
+	Created  []ImportedNote `json:"created"`
+	Updated  []ImportedNote `json:"updated"`
+	Skipped  []SkippedFile  `json:"skipped"`
+	Warnings []SkippedFile  `json:"warnings,omitempty"`
+}
+
+// frontMatter is the YAML header of an exported note
+type frontMatter struct {
+	ID       string     `yaml:"id,omitempty"`
+	Title    string     `yaml:"title,omitempty"`
+	Created  *time.Time `yaml:"created,omitempty"`
+	Updated  *time.Time `yaml:"updated,omitempty"`
+	Tags     tagList    `yaml:"tags,omitempty"`
+	Language string     `yaml:"language,omitempty"`
+	Pinned   bool       `yaml:"pinned,omitempty"`
+	Favorite bool       `yaml:"favorite,omitempty"`
+	Archived bool       `yaml:"archived,omitempty"`
+
+	// Checklist says the task list ending the body is the checklist of the note, not part of its content
+	Checklist bool `yaml:"checklist,omitempty"`
+
+	// Encrypted notes keep their envelope, base64 encoded, and have no body
+	Encrypted       bool   `yaml:"encrypted,omitempty"`
+	Ciphertext      string `yaml:"ciphertext,omitempty"`
+	Nonce           string `yaml:"nonce,omitempty"`
+	TitleCiphertext string `yaml:"title_ciphertext,omitempty"`
+	TitleNonce      string `yaml:"title_nonce,omitempty"`
+	EncryptVersion  int    `yaml:"encrypt_version,omitempty"`
+}
+
+// tagList reads tags written as a list or, like Obsidian allows, as one comma or space separated string
+type tagList []string
+
+func (t *tagList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = strings.FieldsFunc(value.Value, func(r rune) bool { return r == ',' || r == ' ' })
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// markdownFile returns a note as Markdown with YAML front matter, its checklist as a task list after the content
+func markdownFile(n *Note, checklist *Checklist) ([]byte, error) {
+	fm := frontMatter{
+		ID:       n.ID.String(),
+		Title:    n.Title,
+		Created:  &n.CreatedAt,
+		Updated:  &n.UpdatedAt,
+		Tags:     n.Tags,
+		Language: n.Language,
+		Pinned:   n.Pinned,
+		Favorite: n.Favorite,
+		Archived: n.Archived,
+	}
+	content := n.Content
+	if checklist != nil && checklist.Total > 0 {
+		fm.Checklist = true
+		content = withChecklist(n.Content, checklist)
+	}
+	if n.Encrypted {
+		fm.Encrypted = true
+		fm.Ciphertext = base64.RawStdEncoding.EncodeToString(n.Ciphertext)
+		fm.Nonce = base64.RawStdEncoding.EncodeToString(n.Nonce)
+		if n.TitleCiphertext != nil {
+			fm.TitleCiphertext = base64.RawStdEncoding.EncodeToString(n.TitleCiphertext)
+			fm.TitleNonce = base64.RawStdEncoding.EncodeToString(n.TitleNonce)
+		}
+		fm.EncryptVersion = n.EncryptVersion
+	}
+
+	header, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(header)
+	buf.WriteString("---\n\n")
+	buf.WriteString(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// parseMarkdownFile splits a Markdown file into its front matter and body.
+// Files without front matter, like most Obsidian notes, are all body.
+func parseMarkdownFile(data []byte) (*frontMatter, string, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	fm := &frontMatter{}
+	if !strings.HasPrefix(text, "---\n") {
+		return fm, text, nil
+	}
+
+	rest := text[len("---\n"):]
+	end := strings.Index(rest, "\n---\n")
+	header, body := "", ""
+	switch {
+	case strings.HasPrefix(rest, "---\n"):
+		body = rest[len("---\n"):]
+	case end >= 0:
+		header, body = rest[:end], rest[end+len("\n---\n"):]
+	case strings.HasSuffix(rest, "\n---"):
+		header = strings.TrimSuffix(rest, "\n---")
+	default:
+		return fm, text, nil
+	}
+
+	if err := yaml.Unmarshal([]byte(header), fm); err != nil {
+		return nil, "", errors.New("invalid front matter")
+	}
+	return fm, strings.TrimPrefix(body, "\n"), nil
+}
+
+// splitChecklist splits the checklist from the body of a file whose front matter says it has one
+func splitChecklist(fm *frontMatter, body string) (string, []markdown.Task) {
+	if !fm.Checklist || fm.Encrypted {
+		return body, nil
+	}
+	return splitTaskList(body)
+}
+
+// noteFromFile builds the note an archive file describes, titled after the file when the front matter has no title
+func noteFromFile(name string, fm *frontMatter, body string) (*Note, error) {
+	content, _ := splitChecklist(fm, body)
+	n := &Note{
+		Title:    fm.Title,
+		Content:  content,
+		Tags:     fm.Tags,
+		Language: fm.Language,
+	}
+	if n.Title == "" {
+		n.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	if n.Tags == nil {
+		n.Tags = []string{}
+	}
+
+	if fm.Encrypted {
+		n.Encrypted = true
+		n.Content = ""
+		n.EncryptVersion = fm.EncryptVersion
+		fields := []struct {
+			value string
+			dest  *[]byte
+		}{
+			{fm.Ciphertext, (*[]byte)(&n.Ciphertext)},
+			{fm.Nonce, (*[]byte)(&n.Nonce)},
+			{fm.TitleCiphertext, (*[]byte)(&n.TitleCiphertext)},
+			{fm.TitleNonce, (*[]byte)(&n.TitleNonce)},
+		}
+		for _, f := range fields {
+			if f.value == "" {
+				continue
+			}
+			decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(f.value, "="))
+			if err != nil {
+				return nil, errors.New("invalid base64 in the encryption envelope")
+			}
+			*f.dest = decoded
+		}
+		if n.TitleCiphertext != nil {
+			n.Title = fm.Title
+		}
+	}
+
+	return n, nil
+}
+
+// archiveWriter writes notes into a zip, in folders named after their notebooks
+type archiveWriter struct {
+	zip     *zip.Writer
+	folders map[uuid.UUID]string // notebook ID to folder path
+	used    map[string]bool      // file paths already written, in lower case
+}
+
+func newArchiveWriter(w io.Writer, tree []*notebooks.Notebook) *archiveWriter {
+	return &archiveWriter{zip: zip.NewWriter(w), folders: notebookFolders(tree, ""), used: map[string]bool{}}
+}
+
+// notebookFolders maps every notebook of a tree to its folder path
+func notebookFolders(tree []*notebooks.Notebook, parent string) map[uuid.UUID]string {
+	folders := map[uuid.UUID]string{}
+	used := map[string]bool{}
+	for _, nb := range tree {
+		name := uniqueName(safeFileName(nb.Name, "Notebook"), "", used)
+		folder := path.Join(parent, name)
+		folders[nb.ID] = folder
+		for id, child := range notebookFolders(nb.Children, folder) {
+			folders[id] = child
+		}
+	}
+	return folders
+}
+
+// add writes a note and its checklist as a Markdown file
+func (a *archiveWriter) add(n *Note, checklist *Checklist) error {
+	data, err := markdownFile(n, checklist)
+	if err != nil {
+		return err
+	}
+
+	name := n.Title
+	if n.TitleCiphertext != nil || name == "" {
+		name = "Encrypted note " + n.ID.String()[:8]
+	}
+	folder := ""
+	if n.NotebookID != nil {
+		folder = a.folders[*n.NotebookID]
+	}
+	file := path.Join(folder, uniqueName(safeFileName(name, "Untitled"), folder, a.used)+".md")
+
+	w, err := a.zip.CreateHeader(&zip.FileHeader{Name: file, Method: zip.Deflate, Modified: n.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (a *archiveWriter) Close() error {
+	return a.zip.Close()
+}
+
+// safeFileName makes a title usable as a file name on every common file system
+func safeFileName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if len(name) > 100 {
+		name = strings.ToValidUTF8(name[:100], "")
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// uniqueName numbers a name that is already used in the folder, ignoring case
+func uniqueName(name, folder string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[strings.ToLower(path.Join(folder, candidate))]; i++ {
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+	used[strings.ToLower(path.Join(folder, candidate))] = true
+	return candidate
+}
+
+// importPath cleans the path of a zip entry, ok is false for entries an import ignores:
+// directories and hidden files like .obsidian/
+func importPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasSuffix(name, "/") {
+		return "", false
+	}
+	clean := path.Clean("/" + name)[1:]
+	if clean == "" {
+		return "", false
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return "", false
+		}
+	}
+	return clean, true
+}
+
+// readImportFile reads an entry of an archive, refusing files over limit bytes
+func readImportFile(f *zip.File, limit int) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, errors.New("file is too large")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, errors.New("file is too large")
+	}
+	return data, nil
+}
+
+// importer imports the Markdown files of an archive for one user
+type importer struct {
+	h       *NotesHandler
+	userID  uuid.UUID
+	folders map[string]uuid.UUID // lower case folder path to notebook ID
+	report  *ImportReport
+}
+
+func newImporter(h *NotesHandler, userID uuid.UUID, tree []*notebooks.Notebook) *importer {
+	im := &importer{
+		h:       h,
+		userID:  userID,
+		folders: map[string]uuid.UUID{},
+		report:  &ImportReport{Created: []ImportedNote{}, Updated: []ImportedNote{}, Skipped: []SkippedFile{}},
+	}
+	for id, folder := range notebookFolders(tree, "") {
+		im.folders[strings.ToLower(folder)] = id
+	}
+	return im
+}
+
+func (im *importer) skip(name, reason string) {
+	im.report.Skipped = append(im.report.Skipped, SkippedFile{Path: name, Reason: reason})
+}
+
+// importFile creates or updates the note of one archive entry. A note keeps the ID in its front matter;
+// an existing note of the user with that ID is updated unless it changed after the export.
+func (im *importer) importFile(ctx context.Context, f *zip.File) error {
+	name, ok := importPath(f.Name)
+	if !ok {
+		return nil
+	}
+	if ext := strings.ToLower(path.Ext(name)); ext != ".md" && ext != ".markdown" {
+		im.skip(name, "not a Markdown file")
+		return nil
+	}
+
+	data, err := readImportFile(f, im.h.maxImportFileBytes())
+	if err != nil {
+		im.skip(name, err.Error())
+		return nil
+	}
+	fm, body, err := parseMarkdownFile(data)
+	if err != nil {
+		im.skip(name, err.Error())
+		return nil
+	}
+	note, ok := im.prepare(name, fm, body)
+	if !ok {
+		return nil
+	}
+	_, tasks := splitChecklist(fm, body)
+
+	if folder := path.Dir(name); folder != "." {
+		if note.NotebookID, err = im.notebookFor(ctx, folder); err != nil {
+			return err
+		}
+	}
+
+	if id, err := uuid.Parse(fm.ID); err == nil {
+		existing, err := im.h.repo.Get(ctx, im.userID, id.String())
+		if err == nil && existing.Permission == PermissionOwner {
+			return im.update(ctx, name, existing, note, fm, tasks)
+		}
+		note.ID = id
+	}
+
+	note.UserID = im.userID
+	created, err := im.h.repo.Create(ctx, note)
+	if errors.Is(err, ErrNoteExists) {
+		// The ID is taken by a note of another user or one in the trash
+		note.ID = uuid.Nil
+		created, err = im.h.repo.Create(ctx, note)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := im.setChecklist(ctx, created, tasks); err != nil {
+		return err
+	}
+	if err := im.setStates(ctx, created, fm); err != nil {
+		return err
+	}
+	if err := im.h.repo.SetDates(ctx, im.userID, created.ID, fm.Created, fm.Updated); err != nil {
+		return err
+	}
+	im.report.Created = append(im.report.Created, ImportedNote{ID: created.ID, Path: name})
+	return nil
+}
+
+// prepare builds and validates the note of an imported file, ok is false when the file is skipped
+func (im *importer) prepare(name string, fm *frontMatter, body string) (*Note, bool) {
+	note, err := noteFromFile(name, fm, body)
+	if err == nil {
+		note.Language, err = im.h.service.languageFor(note.Language, "")
+	}
+	if err == nil {
+		err = im.h.service.validateNote(note)
+	}
+	if err == nil {
+		note.Tags, err = normalizeTags(note.Tags)
+	}
+	if err != nil {
+		im.skip(name, err.Error())
+		return nil, false
+	}
+	return note, true
+}
+
+// update replaces an existing note and its checklist with the version of the archive
+func (im *importer) update(ctx context.Context, name string, existing, note *Note, fm *frontMatter, tasks []markdown.Task) error {
+	checklist := ""
+	if existing.ChecklistTotal > 0 {
+		current, err := im.h.repo.GetChecklist(ctx, im.userID, existing.ID)
+		if err != nil {
+			return err
+		}
+		checklist = current.Markdown()
+	}
+	if sameArchivedNote(existing, note) && checklist == markdown.TaskList(tasks) {
+		im.skip(name, "unchanged")
+		return nil
+	}
+	if fm.Updated != nil && existing.UpdatedAt.After(*fm.Updated) {
+		im.skip(name, "the note was changed after it was exported")
+		return nil
+	}
+
+	existing.Title = note.Title
+	existing.Content = note.Content
+	existing.Tags = note.Tags
+	existing.NotebookID = note.NotebookID
+	existing.Language = note.Language
+	existing.Encrypted = note.Encrypted
+	existing.Ciphertext = note.Ciphertext
+	existing.Nonce = note.Nonce
+	existing.TitleCiphertext = note.TitleCiphertext
+	existing.TitleNonce = note.TitleNonce
+	existing.EncryptVersion = note.EncryptVersion
+
+	err := im.h.repo.Update(ctx, im.userID, existing, existing.Version)
+	if errors.Is(err, ErrVersionConflict) {
+		im.skip(name, "the note was changed during the import")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := im.setChecklist(ctx, existing, tasks); err != nil {
+		return err
+	}
+	if err := im.setStates(ctx, existing, fm); err != nil {
+		return err
+	}
+	im.report.Updated = append(im.report.Updated, ImportedNote{ID: existing.ID, Path: name})
+	return nil
+}
+
+// setChecklist replaces the checklist of an imported note with the tasks of its file
+func (im *importer) setChecklist(ctx context.Context, n *Note, tasks []markdown.Task) error {
+	if n.Encrypted || (len(tasks) == 0 && n.ChecklistTotal == 0) {
+		return nil
+	}
+	return im.h.repo.ReplaceChecklist(ctx, im.userID, n.ID, tasks)
+}
+
+// setStates pins, favorites and archives an imported note as its front matter says
+func (im *importer) setStates(ctx context.Context, n *Note, fm *frontMatter) error {
+	if fm.Pinned != n.Pinned {
+		if err := im.h.repo.SetPinned(ctx, im.userID, n.ID, fm.Pinned); err != nil {
+			return err
+		}
+	}
+	if fm.Favorite != n.Favorite {
+		if err := im.h.repo.SetFavorite(ctx, im.userID, n.ID, fm.Favorite); err != nil {
+			return err
+		}
+	}
+	if fm.Archived != n.Archived {
+		if _, err := im.h.repo.SetArchived(ctx, im.userID, []uuid.UUID{n.ID}, fm.Archived); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notebookFor returns the notebook of a folder, creating the missing notebooks of its path
+func (im *importer) notebookFor(ctx context.Context, folder string) (*uuid.UUID, error) {
+	var parent *uuid.UUID
+	current := ""
+	for _, part := range strings.Split(folder, "/") {
+		current = path.Join(current, part)
+		if id, ok := im.folders[strings.ToLower(current)]; ok {
+			parent = &id
+			continue
+		}
+
+		name := part
+		if len(name) > notebooks.MaxNameLength {
+			name = strings.ToValidUTF8(name[:notebooks.MaxNameLength], "")
+		}
+		nb, err := im.h.notebooks.Create(ctx, im.userID, name, parent)
+		if err != nil {
+			return nil, err
+		}
+		im.folders[strings.ToLower(current)] = nb.ID
+		parent = &nb.ID
+	}
+	return parent, nil
+}
+
+// sameArchivedNote reports whether an imported note matches the stored one, ignoring a final line break the export adds
+func sameArchivedNote(existing, note *Note) bool {
+	sameNotebook := (existing.NotebookID == nil) == (note.NotebookID == nil) &&
+		(existing.NotebookID == nil || *existing.NotebookID == *note.NotebookID)
+
+	return existing.Title == note.Title &&
+		strings.TrimRight(existing.Content, "\n") == strings.TrimRight(note.Content, "\n") &&
+		sameTags(existing.Tags, note.Tags) && sameNotebook &&
+		existing.Encrypted == note.Encrypted &&
+		bytes.Equal(existing.Ciphertext, note.Ciphertext) &&
+		bytes.Equal(existing.TitleCiphertext, note.TitleCiphertext)
+}
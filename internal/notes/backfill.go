@@ -0,0 +1,48 @@
+package notes
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Batch size and retry delay of the link backfill
+const (
+	backfillBatch      = 100
+	BackfillRetryDelay = time.Minute
+)
+
+// LinkBackfill is the one-off job saving the wiki links of the notes written before links were stored
+type LinkBackfill struct {
+	repo *NotesPostgresRepository
+}
+
+// NewLinkBackfill creates the background link backfill job
+func NewLinkBackfill(repo *NotesPostgresRepository) *LinkBackfill {
+	return &LinkBackfill{repo: repo}
+}
+
+// Run saves the links of the queued notes until none is left or ctx is done.
+// Errors are logged and retried after BackfillRetryDelay.
+func (b *LinkBackfill) Run(ctx context.Context) {
+	total := 0
+	for {
+		done, err := b.repo.BackfillLinks(ctx, backfillBatch)
+		total += done
+		if err != nil {
+			log.Printf("notes: backfilling links: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(BackfillRetryDelay):
+			}
+			continue
+		}
+		if done == 0 {
+			if total > 0 {
+				log.Printf("notes: backfilled the links of %d notes", total)
+			}
+			return
+		}
+	}
+}
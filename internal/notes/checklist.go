@@ -0,0 +1,468 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/subrat-dwi/shubserver/internal/db"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Checklist limits
+const (
+	MaxChecklistItems      = 500
+	MaxChecklistItemLength = 1000
+)
+
+// Checklist errors
+var (
+	ErrChecklistItemNotFound = errors.New("checklist item not found")
+	ErrChecklistFull         = fmt.Errorf("checklists are limited to %d items", MaxChecklistItems)
+)
+
+// ChecklistItem is an item of the checklist of a note. Top-level items can have children,
+// nested one level.
+type ChecklistItem struct {
+	ID        uuid.UUID        `json:"id"`
+	ParentID  *uuid.UUID       `json:"parentId"`
+	Position  int              `json:"position"` // among the items with the same parent, from 0
+	Text      string           `json:"text"`
+	Checked   bool             `json:"checked"`
+	CheckedAt *time.Time       `json:"checkedAt,omitempty"`
+	Children  []*ChecklistItem `json:"children,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// Checklist is the checklist of a note in order, with how many of its items are checked
+type Checklist struct {
+	Items   []*ChecklistItem `json:"items"`
+	Done    int              `json:"done"`
+	Total   int              `json:"total"`
+	Version int64            `json:"-"` // version of the note, sent as the ETag
+}
+
+// ChecklistChange is an edit of a checklist item, nil fields are left unchanged
+type ChecklistChange struct {
+	Text    *string
+	Checked *bool
+	Toggle  bool // flips the item, Checked is ignored
+}
+
+// Find returns an item of the checklist by ID, nil when it has none
+func (c *Checklist) Find(id uuid.UUID) *ChecklistItem {
+	for _, item := range c.Items {
+		if item.ID == id {
+			return item
+		}
+		for _, child := range item.Children {
+			if child.ID == id {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+// Tasks returns the checklist as Markdown tasks
+func (c *Checklist) Tasks() []markdown.Task {
+	tasks := make([]markdown.Task, 0, len(c.Items))
+	for _, item := range c.Items {
+		t := markdown.Task{Text: item.Text, Checked: item.Checked}
+		for _, child := range item.Children {
+			t.Subtasks = append(t.Subtasks, markdown.Task{Text: child.Text, Checked: child.Checked})
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// Markdown returns the checklist as a Markdown task list, empty for an empty checklist
+func (c *Checklist) Markdown() string {
+	return markdown.TaskList(c.Tasks())
+}
+
+// withChecklist appends a checklist to the content of a note as a task list, for renders and exports
+func withChecklist(content string, c *Checklist) string {
+	if c == nil || c.Total == 0 {
+		return content
+	}
+	content = strings.TrimRight(content, "\n")
+	if content != "" {
+		content += "\n\n"
+	}
+	return content + c.Markdown()
+}
+
+// splitTaskList splits the task list ending content into the tasks of a checklist.
+// A task list that doesn't make a valid checklist stays in the content.
+func splitTaskList(content string) (string, []markdown.Task) {
+	rest, tasks := markdown.SplitTaskList(content)
+	count, valid := 0, true
+	clean := func(t *markdown.Task) {
+		text, err := validateChecklistText(t.Text)
+		valid = valid && err == nil
+		t.Text = text
+		count++
+	}
+	for i := range tasks {
+		clean(&tasks[i])
+		for j := range tasks[i].Subtasks {
+			clean(&tasks[i].Subtasks[j])
+		}
+	}
+	if len(tasks) == 0 || !valid || count > MaxChecklistItems {
+		return content, nil
+	}
+	return rest, tasks
+}
+
+// validateChecklistText trims the text of an item, which must be a single line
+func validateChecklistText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", utils.NewValidationError("text is required")
+	}
+	if strings.ContainsAny(text, "\r\n") {
+		return "", utils.NewValidationError("text must be a single line")
+	}
+	if len([]rune(text)) > MaxChecklistItemLength {
+		return "", utils.NewValidationError(fmt.Sprintf("text must be at most %d characters", MaxChecklistItemLength))
+	}
+	return text, nil
+}
+
+// loadChecklist loads the checklist of a note in order
+func loadChecklist(ctx context.Context, q db.Conn, noteID uuid.UUID) (*Checklist, error) {
+	rows, err := q.Query(ctx, `
+	SELECT id, parent_id, position, text, checked, checked_at, created_at, updated_at
+	FROM checklist_items
+	WHERE note_id = $1
+	ORDER BY parent_id IS NOT NULL, position
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := &Checklist{Items: []*ChecklistItem{}}
+	parents := map[uuid.UUID]*ChecklistItem{}
+	for rows.Next() {
+		var item ChecklistItem
+		if err := rows.Scan(&item.ID, &item.ParentID, &item.Position, &item.Text, &item.Checked, &item.CheckedAt,
+			&item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		c.Total++
+		if item.Checked {
+			c.Done++
+		}
+		if item.ParentID == nil {
+			item.Children = []*ChecklistItem{}
+			c.Items = append(c.Items, &item)
+			parents[item.ID] = &item
+		} else if parent, ok := parents[*item.ParentID]; ok {
+			parent.Children = append(parent.Children, &item)
+		}
+	}
+
+	return c, rows.Err()
+}
+
+// GetChecklist returns the checklist of a note owned by the user or shared with them
+func (p *NotesPostgresRepository) GetChecklist(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Checklist, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var version int64
+	err = tx.QueryRow(ctx, `
+	SELECT version
+	FROM notes, LATERAL (SELECT `+permissionSQL("notes", "$2")+` AS permission) access
+	WHERE id = $1 AND deleted_at IS NULL AND permission IS NOT NULL
+	`, id, userID).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := loadChecklist(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Version = version
+
+	return c, tx.Commit(ctx)
+}
+
+// editChecklist runs edit on the checklist of a note the user can change, holding the lock of the note.
+// The version of the note moves on, since its checklist is part of it, and the new checklist is returned.
+func (p *NotesPostgresRepository) editChecklist(ctx context.Context, userID, id uuid.UUID, edit func(tx pgx.Tx) error) (*Checklist, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockNote(ctx, tx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	// The server would keep the checklist of an encrypted note in plaintext
+	if current.Encrypted {
+		return nil, ErrEncrypted
+	}
+
+	if err := edit(tx); err != nil {
+		return nil, err
+	}
+
+	var version int64
+	if err := tx.QueryRow(ctx, `UPDATE notes SET updated_at = NOW() WHERE id = $1 RETURNING version`, id).Scan(&version); err != nil {
+		return nil, err
+	}
+
+	c, err := loadChecklist(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Version = version
+
+	return c, tx.Commit(ctx)
+}
+
+// checkParent returns ErrChecklistItemNotFound unless parentID is nil or a top-level item of the note
+func checkParent(ctx context.Context, tx pgx.Tx, noteID uuid.UUID, parentID *uuid.UUID) error {
+	if parentID == nil {
+		return nil
+	}
+
+	var exists bool
+	err := tx.QueryRow(ctx, `
+	SELECT EXISTS(SELECT 1 FROM checklist_items WHERE id = $1 AND note_id = $2 AND parent_id IS NULL)
+	`, *parentID, noteID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return utils.NewValidationError("parentId must be a top-level item of the checklist")
+	}
+	return nil
+}
+
+// insertPosition clamps a requested position among the children of parentID other than
+// the item exclude, nil appends
+func insertPosition(ctx context.Context, tx pgx.Tx, noteID uuid.UUID, parentID *uuid.UUID, exclude uuid.UUID, position *int) (int, error) {
+	var count int
+	err := tx.QueryRow(ctx, `
+	SELECT COUNT(*) FROM checklist_items WHERE note_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND id <> $3
+	`, noteID, parentID, exclude).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if position == nil || *position > count {
+		return count, nil
+	}
+	return max(*position, 0), nil
+}
+
+// shiftSiblings moves the items from a position on among the children of parentID by delta
+func shiftSiblings(ctx context.Context, tx pgx.Tx, noteID uuid.UUID, parentID *uuid.UUID, from, delta int) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE checklist_items SET position = position + $4
+	WHERE note_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND position >= $3
+	`, noteID, parentID, from, delta)
+	return err
+}
+
+// AddChecklistItem adds an item to the checklist of a note at a position among its siblings,
+// at the end when position is nil. item gets its ID.
+func (p *NotesPostgresRepository) AddChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, item *ChecklistItem, position *int) (*Checklist, error) {
+	return p.editChecklist(ctx, userID, id, func(tx pgx.Tx) error {
+		var count int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM checklist_items WHERE note_id = $1`, id).Scan(&count); err != nil {
+			return err
+		}
+		if count >= MaxChecklistItems {
+			return ErrChecklistFull
+		}
+		if err := checkParent(ctx, tx, id, item.ParentID); err != nil {
+			return err
+		}
+
+		at, err := insertPosition(ctx, tx, id, item.ParentID, uuid.Nil, position)
+		if err != nil {
+			return err
+		}
+		if err := shiftSiblings(ctx, tx, id, item.ParentID, at, 1); err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, `
+		INSERT INTO checklist_items(note_id, parent_id, position, text, checked, checked_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 THEN NOW() END)
+		RETURNING id
+		`, id, item.ParentID, at, item.Text, item.Checked).Scan(&item.ID)
+	})
+}
+
+// UpdateChecklistItem changes the text of an item of the checklist of a note or checks it
+func (p *NotesPostgresRepository) UpdateChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, itemID uuid.UUID, change ChecklistChange) (*Checklist, error) {
+	return p.editChecklist(ctx, userID, id, func(tx pgx.Tx) error {
+		cmd, err := tx.Exec(ctx, `
+		UPDATE checklist_items
+		SET text = COALESCE($3, text),
+			checked = CASE WHEN $5 THEN NOT checked ELSE COALESCE($4, checked) END,
+			checked_at = CASE
+				WHEN (CASE WHEN $5 THEN NOT checked ELSE COALESCE($4, checked) END) = checked THEN checked_at
+				WHEN checked THEN NULL
+				ELSE NOW()
+			END,
+			updated_at = NOW()
+		WHERE id = $1 AND note_id = $2
+		`, itemID, id, change.Text, change.Checked, change.Toggle)
+		if err != nil {
+			return err
+		}
+		if cmd.RowsAffected() == 0 {
+			return ErrChecklistItemNotFound
+		}
+		return nil
+	})
+}
+
+// MoveChecklistItem moves an item of the checklist of a note to a position among the children
+// of parentID, or among the top-level items when it is nil. Items with children stay top-level.
+func (p *NotesPostgresRepository) MoveChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, itemID uuid.UUID, parentID *uuid.UUID, position int) (*Checklist, error) {
+	return p.editChecklist(ctx, userID, id, func(tx pgx.Tx) error {
+		var oldParent *uuid.UUID
+		var oldPosition int
+		var hasChildren bool
+		err := tx.QueryRow(ctx, `
+		SELECT parent_id, position, EXISTS(SELECT 1 FROM checklist_items c WHERE c.parent_id = i.id)
+		FROM checklist_items i
+		WHERE id = $1 AND note_id = $2
+		`, itemID, id).Scan(&oldParent, &oldPosition, &hasChildren)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrChecklistItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if parentID != nil {
+			if *parentID == itemID || hasChildren {
+				return utils.NewValidationError("checklists are nested one level, items with children stay top-level")
+			}
+			if err := checkParent(ctx, tx, id, parentID); err != nil {
+				return err
+			}
+		}
+
+		// Take the item out of its siblings, then make room for it at its new place.
+		// It is parked at -1 in between, out of the way of the shifts.
+		if _, err := tx.Exec(ctx, `UPDATE checklist_items SET parent_id = $2, position = -1 WHERE id = $1`, itemID, parentID); err != nil {
+			return err
+		}
+		if err := shiftSiblings(ctx, tx, id, oldParent, oldPosition+1, -1); err != nil {
+			return err
+		}
+		at, err := insertPosition(ctx, tx, id, parentID, itemID, &position)
+		if err != nil {
+			return err
+		}
+		if err := shiftSiblings(ctx, tx, id, parentID, at, 1); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE checklist_items SET position = $2, updated_at = NOW() WHERE id = $1`, itemID, at)
+		return err
+	})
+}
+
+// DeleteChecklistItem deletes an item of the checklist of a note with its children
+func (p *NotesPostgresRepository) DeleteChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, itemID uuid.UUID) (*Checklist, error) {
+	return p.editChecklist(ctx, userID, id, func(tx pgx.Tx) error {
+		var parentID *uuid.UUID
+		var position int
+		err := tx.QueryRow(ctx, `
+		DELETE FROM checklist_items WHERE id = $1 AND note_id = $2
+		RETURNING parent_id, position
+		`, itemID, id).Scan(&parentID, &position)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrChecklistItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return shiftSiblings(ctx, tx, id, parentID, position+1, -1)
+	})
+}
+
+// ReplaceChecklist replaces the checklist of a note with Markdown tasks, e.g. of an imported note
+func (p *NotesPostgresRepository) ReplaceChecklist(ctx context.Context, userID uuid.UUID, id uuid.UUID, tasks []markdown.Task) error {
+	_, err := p.editChecklist(ctx, userID, id, func(tx pgx.Tx) error {
+		return writeChecklist(ctx, tx, id, tasks)
+	})
+	return err
+}
+
+// writeChecklist replaces the checklist items of a note with tasks
+func writeChecklist(ctx context.Context, tx pgx.Tx, id uuid.UUID, tasks []markdown.Task) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM checklist_items WHERE note_id = $1`, id); err != nil {
+		return err
+	}
+
+	if total, _ := countTasks(tasks); total > MaxChecklistItems {
+		return ErrChecklistFull
+	}
+
+	for i, t := range tasks {
+		var parentID uuid.UUID
+		err := tx.QueryRow(ctx, `
+		INSERT INTO checklist_items(note_id, position, text, checked, checked_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END)
+		RETURNING id
+		`, id, i, t.Text, t.Checked).Scan(&parentID)
+		if err != nil {
+			return err
+		}
+		for j, sub := range t.Subtasks {
+			_, err := tx.Exec(ctx, `
+			INSERT INTO checklist_items(note_id, parent_id, position, text, checked, checked_at)
+			VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 THEN NOW() END)
+			`, id, parentID, j, sub.Text, sub.Checked)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// countTasks counts the tasks and subtasks, and the checked ones among them
+func countTasks(tasks []markdown.Task) (total, done int) {
+	count := func(t markdown.Task) {
+		total++
+		if t.Checked {
+			done++
+		}
+	}
+	for _, t := range tasks {
+		count(t)
+		for _, sub := range t.Subtasks {
+			count(sub)
+		}
+	}
+	return total, done
+}
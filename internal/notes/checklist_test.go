@@ -0,0 +1,41 @@
+package notes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+)
+
+func TestSplitTaskList(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantRest  string
+		wantTasks []markdown.Task
+	}{
+		{"no tasks", "Just text\n", "Just text\n", nil},
+		{
+			name:     "trailing task list",
+			content:  "Intro\n\n- [ ] one\n- [x] two\n  - [ ] sub\n",
+			wantRest: "Intro",
+			wantTasks: []markdown.Task{
+				{Text: "one"},
+				{Text: "two", Checked: true, Subtasks: []markdown.Task{{Text: "sub"}}},
+			},
+		},
+		{"text after the tasks", "- [ ] one\nmore text\n", "- [ ] one\nmore text\n", nil},
+		{"item too long", "- [ ] " + strings.Repeat("x", 10000) + "\n", "- [ ] " + strings.Repeat("x", 10000) + "\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, tasks := splitTaskList(tt.content)
+			// Printed, so empty and nil subtask lists compare equal
+			if rest != tt.wantRest || fmt.Sprintf("%+v", tasks) != fmt.Sprintf("%+v", tt.wantTasks) {
+				t.Errorf("splitTaskList() = %q, %+v, want %q, %+v", rest, tasks, tt.wantRest, tt.wantTasks)
+			}
+		})
+	}
+}
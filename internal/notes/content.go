@@ -0,0 +1,98 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// contentChunk is how many characters of content a ContentReader fetches at a time
+const contentChunk = 256 << 10
+
+// ContentReader reads the content of a note in chunks, so large notes are sent without
+// holding them in memory. All chunks come from the snapshot the note was opened in,
+// fetched one at a time from a cursor.
+type ContentReader struct {
+	ctx       context.Context
+	tx        pgx.Tx
+	Version   int64
+	Size      int // bytes
+	Encrypted bool
+	buf       []byte
+	done      bool
+}
+
+// OpenContent opens the content of a note owned by the user or shared with them for reading.
+// The reader must be closed.
+func (p *NotesPostgresRepository) OpenContent(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*ContentReader, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY`); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	cr := &ContentReader{ctx: ctx, tx: tx}
+	err = tx.QueryRow(ctx, `
+	SELECT version, OCTET_LENGTH(content), encrypted
+	FROM notes, LATERAL (SELECT `+permissionSQL("notes", "$2")+` AS permission) access
+	WHERE id = $1 AND deleted_at IS NULL AND permission IS NOT NULL
+	`, id, userID).Scan(&cr.Version, &cr.Size, &cr.Encrypted)
+	if err != nil {
+		tx.Rollback(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoteNotFound
+		}
+		return nil, err
+	}
+
+	// Compressed content is decompressed only up to the end of each chunk
+	_, err = tx.Exec(ctx, `
+	DECLARE note_content NO SCROLL CURSOR FOR
+	SELECT SUBSTR(content, start, $2)
+	FROM notes, generate_series(1, GREATEST(LENGTH(content), 1), $2) AS start
+	WHERE id = $1
+	ORDER BY start
+	`, id, contentChunk)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// Read reads the next bytes of the content, fetching another chunk when the previous one is used up
+func (cr *ContentReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+
+		var chunk string
+		err := cr.tx.QueryRow(cr.ctx, `FETCH NEXT FROM note_content`).Scan(&chunk)
+		if errors.Is(err, pgx.ErrNoRows) {
+			cr.done = true
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		cr.buf = []byte(chunk)
+	}
+
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// Close ends the read-only transaction of the reader
+func (cr *ContentReader) Close() error {
+	cr.buf, cr.done = nil, true
+	return cr.tx.Rollback(cr.ctx)
+}
@@ -0,0 +1,141 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/envelope"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// ErrEncrypted is returned for operations that need to read the content of an encrypted note
+var ErrEncrypted = errors.New("note is end-to-end encrypted")
+
+// EncryptedNote is the envelope a client submits to convert an existing note to an encrypted one
+type EncryptedNote struct {
+	ID              uuid.UUID      `json:"id"`
+	Ciphertext      envelope.Bytes `json:"ciphertext"`
+	Nonce           envelope.Bytes `json:"nonce"`
+	TitleCiphertext envelope.Bytes `json:"titleCiphertext,omitempty"` // omitted keeps the plaintext title
+	TitleNonce      envelope.Bytes `json:"titleNonce,omitempty"`
+	EncryptVersion  int            `json:"encryptVersion"` // defaults to 1
+}
+
+// validateEnvelope checks the envelope of an encrypted note, defaulting its version to 1.
+// The content ciphertext may be as large as maxContent bytes of content encrypt to.
+func validateEnvelope(ciphertext, nonce, titleCiphertext, titleNonce []byte, version *int, maxContent int) error {
+	if err := envelope.ValidateCiphertextSize(ciphertext, maxContent+envelope.TagSize); err != nil {
+		return utils.NewValidationError(err.Error())
+	}
+	if err := envelope.ValidateNonce(nonce); err != nil {
+		return utils.NewValidationError(err.Error())
+	}
+
+	if *version == 0 {
+		*version = 1
+	}
+	if err := envelope.ValidateVersion(*version); err != nil {
+		return utils.NewValidationError(err.Error())
+	}
+
+	if titleCiphertext == nil && titleNonce == nil {
+		return nil
+	}
+	if err := envelope.ValidateCiphertext(titleCiphertext); err != nil {
+		return utils.NewValidationError("title " + err.Error())
+	}
+	if err := envelope.ValidateNonce(titleNonce); err != nil {
+		return utils.NewValidationError("title " + err.Error())
+	}
+	return nil
+}
+
+// validateEncryptedNote validates a note submitted as encrypted, which must not carry plaintext content
+func validateEncryptedNote(note *Note, maxContent int) error {
+	if note.Content != "" {
+		return utils.NewValidationError("encrypted notes can't have plaintext content")
+	}
+	if err := validateEnvelope(note.Ciphertext, note.Nonce, note.TitleCiphertext, note.TitleNonce, &note.EncryptVersion, maxContent); err != nil {
+		return err
+	}
+
+	if note.TitleCiphertext != nil {
+		if note.Title != "" {
+			return utils.NewValidationError("notes with an encrypted title can't have a plaintext title")
+		}
+		return nil
+	}
+	if strings.TrimSpace(note.Title) == "" {
+		return utils.NewValidationError("title is required")
+	}
+	if len(note.Title) > 255 {
+		return utils.NewValidationError("title must be less than 255 characters")
+	}
+	return nil
+}
+
+// encryptionArgs returns the encrypted, ciphertext, nonce, title_ciphertext, title_nonce
+// and encrypt_version column values of a note
+func encryptionArgs(note *Note) []interface{} {
+	if !note.Encrypted {
+		return []interface{}{false, nil, nil, nil, nil, nil}
+	}
+	return []interface{}{
+		true, []byte(note.Ciphertext), []byte(note.Nonce),
+		[]byte(note.TitleCiphertext), []byte(note.TitleNonce), note.EncryptVersion,
+	}
+}
+
+// EncryptNotes converts plaintext notes of the user to encrypted ones with the envelopes
+// the client encrypted them into, and deletes their plaintext revisions, checklists and wiki links.
+// Notes that are missing, trashed or already encrypted are skipped; it returns the converted IDs.
+func (p *NotesPostgresRepository) EncryptNotes(ctx context.Context, userID uuid.UUID, notes []*EncryptedNote) ([]uuid.UUID, error) {
+	query := `
+	UPDATE notes
+	SET encrypted = TRUE, content = '', ciphertext = $3, nonce = $4, encrypt_version = $5,
+		title = CASE WHEN $6::bytea IS NULL THEN title ELSE '' END, title_ciphertext = $6, title_nonce = $7,
+		revision = revision + 1, updated_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND NOT encrypted
+	`
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	converted := []uuid.UUID{}
+	for _, n := range notes {
+		cmd, err := tx.Exec(ctx, query, n.ID, userID, []byte(n.Ciphertext), []byte(n.Nonce), n.EncryptVersion,
+			[]byte(n.TitleCiphertext), []byte(n.TitleNonce))
+		if err != nil {
+			return nil, fmt.Errorf("encrypting note %s: %w", n.ID, err)
+		}
+		if cmd.RowsAffected() > 0 {
+			converted = append(converted, n.ID)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM note_revisions WHERE note_id = ANY($1)`, converted); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM checklist_items WHERE note_id = ANY($1)`, converted); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM note_links WHERE source_id = ANY($1)`, converted); err != nil {
+		return nil, err
+	}
+	// Encrypted titles can't be linked to, links to them break
+	_, err = tx.Exec(ctx, `
+	UPDATE note_links SET target_id = NULL
+	WHERE kind = 'title' AND target_id IN (SELECT id FROM notes WHERE id = ANY($1) AND title = '')
+	`, converted)
+	if err != nil {
+		return nil, err
+	}
+
+	return converted, tx.Commit(ctx)
+}
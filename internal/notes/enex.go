@@ -0,0 +1,553 @@
+package notes
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// enexTimeLayout is the layout of dates in Evernote exports
+const enexTimeLayout = "20060102T150405Z"
+
+// enexNote is a note of an Evernote export, its content is ENML
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+// enexResource is an attachment of an Evernote note, its data isn't imported
+type enexResource struct {
+	Mime     string `xml:"mime"`
+	FileName string `xml:"resource-attributes>file-name"`
+}
+
+// importItem is a note of another app's export, converted to Markdown with front matter
+type importItem struct {
+	name     string // how the import report refers to the note
+	fm       *frontMatter
+	body     string
+	skip     string   // reason the note can't be imported at all
+	warnings []string // parts of the note that were left out
+}
+
+// parseENEX reads the notes of an Evernote export (.enex) one by one and converts their ENML to Markdown
+func parseENEX(data []byte) ([]*importItem, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	items := []*importItem{}
+	root := false
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("the file is not a valid Evernote export")
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "en-export" {
+			root = true
+			continue
+		}
+		if start.Name.Local != "note" || !root {
+			continue
+		}
+
+		var n enexNote
+		if err := d.DecodeElement(&n, &start); err != nil {
+			return nil, errors.New("the file is not a valid Evernote export")
+		}
+		items = append(items, enexItem(&n, len(items)+1))
+	}
+
+	if !root {
+		return nil, errors.New("the file is not an Evernote export")
+	}
+	return items, nil
+}
+
+// enexItem converts an Evernote note, number is its position in the export
+func enexItem(n *enexNote, number int) *importItem {
+	item := &importItem{
+		name: strings.TrimSpace(n.Title),
+		fm:   &frontMatter{Title: strings.TrimSpace(n.Title), Tags: tagList(n.Tags)},
+	}
+	if item.name == "" {
+		item.name = fmt.Sprintf("Untitled note %d", number)
+		item.fm.Title = item.name
+	}
+	if t, err := time.Parse(enexTimeLayout, n.Created); err == nil {
+		item.fm.Created = &t
+	}
+	if t, err := time.Parse(enexTimeLayout, n.Updated); err == nil {
+		item.fm.Updated = &t
+	}
+
+	body, encrypted, err := enmlToMarkdown(n.Content, n.Resources)
+	if err != nil {
+		item.skip = "the note content is not valid ENML"
+		return item
+	}
+	item.body = body
+	if encrypted > 0 {
+		item.warnings = append(item.warnings, fmt.Sprintf("%d encrypted sections were left out", encrypted))
+	}
+	if len(n.Resources) > 0 {
+		item.warnings = append(item.warnings, fmt.Sprintf("%d attachments were not imported", len(n.Resources)))
+	}
+	return item
+}
+
+// enmlToMarkdown converts the ENML content of an Evernote note to Markdown.
+// Attachments become placeholders naming their file, encrypted sections are left out and counted.
+func enmlToMarkdown(content string, resources []enexResource) (string, int, error) {
+	d := xml.NewDecoder(strings.NewReader(content))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	c := &enmlConverter{}
+	media := 0
+	skip := 0 // depth inside elements whose content is left out
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			switch t.Name.Local {
+			case "en-crypt":
+				c.encrypted++
+				skip = 1
+			case "style", "script", "head":
+				skip = 1
+			case "en-media":
+				name := ""
+				if media < len(resources) {
+					name = resources[media].FileName
+				}
+				if name == "" {
+					name = attr(t, "type")
+				}
+				media++
+				c.text("[attachment: " + name + "]")
+			default:
+				c.start(t)
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			c.end(t.Name.Local)
+		case xml.CharData:
+			if skip == 0 {
+				c.text(string(t))
+			}
+		}
+	}
+
+	return c.String(), c.encrypted, nil
+}
+
+// enmlList is an open list of an ENML document
+type enmlList struct {
+	ordered bool
+	number  int
+	indent  int // width of the item markers of the outer lists
+}
+
+// enmlConverter writes the Markdown of an ENML document as its tokens are read
+type enmlConverter struct {
+	out       strings.Builder
+	line      strings.Builder // current line, prefix included
+	atStart   bool            // nothing but the prefix is on the current line
+	blank     bool            // a blank line goes before the next content
+	blankIn   int             // quote depth of the blank line
+	pendingBR bool            // a <br> ends the current line if more content follows
+	marker    string          // list item marker written before the next content
+	quote     int
+	lists     []enmlList
+	links     []string // href of the open links
+	code      int      // depth inside code blocks
+	table     int      // depth inside tables
+	row       int      // rows written of the current table
+	cells     int      // cells written of the current row
+	encrypted int
+}
+
+// attr returns the value of an attribute of an element, empty when it has none
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// headingLevel returns the level of an h1 to h6 element, 0 for other elements
+func headingLevel(name string) int {
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+	return 0
+}
+
+func (c *enmlConverter) start(t xml.StartElement) {
+	name := t.Name.Local
+	if level := headingLevel(name); level > 0 {
+		c.block()
+		c.text(strings.Repeat("#", level) + " ")
+		return
+	}
+
+	switch name {
+	case "div", "p":
+		// Evernote code blocks are divs styled with -en-codeblock, with a div per line
+		if c.code > 0 {
+			c.code++
+			c.breakLine()
+			return
+		}
+		if strings.Contains(strings.ReplaceAll(attr(t, "style"), " ", ""), "-en-codeblock:true") {
+			c.openCode()
+			return
+		}
+		c.blockOrLine()
+	case "pre":
+		c.openCode()
+	case "blockquote":
+		c.block()
+		c.quote++
+	case "ul", "ol":
+		if len(c.lists) == 0 {
+			c.block()
+		} else {
+			c.breakLine()
+		}
+		indent := 0
+		if n := len(c.lists); n > 0 {
+			indent = c.lists[n-1].indent + c.markerWidth(c.lists[n-1])
+		}
+		c.lists = append(c.lists, enmlList{ordered: name == "ol", indent: indent})
+	case "li":
+		c.breakLine()
+		if n := len(c.lists); n > 0 {
+			list := &c.lists[n-1]
+			list.number++
+			c.marker = strings.Repeat(" ", list.indent) + "- "
+			if list.ordered {
+				c.marker = strings.Repeat(" ", list.indent) + strconv.Itoa(list.number) + ". "
+			}
+		}
+	case "en-todo":
+		box := "[ ] "
+		if attr(t, "checked") == "true" {
+			box = "[x] "
+		}
+		switch {
+		case c.marker != "":
+			c.marker += box
+		case c.line.Len() == 0:
+			c.marker = "- " + box
+		case c.atStart:
+			c.write("- " + box)
+		default:
+			c.text(box)
+		}
+	case "br":
+		switch {
+		case c.code > 0:
+			c.breakLine()
+		case c.table > 0:
+			c.text(" ")
+		default:
+			c.pendingBR = true
+		}
+	case "hr":
+		c.block()
+		c.text("---")
+		c.block()
+	case "table":
+		c.block()
+		c.table++
+		c.row = 0
+	case "tr":
+		c.breakLine()
+		c.cells = 0
+	case "td", "th":
+		c.text("| ")
+		c.cells++
+	case "b", "strong":
+		c.text("**")
+	case "i", "em":
+		c.text("*")
+	case "s", "strike", "del":
+		c.text("~~")
+	case "code":
+		if c.code == 0 {
+			c.text("`")
+		}
+	case "a":
+		c.links = append(c.links, attr(t, "href"))
+		c.text("[")
+	case "img":
+		c.text("![" + attr(t, "alt") + "](" + attr(t, "src") + ")")
+	}
+}
+
+func (c *enmlConverter) end(name string) {
+	if headingLevel(name) > 0 {
+		c.block()
+		return
+	}
+
+	switch name {
+	case "div", "p":
+		if c.code > 0 {
+			c.closeCodeOrLine()
+			return
+		}
+		c.blockOrLine()
+	case "pre":
+		c.closeCodeOrLine()
+	case "blockquote":
+		c.breakLine()
+		if c.quote > 0 {
+			c.quote--
+		}
+		c.block()
+	case "ul", "ol":
+		c.breakLine()
+		if n := len(c.lists); n > 0 {
+			c.lists = c.lists[:n-1]
+		}
+		if len(c.lists) == 0 {
+			c.block()
+		}
+	case "li":
+		c.breakLine()
+		c.marker = ""
+	case "table":
+		c.breakLine()
+		if c.table > 0 {
+			c.table--
+		}
+		c.block()
+	case "tr":
+		if c.cells == 0 {
+			return
+		}
+		c.text("|")
+		c.breakLine()
+		if c.row == 0 {
+			c.text(strings.TrimSpace(strings.Repeat("| --- ", c.cells)) + " |")
+			c.breakLine()
+		}
+		c.row++
+	case "td", "th":
+		c.text(" ")
+	case "b", "strong":
+		c.text("**")
+	case "i", "em":
+		c.text("*")
+	case "s", "strike", "del":
+		c.text("~~")
+	case "code":
+		if c.code == 0 {
+			c.text("`")
+		}
+	case "a":
+		if n := len(c.links); n > 0 {
+			c.text("](" + c.links[n-1] + ")")
+			c.links = c.links[:n-1]
+		}
+	}
+}
+
+// markerWidth is the indentation of the content of an item of list
+func (c *enmlConverter) markerWidth(list enmlList) int {
+	if list.ordered {
+		return len(strconv.Itoa(list.number)) + 2
+	}
+	return 2
+}
+
+func (c *enmlConverter) openCode() {
+	if c.code == 0 {
+		c.block()
+		c.write("```")
+		c.breakLine()
+	}
+	c.code++
+}
+
+// closeCodeOrLine ends a line of a code block, or the code block itself when it is the outermost one
+func (c *enmlConverter) closeCodeOrLine() {
+	if c.code == 0 {
+		return
+	}
+	c.code--
+	if c.code > 0 {
+		c.breakLine()
+		return
+	}
+	c.breakLine()
+	c.write("```")
+	c.block()
+}
+
+// blockOrLine ends a div or paragraph: lines of list items and tables stay together,
+// other blocks are separated by a blank line
+func (c *enmlConverter) blockOrLine() {
+	switch {
+	case c.table > 0:
+		c.text(" ")
+	case len(c.lists) > 0:
+		c.breakLine()
+	default:
+		c.block()
+	}
+}
+
+// text writes inline text, collapsing white space outside code blocks
+func (c *enmlConverter) text(s string) {
+	if s == "" {
+		return
+	}
+	if c.code > 0 {
+		for i, part := range strings.Split(s, "\n") {
+			if i > 0 {
+				c.breakLine()
+			}
+			if part != "" {
+				c.write(part)
+			}
+		}
+		return
+	}
+
+	// Runs of white space, line breaks included, are one space like in HTML
+	collapsed := strings.Join(strings.Fields(s), " ")
+	if collapsed == "" {
+		collapsed = " "
+	} else {
+		if strings.TrimLeftFunc(s, unicode.IsSpace) != s {
+			collapsed = " " + collapsed
+		}
+		if strings.TrimRightFunc(s, unicode.IsSpace) != s {
+			collapsed += " "
+		}
+	}
+	if c.atStart || c.line.Len() == 0 {
+		collapsed = strings.TrimLeft(collapsed, " ")
+		if collapsed == "" {
+			return
+		}
+	}
+	if c.pendingBR {
+		c.pendingBR = false
+		if !c.atStart && c.line.Len() > 0 {
+			c.write("\\")
+			c.breakLine()
+		}
+	}
+	c.write(collapsed)
+}
+
+// write appends to the current line, starting it with the quote prefix, list indentation and item marker
+func (c *enmlConverter) write(s string) {
+	if c.line.Len() == 0 {
+		if c.blank && c.out.Len() > 0 {
+			c.out.WriteString(strings.TrimRight(strings.Repeat("> ", min(c.blankIn, c.quote)), " ") + "\n")
+		}
+		c.blank = false
+		c.line.WriteString(strings.Repeat("> ", c.quote))
+		if c.marker != "" {
+			c.line.WriteString(c.marker)
+			c.marker = ""
+		} else if n := len(c.lists); n > 0 && c.code == 0 {
+			c.line.WriteString(strings.Repeat(" ", c.lists[n-1].indent+c.markerWidth(c.lists[n-1])))
+		}
+		c.atStart = true
+	}
+	if s != "" {
+		c.line.WriteString(s)
+		c.atStart = false
+	}
+}
+
+// breakLine ends the current line if anything was written on it
+func (c *enmlConverter) breakLine() {
+	c.pendingBR = false
+	if c.line.Len() == 0 {
+		return
+	}
+	if c.atStart && c.code == 0 {
+		// Only a prefix, like an empty list item
+		c.line.Reset()
+		return
+	}
+	line := c.line.String()
+	if c.code == 0 {
+		line = strings.TrimRight(line, " ")
+	}
+	c.out.WriteString(line + "\n")
+	c.line.Reset()
+	c.atStart = false
+}
+
+// block ends the current line and puts a blank line before the next content
+func (c *enmlConverter) block() {
+	c.breakLine()
+	if !c.blank || c.quote < c.blankIn {
+		c.blankIn = c.quote
+	}
+	c.blank = true
+}
+
+// String returns the Markdown written so far, with the blank lines between consecutive tasks removed
+func (c *enmlConverter) String() string {
+	c.breakLine()
+	lines := strings.Split(strings.TrimRight(c.out.String(), "\n"), "\n")
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if line == "" && i > 0 && i+1 < len(lines) && isTaskLine(lines[i-1]) && isTaskLine(lines[i+1]) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// isTaskLine reports whether a Markdown line is a task list item
+func isTaskLine(line string) bool {
+	line = strings.TrimLeft(line, " ")
+	return strings.HasPrefix(line, "- [ ] ") || strings.HasPrefix(line, "- [x] ")
+}
@@ -0,0 +1,35 @@
+package notes
+
+import "testing"
+
+func TestEnmlToMarkdown(t *testing.T) {
+	resources := []enexResource{{Mime: "image/png", FileName: "cat.png"}}
+
+	tests := []struct {
+		name          string
+		enml          string
+		want          string
+		wantEncrypted int
+	}{
+		{"inline formatting", `<en-note><div>Hello <b>world</b></div></en-note>`, "Hello **world**", 0},
+		{"heading and entities", `<en-note><h1>Title</h1><p>One &amp; two</p></en-note>`, "# Title\n\nOne & two", 0},
+		{"lists", `<en-note><ul><li>a</li><li>b</li></ul><ol><li>x</li><li>y</li></ol></en-note>`, "- a\n- b\n\n1. x\n2. y", 0},
+		{"tasks", `<en-note><div><en-todo checked="true"/>done</div><div><en-todo checked="false"/>open</div></en-note>`, "- [x] done\n- [ ] open", 0},
+		{"link", `<en-note><div>Link <a href="https://example.com">here</a></div></en-note>`, "Link [here](https://example.com)", 0},
+		{"line break and code", `<en-note><div>a<br/>b</div><div><i>it</i> <code>c</code></div></en-note>`, "a\\\nb\n\n*it* `c`", 0},
+		{"attachment", `<en-note><en-media hash="h1" type="image/png"/></en-note>`, "[attachment: cat.png]", 0},
+		{"encrypted", `<en-note><div>secret: <en-crypt>abc</en-crypt></div></en-note>`, "secret:", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, encrypted, err := enmlToMarkdown(tt.enml, resources)
+			if err != nil {
+				t.Fatalf("enmlToMarkdown() error = %v", err)
+			}
+			if got != tt.want || encrypted != tt.wantEncrypted {
+				t.Errorf("enmlToMarkdown() = %q, %d, want %q, %d", got, encrypted, tt.want, tt.wantEncrypted)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package notes
+
+import (
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Archived filter modes
+const (
+	ArchivedExclude = "exclude" // default for lists
+	ArchivedOnly    = "only"
+	ArchivedInclude = "include" // default for searches
+)
+
+// Filter narrows a notes list or search
+type Filter struct {
+	Pinned    *bool
+	Favorite  *bool
+	Archived  string // one of the Archived modes, "" for the endpoint default
+	Encrypted *bool
+
+	Tags         []string // tag names, matched ignoring case
+	MatchAllTags bool     // notes must carry every tag instead of any of them
+
+	Notebook           *uuid.UUID // notes filed in this notebook
+	Unfiled            bool       // notes not filed in any notebook
+	IncludeDescendants bool       // also notes in the notebooks nested under Notebook
+}
+
+// parseFilter reads the note filters from the query string
+func parseFilter(q url.Values) (Filter, error) {
+	f := Filter{Tags: q["tag"]}
+
+	switch q.Get("tag_mode") {
+	case "", "any":
+	case "all":
+		f.MatchAllTags = true
+	default:
+		return f, utils.NewValidationError("tag_mode must be any or all")
+	}
+
+	var err error
+	if f.Pinned, err = parseBoolParam(q, "pinned"); err != nil {
+		return f, err
+	}
+	if f.Favorite, err = parseBoolParam(q, "favorite"); err != nil {
+		return f, err
+	}
+	if f.Encrypted, err = parseBoolParam(q, "encrypted"); err != nil {
+		return f, err
+	}
+
+	switch q.Get("archived") {
+	case "":
+	case "false":
+		f.Archived = ArchivedExclude
+	case "true":
+		f.Archived = ArchivedOnly
+	case "all":
+		f.Archived = ArchivedInclude
+	default:
+		return f, utils.NewValidationError("archived must be true, false or all")
+	}
+
+	switch notebook := q.Get("notebook"); notebook {
+	case "":
+	case "none":
+		f.Unfiled = true
+	default:
+		id, err := uuid.Parse(notebook)
+		if err != nil {
+			return f, utils.NewValidationError("notebook must be a notebook ID or none")
+		}
+		f.Notebook = &id
+	}
+
+	switch q.Get("descendants") {
+	case "", "true":
+		f.IncludeDescendants = true
+	case "false":
+	default:
+		return f, utils.NewValidationError("descendants must be true or false")
+	}
+
+	return f, nil
+}
+
+// parseBoolParam reads an optional true/false query parameter
+func parseBoolParam(q url.Values, name string) (*bool, error) {
+	switch q.Get(name) {
+	case "":
+		return nil, nil
+	case "true":
+		value := true
+		return &value, nil
+	case "false":
+		value := false
+		return &value, nil
+	default:
+		return nil, utils.NewValidationError(name + " must be true or false")
+	}
+}
+
+// apply adds the filter conditions to a query on notes
+func (f *Filter) apply(where *utils.Where, userID uuid.UUID) {
+	if f.Pinned != nil {
+		if *f.Pinned {
+			where.Add("pin_order IS NOT NULL")
+		} else {
+			where.Add("pin_order IS NULL")
+		}
+	}
+	if f.Favorite != nil {
+		where.Add("favorite = ?", *f.Favorite)
+	}
+	if f.Encrypted != nil {
+		where.Add("encrypted = ?", *f.Encrypted)
+	}
+	switch f.Archived {
+	case ArchivedExclude:
+		where.Add("archived_at IS NULL")
+	case ArchivedOnly:
+		where.Add("archived_at IS NOT NULL")
+	}
+
+	if len(f.Tags) > 0 {
+		if f.MatchAllTags {
+			where.Add(`id IN (
+			SELECT nt.note_id
+			FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE t.user_id = ? AND LOWER(t.name) IN (SELECT LOWER(x) FROM unnest(?::text[]) x)
+			GROUP BY nt.note_id
+			HAVING COUNT(*) = (SELECT COUNT(DISTINCT LOWER(x)) FROM unnest(?::text[]) x))`, userID, f.Tags, f.Tags)
+		} else {
+			where.Add(`id IN (
+			SELECT nt.note_id
+			FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE t.user_id = ? AND LOWER(t.name) IN (SELECT LOWER(x) FROM unnest(?::text[]) x))`, userID, f.Tags)
+		}
+	}
+
+	switch {
+	case f.Unfiled:
+		where.Add("notebook_id IS NULL")
+	case f.Notebook != nil && f.IncludeDescendants:
+		where.Add(`notebook_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM notebooks WHERE id = ? AND user_id = ?
+				UNION ALL
+				SELECT c.id FROM notebooks c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree)`, *f.Notebook, userID)
+	case f.Notebook != nil:
+		where.Add("notebook_id = ?", *f.Notebook)
+	}
+}
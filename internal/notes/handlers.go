@@ -1,59 +1,163 @@
 package notes
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/diff"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+	"github.com/subrat-dwi/shubserver/internal/notebooks"
 	"github.com/subrat-dwi/shubserver/internal/utils"
 )
 
 // Handler struct for notes
 type NotesHandler struct {
-	repo NotesRepository
+	repo           NotesRepository
+	notebooks      notebooks.NotebooksRepository // folders of exported and imported archives
+	imports        *ImportRunner                 // imports from Evernote and Google Keep
+	service        *NotesService                 // validation and writes of notes
+	searchLanguage string
+	maxContent     int // bytes
 }
 
-// Constructor for handler
-func NewNotesHandler(repo NotesRepository) *NotesHandler {
-	return &NotesHandler{repo: repo}
+// DefaultMaxContentBytes limits the content of a note when no limit is configured
+const DefaultMaxContentBytes = 5 << 20
+
+// Constructor for handler, searchLanguage is the default text search configuration
+// and maxContent limits the size of note content in bytes
+func NewNotesHandler(repo NotesRepository, notebooksRepo notebooks.NotebooksRepository, importJobs ImportJobsRepository, searchLanguage string, maxContent int) *NotesHandler {
+	service := NewNotesService(repo, searchLanguage, maxContent)
+	h := &NotesHandler{repo: repo, notebooks: notebooksRepo, service: service,
+		searchLanguage: service.searchLanguage, maxContent: service.maxContent}
+	h.imports = newImportRunner(h, importJobs)
+	return h
+}
+
+// RunImports runs the queued import jobs until ctx is done, see ImportRunner
+func (h *NotesHandler) RunImports(ctx context.Context) {
+	h.imports.Run(ctx)
+}
+
+// Response struct for listing notes
+type ListNotesResponse struct {
+	Notes      []*Note `json:"notes"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      *int    `json:"total,omitempty"`
+}
+
+// Response struct for searching notes
+type SearchNotesResponse struct {
+	Notes      []*SearchResult `json:"notes"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	Total      *int            `json:"total,omitempty"`
 }
 
-// Validation helper
-func (h *NotesHandler) validateNoteInput(title, content string) error {
-	if strings.TrimSpace(title) == "" {
-		return utils.NewValidationError("title is required")
+// NotesHandler to show all notes, or search them when q is given
+func (h *NotesHandler) listNotes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if q := r.URL.Query().Get("q"); q != "" {
+		h.searchNotes(w, r, userID, q)
+		return
 	}
-	if strings.TrimSpace(content) == "" {
-		return utils.NewValidationError("content is required")
+
+	page, err := utils.ParsePageRequest(r.URL.Query(), SortKeys...)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	if len(title) > 255 {
-		return utils.NewValidationError("title must be less than 255 characters")
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	if len(content) > 5000 {
-		return utils.NewValidationError("content must be less than 5000 characters")
+
+	list, err := h.repo.List(r.Context(), userID, &ListOptions{Page: page, Filter: filter})
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "can't access notes")
+		return
 	}
-	return nil
+
+	utils.JSON(w, http.StatusOK, ListNotesResponse{
+		Notes:      list.Items,
+		NextCursor: list.NextCursor,
+		Total:      list.Total,
+	})
 }
 
-// NotesHandler to show all notes
-func (h *NotesHandler) listNotes(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("userID").(uuid.UUID)
-	list, err := h.repo.List(r.Context(), userID)
+// searchNotes runs a full-text search, results are ordered by rank
+func (h *NotesHandler) searchNotes(w http.ResponseWriter, r *http.Request, userID uuid.UUID, q string) {
+	page, err := utils.ParseOffsetPageRequest(r.URL.Query(), "rank")
 	if err != nil {
-		utils.Error(w, http.StatusNotFound, "can't access notes")
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = h.searchLanguage
+	}
+	if !IsSearchLanguage(lang) {
+		utils.Error(w, http.StatusBadRequest, "unsupported search language")
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.repo.Search(r.Context(), userID, &SearchOptions{Query: q, Language: lang, Page: page, Filter: filter})
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "search failed")
 		return
 	}
 
-	utils.JSON(w, http.StatusOK, list)
+	utils.JSON(w, http.StatusOK, SearchNotesResponse{
+		Notes:      results.Items,
+		NextCursor: results.NextCursor,
+		Total:      results.Total,
+	})
+}
+
+// Response struct for a single note, with metadata derived from its Markdown content and checklist
+type GetNoteResponse struct {
+	*Note
+	Checklist   []*ChecklistItem   `json:"checklist"`
+	TOC         []markdown.Heading `json:"toc"`
+	WordCount   int                `json:"wordCount"`
+	ReadingTime int                `json:"readingTimeMinutes"`
 }
 
-// NotesHandler to get a single note
+// Media types a single note can be returned as, JSON first as the default
+var noteMediaTypes = []string{"application/json", "text/html", "text/markdown"}
+
+// NotesHandler to get a single note as JSON, rendered HTML or raw Markdown depending on Accept
 func (h *NotesHandler) getNote(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	userID := r.Context().Value("userID").(uuid.UUID)
+
+	w.Header().Set("Vary", "Accept")
+	mediaType := utils.Negotiate(r, noteMediaTypes...)
+	if mediaType == "" {
+		utils.Error(w, http.StatusNotAcceptable, "supported types are "+strings.Join(noteMediaTypes, ", "))
+		return
+	}
+
 	note, err := h.repo.Get(r.Context(), userID, id)
 
 	if err != nil {
@@ -61,7 +165,100 @@ func (h *NotesHandler) getNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.JSON(w, http.StatusOK, note)
+	w.Header().Set("ETag", utils.ETag(note.Version))
+	if utils.IfNoneMatch(r, note.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// The server can't read encrypted notes, so it has nothing to render
+	if note.Encrypted {
+		if mediaType != "application/json" {
+			utils.Error(w, http.StatusNotAcceptable, "encrypted notes are only available as application/json")
+			return
+		}
+		utils.JSON(w, http.StatusOK, note)
+		return
+	}
+
+	// The checklist is rendered as a task list after the content
+	checklist := &Checklist{Items: []*ChecklistItem{}}
+	if note.ChecklistTotal > 0 {
+		if checklist, err = h.repo.GetChecklist(r.Context(), userID, note.ID); err != nil {
+			utils.Error(w, http.StatusInternalServerError, "failed to load checklist")
+			return
+		}
+	}
+	source := withChecklist(note.Content, checklist)
+
+	if mediaType == "text/markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, source)
+		return
+	}
+
+	doc, err := markdown.Render(source)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to render note")
+		return
+	}
+
+	if mediaType == "text/html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, doc.HTML)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, GetNoteResponse{
+		Note:        note,
+		Checklist:   checklist.Items,
+		TOC:         doc.TOC,
+		WordCount:   doc.WordCount,
+		ReadingTime: doc.ReadingTime,
+	})
+}
+
+// NotesHandler to stream the full content of a note as Markdown, for notes too large to load at once
+func (h *NotesHandler) getNoteContent(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+
+	content, err := h.repo.OpenContent(r.Context(), userID, id)
+	if errors.Is(err, ErrNoteNotFound) {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to read note")
+		return
+	}
+	defer content.Close()
+
+	if content.Encrypted {
+		utils.Error(w, http.StatusConflict, "encrypted notes have no plaintext content")
+		return
+	}
+
+	w.Header().Set("ETag", utils.ETag(content.Version))
+	if utils.IfNoneMatch(r, content.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// The body is sent as it is read, an error from here on leaves it truncated
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(content.Size))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("notes: streaming note %s: %v", id, err)
+	}
 }
 
 // NotesHandler to create a note
@@ -73,21 +270,28 @@ func (h *NotesHandler) createNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate input
-	if err := h.validateNoteInput(note.Title, note.Content); err != nil {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	dbnote, err := h.service.CreateNote(r.Context(), userID, &note)
+	if utils.IsValidationError(err) || errors.Is(err, ErrNotebookNotFound) {
 		utils.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	userID := r.Context().Value("userID").(uuid.UUID)
-	note.UserID = userID
-
-	dbnote, err := h.repo.Create(r.Context(), &note)
+	if errors.Is(err, ErrNoteExists) {
+		// A retried create with If-None-Match: * gets the stored copy back
+		if utils.CreateOnly(r) {
+			h.preconditionFailed(w, r, userID, note.ID.String())
+			return
+		}
+		utils.Error(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	w.Header().Set("ETag", utils.ETag(dbnote.Version))
 	utils.JSON(w, http.StatusCreated, dbnote)
 }
 
@@ -96,7 +300,20 @@ func (h *NotesHandler) deleteNote(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	userID := r.Context().Value("userID").(uuid.UUID)
 
-	if err := h.repo.Delete(r.Context(), userID, id); err != nil {
+	expected, ok := h.ifMatch(w, r, userID, id)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.Delete(r.Context(), userID, id, expected); err != nil {
+		if errors.Is(err, ErrNotOwner) {
+			utils.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, ErrVersionConflict) {
+			h.preconditionFailed(w, r, userID, id)
+			return
+		}
 		utils.Error(w, http.StatusNotFound, "cannot delete note")
 		return
 	}
@@ -122,26 +339,1094 @@ func (h *NotesHandler) updateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expected, ok := utils.CheckIfMatch(r, existing.Version)
+	if !ok {
+		utils.PreconditionFailed(w, existing.Version, existing)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
 	var payload Note
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	if err := json.Unmarshal(body, &payload); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	// notebookId is only changed when present, null takes the note out of its notebook
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
 		utils.Error(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
 
-	// Validate input
-	if err := h.validateNoteInput(payload.Title, payload.Content); err != nil {
+	err = h.service.SaveNote(r.Context(), userID, existing, &payload, fields, expected, rewriteLinks(r))
+	h.saved(w, r, userID, existing, err)
+}
+
+// NotesHandler to change some fields of a note with a JSON Merge Patch (RFC 7396)
+func (h *NotesHandler) patchNote(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	existing, err := h.repo.Get(r.Context(), userID, id)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+
+	expected, ok := utils.CheckIfMatch(r, existing.Version)
+	if !ok {
+		utils.PreconditionFailed(w, existing.Version, existing)
+		return
+	}
+
+	patch, err := utils.ReadMergePatch(r)
+	if errors.Is(err, utils.ErrMergePatchType) {
+		utils.Error(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	if err != nil {
 		utils.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	existing.Title = payload.Title
-	existing.Content = payload.Content
-	existing.UpdatedAt = time.Now()
+	err = h.service.PatchNote(r.Context(), userID, existing, patch, expected, rewriteLinks(r))
+	h.saved(w, r, userID, existing, err)
+}
+
+// rewriteLinks reports whether a save asks for the links to a renamed note to be rewritten
+func rewriteLinks(r *http.Request) bool {
+	return r.URL.Query().Get("rewrite_links") == "true"
+}
 
-	if err := h.repo.Update(r.Context(), userID, existing); err != nil {
+// saved answers a PUT or PATCH of a note with the saved note, or the status of err
+func (h *NotesHandler) saved(w http.ResponseWriter, r *http.Request, userID uuid.UUID, note *Note, err error) {
+	var conflict *MergeConflict
+	switch {
+	case err == nil:
+		w.Header().Set("ETag", utils.ETag(note.Version))
+		utils.JSON(w, http.StatusOK, note)
+	case utils.IsValidationError(err), errors.Is(err, ErrNotebookNotFound):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrOwnerOnly), errors.Is(err, ErrRewriteOwnerOnly), errors.Is(err, ErrReadOnly):
+		utils.Error(w, http.StatusForbidden, err.Error())
+	case errors.As(err, &conflict):
+		utils.JSON(w, http.StatusConflict, conflict)
+	case errors.Is(err, ErrEditNotMerged):
+		utils.Error(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrVersionConflict):
+		h.preconditionFailed(w, r, userID, note.ID.String())
+	case errors.Is(err, ErrLinksNotRewritten):
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	default:
 		utils.Error(w, http.StatusInternalServerError, "failed to update")
+	}
+}
+
+// ifMatch checks If-Match against the current version of a note and returns the version
+// a write must still find, 0 without the header. The response is written when ok is false.
+func (h *NotesHandler) ifMatch(w http.ResponseWriter, r *http.Request, userID uuid.UUID, id string) (expected int64, ok bool) {
+	if r.Header.Get("If-Match") == "" {
+		return 0, true
+	}
+
+	note, err := h.repo.Get(r.Context(), userID, id)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return 0, false
+	}
+
+	if expected, ok = utils.CheckIfMatch(r, note.Version); !ok {
+		utils.PreconditionFailed(w, note.Version, note)
+	}
+	return expected, ok
+}
+
+// preconditionFailed answers 412 with the current copy of a note, when the user can still read it
+func (h *NotesHandler) preconditionFailed(w http.ResponseWriter, r *http.Request, userID uuid.UUID, id string) {
+	note, err := h.repo.Get(r.Context(), userID, id)
+	if err != nil {
+		utils.PreconditionFailed(w, 0, nil)
+		return
+	}
+	utils.PreconditionFailed(w, note.Version, note)
+}
+
+// Response struct for listing the revisions of a note
+type ListRevisionsResponse struct {
+	Current   int         `json:"current"` // revision number of the current version
+	Revisions []*Revision `json:"revisions"`
+}
+
+// NotesHandler to list the stored revisions of a note
+func (h *NotesHandler) listRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	note, err := h.repo.Get(r.Context(), userID, id.String())
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+
+	list, err := h.repo.ListRevisions(r.Context(), userID, id)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access revisions")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, ListRevisionsResponse{Current: note.Revision, Revisions: list})
+}
+
+// NotesHandler to get a single revision of a note, "current" is the current version
+func (h *NotesHandler) getRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	rev, err := h.revision(r, userID, id, chi.URLParam(r, "rev"))
+	if err != nil {
+		revisionError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, rev)
+}
+
+// NotesHandler to diff two versions of a note: ?from=&to=&mode=line|word, to defaults to the current version
+func (h *NotesHandler) diffRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	switch mode {
+	case "":
+		mode = DiffLines
+	case DiffLines, DiffWords:
+	default:
+		utils.Error(w, http.StatusBadRequest, "mode must be line or word")
+		return
+	}
+	if q.Get("from") == "" {
+		utils.Error(w, http.StatusBadRequest, "from is required")
+		return
+	}
+	to := q.Get("to")
+	if to == "" {
+		to = "current"
+	}
+
+	from, err := h.revision(r, userID, id, q.Get("from"))
+	if err != nil {
+		revisionError(w, err)
+		return
+	}
+	target, err := h.revision(r, userID, id, to)
+	if err != nil {
+		revisionError(w, err)
+		return
+	}
+
+	result, err := diffRevisions(from, target, mode)
+	if errors.Is(err, diff.ErrTooDifferent) {
+		utils.Error(w, http.StatusUnprocessableEntity, "the versions differ in too many places to compare")
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to compare versions")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, result)
+}
+
+// NotesHandler to restore a revision, the replaced version is kept as a new revision
+func (h *NotesHandler) restoreRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	revision, err := strconv.Atoi(chi.URLParam(r, "rev"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid revision")
+		return
+	}
+
+	if err := h.repo.RestoreRevision(r.Context(), userID, id, revision); err != nil {
+		revisionError(w, err)
+		return
+	}
+
+	note, err := h.repo.Get(r.Context(), userID, id.String())
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, note)
+}
+
+// revision loads a version of a note by number, or its current version for "current"
+func (h *NotesHandler) revision(r *http.Request, userID uuid.UUID, id uuid.UUID, value string) (*Revision, error) {
+	if value == "current" {
+		note, err := h.repo.Get(r.Context(), userID, id.String())
+		if err != nil {
+			return nil, ErrRevisionNotFound
+		}
+		if note.Encrypted {
+			return nil, ErrEncrypted
+		}
+		return &Revision{
+			Revision:  note.Revision,
+			Title:     note.Title,
+			Content:   note.Content,
+			Size:      len(note.Content),
+			CreatedAt: note.UpdatedAt,
+		}, nil
+	}
+
+	revision, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, utils.NewValidationError("revisions must be numbers or current")
+	}
+
+	return h.repo.GetRevision(r.Context(), userID, id, revision)
+}
+
+// revisionError writes the response for an error loading or restoring a revision
+func revisionError(w http.ResponseWriter, err error) {
+	switch {
+	case utils.IsValidationError(err):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrRevisionNotFound):
+		utils.Error(w, http.StatusNotFound, "revision not found")
+	case errors.Is(err, ErrNoteNotFound):
+		utils.Error(w, http.StatusNotFound, "note not found")
+	case errors.Is(err, ErrReadOnly):
+		utils.Error(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, ErrEncrypted):
+		utils.Error(w, http.StatusConflict, "encrypted notes have no revisions")
+	default:
+		utils.Error(w, http.StatusInternalServerError, "can't access revisions")
+	}
+}
+
+// Request struct for archiving or unarchiving many notes
+type BulkNotesRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+// NotesHandler to pin a note (POST) or unpin it (DELETE)
+func (h *NotesHandler) setPinned(w http.ResponseWriter, r *http.Request) {
+	h.setState(w, r, func(userID, id uuid.UUID, on bool) error {
+		return h.repo.SetPinned(r.Context(), userID, id, on)
+	})
+}
+
+// NotesHandler to mark a note as favorite (POST) or unmark it (DELETE)
+func (h *NotesHandler) setFavorite(w http.ResponseWriter, r *http.Request) {
+	h.setState(w, r, func(userID, id uuid.UUID, on bool) error {
+		return h.repo.SetFavorite(r.Context(), userID, id, on)
+	})
+}
+
+// NotesHandler to archive a note (POST) or unarchive it (DELETE)
+func (h *NotesHandler) setArchived(w http.ResponseWriter, r *http.Request) {
+	h.setState(w, r, func(userID, id uuid.UUID, on bool) error {
+		changed, err := h.repo.SetArchived(r.Context(), userID, []uuid.UUID{id}, on)
+		if err == nil && changed == 0 {
+			// Either missing, not owned or already in the requested state
+			note, err := h.repo.Get(r.Context(), userID, id.String())
+			if err != nil {
+				return ErrNoteNotFound
+			}
+			if note.Permission != PermissionOwner {
+				return ErrNotOwner
+			}
+		}
+		return err
+	})
+}
+
+// setState toggles a note state, POST turns it on and DELETE turns it off, and answers with the note
+func (h *NotesHandler) setState(w http.ResponseWriter, r *http.Request, set func(userID, id uuid.UUID, on bool) error) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := set(userID, id, r.Method == http.MethodPost); err != nil {
+		if errors.Is(err, ErrNoteNotFound) {
+			utils.Error(w, http.StatusNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, ErrNotOwner) {
+			utils.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		utils.Error(w, http.StatusInternalServerError, "failed to update")
+		return
+	}
+
+	note, err := h.repo.Get(r.Context(), userID, id.String())
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, note)
+}
+
+// NotesHandler to archive many notes at once
+func (h *NotesHandler) archiveNotes(w http.ResponseWriter, r *http.Request) {
+	h.bulkArchive(w, r, true)
+}
+
+// NotesHandler to unarchive many notes at once
+func (h *NotesHandler) unarchiveNotes(w http.ResponseWriter, r *http.Request) {
+	h.bulkArchive(w, r, false)
+}
+
+// bulkArchive archives or unarchives the notes listed in the request body
+func (h *NotesHandler) bulkArchive(w http.ResponseWriter, r *http.Request, archived bool) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req BulkNotesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if len(req.IDs) == 0 {
+		utils.Error(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > MaxBulkNotes {
+		utils.Error(w, http.StatusBadRequest, "too many ids, at most 500 per request")
+		return
+	}
+
+	changed, err := h.repo.SetArchived(r.Context(), userID, req.IDs, archived)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to update")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]int64{
+		"updated": changed,
+	})
+}
+
+// Request struct for sharing a note
+type ShareNoteRequest struct {
+	Email      string `json:"email"`
+	Permission string `json:"permission"` // viewer or editor
+}
+
+// Response struct for listing the notes shared with the user
+type ListSharedNotesResponse struct {
+	Notes      []*SharedNote `json:"notes"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Total      *int          `json:"total,omitempty"`
+}
+
+// sameTags reports whether two tag lists name the same tags, ignoring order and case
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	names := make(map[string]bool, len(a))
+	for _, name := range a {
+		names[strings.ToLower(name)] = true
+	}
+	for _, name := range b {
+		if !names[strings.ToLower(name)] {
+			return false
+		}
+	}
+	return true
+}
+
+// shareError writes the response for an error managing the shares of a note
+func shareError(w http.ResponseWriter, err error) {
+	switch {
+	case utils.IsValidationError(err):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNoteNotFound):
+		utils.Error(w, http.StatusNotFound, "note not found")
+	case errors.Is(err, ErrShareNotFound), errors.Is(err, ErrShareUserNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNotOwner):
+		utils.Error(w, http.StatusForbidden, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, "can't access shares")
+	}
+}
+
+// NotesHandler to list the users a note is shared with
+func (h *NotesHandler) listShares(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	shares, err := h.repo.ListShares(r.Context(), userID, id)
+	if err != nil {
+		shareError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"shares": shares,
+	})
+}
+
+// NotesHandler to share a note with another user, or change their permission
+func (h *NotesHandler) shareNote(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req ShareNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		utils.Error(w, http.StatusBadRequest, "email is required")
+		return
+	}
+	if req.Permission != PermissionViewer && req.Permission != PermissionEditor {
+		utils.Error(w, http.StatusBadRequest, "permission must be viewer or editor")
+		return
+	}
+
+	share, err := h.repo.ShareNote(r.Context(), userID, id, req.Email, req.Permission)
+	if err != nil {
+		shareError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, share)
+}
+
+// NotesHandler to stop sharing a note with a user, recipients can remove themselves
+func (h *NotesHandler) revokeShare(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	recipientID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.repo.RevokeShare(r.Context(), userID, id, recipientID); err != nil {
+		shareError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// NotesHandler to list the notes other users shared with the user
+func (h *NotesHandler) listSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	page, err := utils.ParsePageRequest(r.URL.Query(), SortKeys...)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := h.repo.ListSharedWithMe(r.Context(), userID, page)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access shared notes")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, ListSharedNotesResponse{
+		Notes:      list.Items,
+		NextCursor: list.NextCursor,
+		Total:      list.Total,
+	})
+}
+
+// Request struct for converting notes to encrypted ones
+type EncryptNotesRequest struct {
+	Notes []*EncryptedNote `json:"notes"`
+}
+
+// NotesHandler to convert many plaintext notes to encrypted ones at once.
+// The client encrypts each note locally and submits the envelopes.
+func (h *NotesHandler) encryptNotes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req EncryptNotesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if len(req.Notes) == 0 {
+		utils.Error(w, http.StatusBadRequest, "notes is required")
+		return
+	}
+	if len(req.Notes) > MaxBulkNotes {
+		utils.Error(w, http.StatusBadRequest, "too many notes, at most 500 per request")
+		return
+	}
+
+	for i, n := range req.Notes {
+		if n == nil || n.ID == uuid.Nil {
+			utils.Error(w, http.StatusBadRequest, fmt.Sprintf("notes[%d]: id is required", i))
+			return
+		}
+		if err := validateEnvelope(n.Ciphertext, n.Nonce, n.TitleCiphertext, n.TitleNonce, &n.EncryptVersion, h.maxContent); err != nil {
+			utils.Error(w, http.StatusBadRequest, fmt.Sprintf("notes[%d]: %s", i, err.Error()))
+			return
+		}
+	}
+
+	converted, err := h.repo.EncryptNotes(r.Context(), userID, req.Notes)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to encrypt notes")
+		return
+	}
+
+	done := make(map[uuid.UUID]bool, len(converted))
+	for _, id := range converted {
+		done[id] = true
+	}
+	skipped := []uuid.UUID{}
+	for _, n := range req.Notes {
+		if !done[n.ID] {
+			skipped = append(skipped, n.ID)
+		}
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"encrypted": len(converted),
+		"skipped":   skipped,
+	})
+}
+
+// NotesHandler to download every note of the user as a zip of Markdown files with YAML front matter,
+// in folders named after their notebooks. Checklists are written as task lists after the content.
+func (h *NotesHandler) exportNotes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	tree, err := h.notebooks.Tree(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to export notes")
+		return
+	}
+
+	page := &utils.PageRequest{Limit: utils.MaxPageLimit, Sort: SortKeys[0]}
+	opts := &ListOptions{Page: page, Filter: Filter{Archived: ArchivedInclude}}
+	list, err := h.repo.List(r.Context(), userID, opts)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to export notes")
+		return
+	}
+
+	// The archive is streamed page by page, a failure from here on leaves it truncated
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="notes-%s.zip"`, time.Now().Format("2006-01-02")))
+	archive := newArchiveWriter(w, tree)
+	for {
+		for _, n := range list.Items {
+			// Lists only have an excerpt of long notes, they are loaded one at a time
+			if n.Truncated {
+				if n, err = h.repo.Get(r.Context(), userID, n.ID.String()); err != nil {
+					log.Printf("notes: export for %s: %v", userID, err)
+					return
+				}
+			}
+			var checklist *Checklist
+			if n.ChecklistTotal > 0 {
+				if checklist, err = h.repo.GetChecklist(r.Context(), userID, n.ID); err != nil {
+					log.Printf("notes: export for %s: %v", userID, err)
+					return
+				}
+			}
+			if err := archive.add(n, checklist); err != nil {
+				log.Printf("notes: export for %s: %v", userID, err)
+				return
+			}
+		}
+		if list.NextCursor == "" {
+			break
+		}
+
+		// The cursor of the page also continues after pinned notes, which lead the list
+		if page.Cursor, err = utils.DecodeCursor(list.NextCursor); err != nil {
+			log.Printf("notes: export for %s: %v", userID, err)
+			return
+		}
+		if list, err = h.repo.List(r.Context(), userID, opts); err != nil {
+			log.Printf("notes: export for %s: %v", userID, err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("notes: export for %s: %v", userID, err)
+	}
+}
+
+// NotesHandler to import a zip of Markdown files, as exported or from tools like Obsidian.
+// The zip is the request body (application/zip) or the file field of a multipart form.
+func (h *NotesHandler) importNotes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	data, ok := readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "the archive is not a valid zip file")
+		return
+	}
+	if len(archive.File) > MaxImportFiles {
+		utils.Error(w, http.StatusBadRequest, fmt.Sprintf("archives are limited to %d files", MaxImportFiles))
+		return
+	}
+
+	tree, err := h.notebooks.Tree(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to import notes")
+		return
+	}
+
+	im := newImporter(h, userID, tree)
+	for _, f := range archive.File {
+		if err := im.importFile(r.Context(), f); err != nil {
+			log.Printf("notes: import for %s: %s: %v", userID, f.Name, err)
+			utils.Error(w, http.StatusInternalServerError, "failed to import "+f.Name)
+			return
+		}
+	}
+
+	utils.JSON(w, http.StatusOK, im.report)
+}
+
+// readUpload reads an uploaded export, sent as the request body or the file field of a multipart form
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBytes)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			utils.Error(w, http.StatusBadRequest, "file is required")
+			return nil, false
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		utils.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("uploads are limited to %d MB", MaxImportBytes>>20))
+		return nil, false
+	}
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "can't read the upload")
+		return nil, false
+	}
+	return data, true
+}
+
+// NotesHandler to import an Evernote export (.enex) in the background
+func (h *NotesHandler) importENEX(w http.ResponseWriter, r *http.Request) {
+	h.startImport(w, r, ImportSourceENEX)
+}
+
+// NotesHandler to import a Google Keep Takeout zip in the background
+func (h *NotesHandler) importKeep(w http.ResponseWriter, r *http.Request) {
+	h.startImport(w, r, ImportSourceKeep)
+}
+
+// startImport queues an import job for an uploaded export and answers 202 with the job to poll
+func (h *NotesHandler) startImport(w http.ResponseWriter, r *http.Request, source string) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	data, ok := readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	// Catch the wrong file right away, the job reports anything else wrong with it
+	switch source {
+	case ImportSourceENEX:
+		if !bytes.Contains(data[:min(len(data), 4096)], []byte("<en-export")) {
+			utils.Error(w, http.StatusBadRequest, "the file is not an Evernote export")
+			return
+		}
+	case ImportSourceKeep:
+		if _, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+			utils.Error(w, http.StatusBadRequest, "the archive is not a valid zip file")
+			return
+		}
+	}
+
+	job, err := h.imports.jobs.CreateImportJob(r.Context(), userID, source, data)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to start the import")
+		return
+	}
+	h.imports.Wake()
+
+	w.Header().Set("Location", "/api/notes/import/jobs/"+job.ID.String())
+	utils.JSON(w, http.StatusAccepted, job)
+}
+
+// NotesHandler to list the latest import jobs of the user
+func (h *NotesHandler) listImportJobs(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	jobs, err := h.imports.jobs.ListImportJobs(r.Context(), userID, 50)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to list imports")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, jobs)
+}
+
+// NotesHandler to get the progress of an import job, and its report once it finished
+func (h *NotesHandler) getImportJob(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	id, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "import not found")
+		return
+	}
+
+	job, err := h.imports.jobs.GetImportJob(r.Context(), userID, id)
+	if errors.Is(err, ErrImportJobNotFound) {
+		utils.Error(w, http.StatusNotFound, "import not found")
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to get the import")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, job)
+}
+
+// Request struct for adding a checklist item
+type AddChecklistItemRequest struct {
+	Text     string     `json:"text"`
+	Checked  bool       `json:"checked"`
+	ParentID *uuid.UUID `json:"parentId"` // top-level item to nest it under
+	Position *int       `json:"position"` // among its siblings, at the end when omitted
+}
+
+// Request struct for changing a checklist item, omitted fields are left unchanged
+type UpdateChecklistItemRequest struct {
+	Text    *string `json:"text"`
+	Checked *bool   `json:"checked"`
+}
+
+// Request struct for moving a checklist item
+type MoveChecklistItemRequest struct {
+	ParentID *uuid.UUID `json:"parentId"` // top-level item to nest it under, null for the top level
+	Position int        `json:"position"` // among its new siblings
+}
+
+// Response struct for a changed checklist item, with the whole checklist after the change
+type ChecklistItemResponse struct {
+	Item *ChecklistItem `json:"item"`
+	*Checklist
+}
+
+// checklistError writes the response for an error reading or changing a checklist
+func checklistError(w http.ResponseWriter, err error) {
+	switch {
+	case utils.IsValidationError(err):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNoteNotFound):
+		utils.Error(w, http.StatusNotFound, "note not found")
+	case errors.Is(err, ErrChecklistItemNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrReadOnly):
+		utils.Error(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, ErrEncrypted):
+		utils.Error(w, http.StatusConflict, "encrypted notes keep their checklist in their encrypted content")
+	case errors.Is(err, ErrChecklistFull):
+		utils.Error(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, "can't access checklist")
+	}
+}
+
+// checklistItemParams reads the note and item IDs of the URL, writing a 400 when invalid
+func checklistItemParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	itemID, err := uuid.Parse(chi.URLParam(r, "itemID"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid item ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return id, itemID, true
+}
+
+// writeChecklistItem responds with a changed item and the checklist, tagged with the new version of the note
+func writeChecklistItem(w http.ResponseWriter, status int, itemID uuid.UUID, checklist *Checklist) {
+	w.Header().Set("ETag", utils.ETag(checklist.Version))
+	utils.JSON(w, status, ChecklistItemResponse{Item: checklist.Find(itemID), Checklist: checklist})
+}
+
+// NotesHandler to get the checklist of a note with its done and total counts
+func (h *NotesHandler) getChecklist(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	checklist, err := h.repo.GetChecklist(r.Context(), userID, id)
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", utils.ETag(checklist.Version))
+	if utils.IfNoneMatch(r, checklist.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, checklist)
+}
+
+// NotesHandler to add an item to the checklist of a note, without rewriting the note
+func (h *NotesHandler) addChecklistItem(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req AddChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	text, err := validateChecklistText(req.Text)
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	item := &ChecklistItem{ParentID: req.ParentID, Text: text, Checked: req.Checked}
+	checklist, err := h.repo.AddChecklistItem(r.Context(), userID, id, item, req.Position)
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	writeChecklistItem(w, http.StatusCreated, item.ID, checklist)
+}
+
+// NotesHandler to change the text of a checklist item or check it
+func (h *NotesHandler) updateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, ok := checklistItemParams(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req UpdateChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Text != nil {
+		text, err := validateChecklistText(*req.Text)
+		if err != nil {
+			checklistError(w, err)
+			return
+		}
+		req.Text = &text
+	}
+
+	checklist, err := h.repo.UpdateChecklistItem(r.Context(), userID, id, itemID, ChecklistChange{Text: req.Text, Checked: req.Checked})
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	writeChecklistItem(w, http.StatusOK, itemID, checklist)
+}
+
+// NotesHandler to check a checklist item, or uncheck it when it is checked
+func (h *NotesHandler) toggleChecklistItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, ok := checklistItemParams(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	checklist, err := h.repo.UpdateChecklistItem(r.Context(), userID, id, itemID, ChecklistChange{Toggle: true})
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	writeChecklistItem(w, http.StatusOK, itemID, checklist)
+}
+
+// NotesHandler to move a checklist item to another position or parent, its siblings close up around it
+func (h *NotesHandler) moveChecklistItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, ok := checklistItemParams(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req MoveChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Position < 0 {
+		utils.Error(w, http.StatusBadRequest, "position must be at least 0")
+		return
+	}
+
+	checklist, err := h.repo.MoveChecklistItem(r.Context(), userID, id, itemID, req.ParentID, req.Position)
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	writeChecklistItem(w, http.StatusOK, itemID, checklist)
+}
+
+// NotesHandler to delete a checklist item with its children
+func (h *NotesHandler) deleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, ok := checklistItemParams(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	checklist, err := h.repo.DeleteChecklistItem(r.Context(), userID, id, itemID)
+	if err != nil {
+		checklistError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", utils.ETag(checklist.Version))
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// Response struct for the notes linking to a note
+type BacklinksResponse struct {
+	Backlinks []*Backlink `json:"backlinks"`
+}
+
+// Response struct for the broken wiki links of notes
+type BrokenLinksResponse struct {
+	Links []*BrokenLink `json:"links"`
+}
+
+// NotesHandler to list the notes linking to a note with [[Note Title]] or [[note-id]]
+func (h *NotesHandler) listBacklinks(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid note ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	list, err := h.repo.Backlinks(r.Context(), userID, id)
+	if errors.Is(err, ErrNoteNotFound) {
+		utils.Error(w, http.StatusNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access links")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, BacklinksResponse{Backlinks: list})
+}
+
+// NotesHandler to list the wiki links of the user's notes that lead nowhere, of one note with note_id
+func (h *NotesHandler) listBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var noteID *uuid.UUID
+	if value := r.URL.Query().Get("note_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			utils.Error(w, http.StatusBadRequest, "invalid note_id")
+			return
+		}
+		noteID = &id
+	}
+
+	list, err := h.repo.BrokenLinks(r.Context(), userID, noteID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access links")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, BrokenLinksResponse{Links: list})
+}
+
+// NotesHandler to get the user's notes and the wiki links between them as a graph
+func (h *NotesHandler) getGraph(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	graph, err := h.repo.Graph(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access links")
 		return
 	}
 
-	utils.JSON(w, http.StatusOK, existing)
+	utils.JSON(w, http.StatusOK, graph)
 }
@@ -0,0 +1,369 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Sources of an import job
+const (
+	ImportSourceENEX = "enex" // Evernote export
+	ImportSourceKeep = "keep" // Google Keep Takeout zip
+)
+
+// States of an import job
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ErrImportJobNotFound is returned when an import job doesn't exist or belongs to another user
+var ErrImportJobNotFound = errors.New("import not found")
+
+// ErrImportJobLost is returned when a worker saves progress of a job another worker took over
+var ErrImportJobLost = errors.New("the import is run by another worker")
+
+// ImportJob is an import running in the background. Processed counts the notes of the export
+// handled so far out of Total, Report lists what happened to them.
+type ImportJob struct {
+	ID         uuid.UUID     `json:"id"`
+	UserID     uuid.UUID     `json:"-"`
+	Source     string        `json:"source"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Report     *ImportReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Attempts   int           `json:"-"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	StartedAt  *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+}
+
+// importJobColumns is the column list selected for an ImportJob, in scanImportJob order
+const importJobColumns = `id, user_id, source, status, total, processed, report, COALESCE(error, ''), attempts,
+	created_at, started_at, finished_at`
+
+func scanImportJob(row pgx.Row, j *ImportJob, extra ...interface{}) error {
+	dest := append([]interface{}{
+		&j.ID, &j.UserID, &j.Source, &j.Status, &j.Total, &j.Processed, &j.Report, &j.Error, &j.Attempts,
+		&j.CreatedAt, &j.StartedAt, &j.FinishedAt,
+	}, extra...)
+	return row.Scan(dest...)
+}
+
+// Repository Interface for import jobs
+type ImportJobsRepository interface {
+	CreateImportJob(ctx context.Context, userID uuid.UUID, source string, data []byte) (*ImportJob, error)
+	GetImportJob(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*ImportJob, error)
+	ListImportJobs(ctx context.Context, userID uuid.UUID, limit int) ([]*ImportJob, error)
+	ClaimImportJob(ctx context.Context, token uuid.UUID, staleAfter time.Duration) (*ImportJob, []byte, error)
+	SaveImportProgress(ctx context.Context, job *ImportJob, token uuid.UUID) error
+	FinishImportJob(ctx context.Context, job *ImportJob, token uuid.UUID) error
+}
+
+// Postgres Repository for import jobs
+type ImportJobsPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewImportJobsPostgresRepository(db *pgxpool.Pool) *ImportJobsPostgresRepository {
+	return &ImportJobsPostgresRepository{db: db}
+}
+
+// CreateImportJob queues an import of an uploaded export
+func (p *ImportJobsPostgresRepository) CreateImportJob(ctx context.Context, userID uuid.UUID, source string, data []byte) (*ImportJob, error) {
+	query := `
+	INSERT INTO import_jobs(user_id, source, data)
+	VALUES ($1, $2, $3)
+	RETURNING ` + importJobColumns
+
+	var j ImportJob
+	if err := scanImportJob(p.db.QueryRow(ctx, query, userID, source, data), &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// GetImportJob returns an import job of the user
+func (p *ImportJobsPostgresRepository) GetImportJob(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*ImportJob, error) {
+	query := `SELECT ` + importJobColumns + ` FROM import_jobs WHERE id = $1 AND user_id = $2`
+
+	var j ImportJob
+	err := scanImportJob(p.db.QueryRow(ctx, query, id, userID), &j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrImportJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ListImportJobs lists the latest import jobs of the user, newest first
+func (p *ImportJobsPostgresRepository) ListImportJobs(ctx context.Context, userID uuid.UUID, limit int) ([]*ImportJob, error) {
+	query := `
+	SELECT ` + importJobColumns + `
+	FROM import_jobs
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	LIMIT $2
+	`
+
+	rows, err := p.db.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*ImportJob{}
+	for rows.Next() {
+		var j ImportJob
+		if err := scanImportJob(rows, &j); err != nil {
+			return nil, err
+		}
+		list = append(list, &j)
+	}
+
+	return list, rows.Err()
+}
+
+// ClaimImportJob hands the oldest queued job, or a running job without progress for staleAfter,
+// to the worker identified by token. It returns a nil job when there is nothing to run.
+// SKIP LOCKED lets several server instances claim jobs at the same time without taking the same one.
+func (p *ImportJobsPostgresRepository) ClaimImportJob(ctx context.Context, token uuid.UUID, staleAfter time.Duration) (*ImportJob, []byte, error) {
+	query := `
+	UPDATE import_jobs
+	SET status = 'running', claim_token = $1, heartbeat_at = NOW(), attempts = attempts + 1,
+		started_at = COALESCE(started_at, NOW())
+	WHERE id = (
+		SELECT id FROM import_jobs
+		WHERE status = 'queued' OR (status = 'running' AND heartbeat_at < NOW() - $2::interval)
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + importJobColumns + `, data`
+
+	var j ImportJob
+	var data []byte
+	err := scanImportJob(p.db.QueryRow(ctx, query, token, staleAfter), &j, &data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &j, data, nil
+}
+
+// SaveImportProgress saves the total, progress and report of a running job.
+// It returns ErrImportJobLost once the job was taken over by another worker.
+func (p *ImportJobsPostgresRepository) SaveImportProgress(ctx context.Context, job *ImportJob, token uuid.UUID) error {
+	query := `
+	UPDATE import_jobs
+	SET total = $3, processed = $4, report = $5, heartbeat_at = NOW()
+	WHERE id = $1 AND claim_token = $2 AND status = 'running'
+	`
+
+	cmd, err := p.db.Exec(ctx, query, job.ID, token, job.Total, job.Processed, job.Report)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrImportJobLost
+	}
+	return nil
+}
+
+// FinishImportJob saves the final state of a job, completed or failed, and drops its upload
+func (p *ImportJobsPostgresRepository) FinishImportJob(ctx context.Context, job *ImportJob, token uuid.UUID) error {
+	query := `
+	UPDATE import_jobs
+	SET status = $3, total = $4, processed = $5, report = $6, error = NULLIF($7, ''),
+		data = NULL, claim_token = NULL, finished_at = NOW()
+	WHERE id = $1 AND claim_token = $2 AND status = 'running'
+	RETURNING finished_at
+	`
+
+	err := p.db.QueryRow(ctx, query, job.ID, token, job.Status, job.Total, job.Processed, job.Report, job.Error).
+		Scan(&job.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrImportJobLost
+	}
+	return err
+}
+
+// Timing of the import runner
+const (
+	ImportPollInterval       = 30 * time.Second // how often the runner looks for jobs when not woken up
+	importStaleAfter         = 5 * time.Minute  // a running job without progress for this long is taken over
+	importCheckpointInterval = 10 * time.Second // how often a running job saves its progress
+	maxImportAttempts        = 3                // runs of a job before it is given up
+)
+
+// ImportRunner runs the queued import jobs in the background. Every server instance can run one,
+// a job is run by one of them at a time and resumed by another if its worker stops.
+type ImportRunner struct {
+	h    *NotesHandler
+	jobs ImportJobsRepository
+	wake chan struct{}
+}
+
+func newImportRunner(h *NotesHandler, jobs ImportJobsRepository) *ImportRunner {
+	return &ImportRunner{h: h, jobs: jobs, wake: make(chan struct{}, 1)}
+}
+
+// Wake asks the runner to look for jobs soon, without waiting for the next interval
+func (ir *ImportRunner) Wake() {
+	select {
+	case ir.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs pending jobs right away and then on every wake up or ImportPollInterval until ctx is done
+func (ir *ImportRunner) Run(ctx context.Context) {
+	ticker := time.NewTicker(ImportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ir.runPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ir.wake:
+		}
+	}
+}
+
+// runPending runs jobs until none is left, errors are logged and the jobs retried later
+func (ir *ImportRunner) runPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		token := uuid.New()
+		job, data, err := ir.jobs.ClaimImportJob(ctx, token, importStaleAfter)
+		if err != nil {
+			log.Printf("notes: claiming import job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		if err := ir.run(ctx, job, data, token); err != nil {
+			log.Printf("notes: import job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// run imports the notes of a job from where a previous run left off. An error leaves the job
+// running, another run resumes it once it is stale, up to maxImportAttempts runs.
+func (ir *ImportRunner) run(ctx context.Context, job *ImportJob, data []byte, token uuid.UUID) error {
+	if job.Attempts > maxImportAttempts {
+		job.Status, job.Error = ImportFailed, "the import failed repeatedly"
+		return ir.jobs.FinishImportJob(ctx, job, token)
+	}
+
+	var items []*importItem
+	var err error
+	switch job.Source {
+	case ImportSourceENEX:
+		items, err = parseENEX(data)
+	case ImportSourceKeep:
+		items, err = parseKeepTakeout(data, ir.h.maxImportFileBytes())
+	default:
+		err = fmt.Errorf("unknown import source %q", job.Source)
+	}
+	if err != nil {
+		job.Status, job.Error = ImportFailed, err.Error()
+		return ir.jobs.FinishImportJob(ctx, job, token)
+	}
+
+	im := newImporter(ir.h, job.UserID, nil)
+	if job.Report != nil {
+		im.report = job.Report
+	}
+	job.Report = im.report
+	job.Total = len(items)
+	if err := ir.jobs.SaveImportProgress(ctx, job, token); err != nil {
+		return err
+	}
+
+	saved := time.Now()
+	for job.Processed < len(items) {
+		if err := im.importItem(ctx, job.ID, job.Processed, items[job.Processed]); err != nil {
+			return err
+		}
+		job.Processed++
+
+		if time.Since(saved) >= importCheckpointInterval {
+			if err := ir.jobs.SaveImportProgress(ctx, job, token); err != nil {
+				return err
+			}
+			saved = time.Now()
+		}
+	}
+
+	job.Status = ImportCompleted
+	return ir.jobs.FinishImportJob(ctx, job, token)
+}
+
+// importItem creates the note of the item at index of an import job. The ID of the note derives
+// from the job and index, so a resumed job finds the notes it created before instead of duplicating them.
+func (im *importer) importItem(ctx context.Context, jobID uuid.UUID, index int, item *importItem) error {
+	if item.skip != "" {
+		im.skip(item.name, item.skip)
+		return nil
+	}
+	note, ok := im.prepare(item.name, item.fm, item.body)
+	if !ok {
+		return nil
+	}
+
+	note.ID = uuid.NewSHA1(jobID, []byte(strconv.Itoa(index)))
+	note.UserID = im.userID
+	created, err := im.h.repo.Create(ctx, note)
+	if errors.Is(err, ErrNoteExists) {
+		created, err = im.h.repo.Get(ctx, im.userID, note.ID.String())
+		if errors.Is(err, ErrNoteNotFound) {
+			im.skip(item.name, "the note was deleted during the import")
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// A resumed job may have set the checklist already
+	if created.ChecklistTotal == 0 {
+		_, tasks := splitChecklist(item.fm, item.body)
+		if err := im.setChecklist(ctx, created, tasks); err != nil {
+			return err
+		}
+	}
+	if err := im.setStates(ctx, created, item.fm); err != nil {
+		return err
+	}
+	if err := im.h.repo.SetDates(ctx, im.userID, created.ID, item.fm.Created, item.fm.Updated); err != nil {
+		return err
+	}
+
+	im.report.Created = append(im.report.Created, ImportedNote{ID: created.ID, Path: item.name})
+	for _, warning := range item.warnings {
+		im.report.Warnings = append(im.report.Warnings, SkippedFile{Path: item.name, Reason: warning})
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package notes
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxKeepTitleLength is the length of a title taken from the first line of an untitled Keep note
+const maxKeepTitleLength = 80
+
+// keepNote is a note of a Google Keep Takeout export, one JSON file per note
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Annotations []struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"annotations"`
+	Attachments []struct {
+		FilePath string `json:"filePath"`
+	} `json:"attachments"`
+	IsPinned                bool  `json:"isPinned"`
+	IsArchived              bool  `json:"isArchived"`
+	IsTrashed               bool  `json:"isTrashed"`
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+}
+
+// parseKeepTakeout reads the notes of a Google Keep Takeout zip, the JSON files of its Keep folder,
+// each of at most maxFileBytes. The HTML copies and attachment files next to them are ignored.
+func parseKeepTakeout(data []byte, maxFileBytes int) ([]*importItem, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("the archive is not a valid zip file")
+	}
+	if len(archive.File) > MaxImportFiles {
+		return nil, fmt.Errorf("archives are limited to %d files", MaxImportFiles)
+	}
+
+	items := []*importItem{}
+	for _, f := range archive.File {
+		name, ok := importPath(f.Name)
+		if !ok || strings.ToLower(path.Ext(name)) != ".json" {
+			continue
+		}
+
+		item := &importItem{name: name}
+		items = append(items, item)
+
+		data, err := readImportFile(f, maxFileBytes)
+		if err != nil {
+			item.skip = err.Error()
+			continue
+		}
+		var n keepNote
+		if err := json.Unmarshal(data, &n); err != nil {
+			item.skip = "not a Keep note"
+			continue
+		}
+		keepItem(item, &n)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("the archive has no Keep notes")
+	}
+	return items, nil
+}
+
+// keepItem converts a Keep note: checklists become checklists of the note, labels become tags
+// and links the note refers to are listed at the end
+func keepItem(item *importItem, n *keepNote) {
+	if n.IsTrashed {
+		item.skip = "the note is in the Keep trash"
+		return
+	}
+
+	var body strings.Builder
+	body.WriteString(strings.TrimSpace(n.TextContent))
+	if len(n.ListContent) > 0 {
+		if body.Len() > 0 {
+			body.WriteString("\n\n")
+		}
+		for _, entry := range n.ListContent {
+			box := "[ ]"
+			if entry.IsChecked {
+				box = "[x]"
+			}
+			body.WriteString("- " + box + " " + strings.Join(strings.Fields(entry.Text), " ") + "\n")
+		}
+	}
+	if len(n.Annotations) > 0 {
+		body.WriteString("\n\n")
+		for _, link := range n.Annotations {
+			title := link.Title
+			if title == "" {
+				title = link.URL
+			}
+			body.WriteString("- [" + title + "](" + link.URL + ")\n")
+		}
+	}
+	item.body = strings.TrimSpace(body.String())
+
+	fm := &frontMatter{
+		Title:    strings.TrimSpace(n.Title),
+		Pinned:   n.IsPinned,
+		Archived: n.IsArchived,
+		// The checklist ends the body unless links follow it, then it stays a task list in the content
+		Checklist: len(n.ListContent) > 0 && len(n.Annotations) == 0,
+	}
+	if fm.Title == "" {
+		fm.Title = keepTitle(item.body, item.name)
+	}
+	for _, label := range n.Labels {
+		fm.Tags = append(fm.Tags, label.Name)
+	}
+	if n.CreatedTimestampUsec > 0 {
+		t := time.UnixMicro(n.CreatedTimestampUsec).UTC()
+		fm.Created = &t
+	}
+	if n.UserEditedTimestampUsec > 0 {
+		t := time.UnixMicro(n.UserEditedTimestampUsec).UTC()
+		fm.Updated = &t
+	}
+	item.fm = fm
+
+	if len(n.Attachments) > 0 {
+		item.warnings = append(item.warnings, fmt.Sprintf("%d attachments were not imported", len(n.Attachments)))
+	}
+}
+
+// keepTitle titles an untitled Keep note after the first line of its body, or its file when the body is empty
+func keepTitle(body, name string) string {
+	line, _, _ := strings.Cut(body, "\n")
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, "- [ ] "), "- [x] "))
+	if line == "" {
+		return strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	if len(line) > maxKeepTitleLength {
+		line = strings.ToValidUTF8(line[:maxKeepTitleLength], "") + "…"
+	}
+	return line
+}
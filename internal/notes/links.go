@@ -0,0 +1,469 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxNoteLinks is how many distinct wiki links of a note are stored, later links are ignored
+const MaxNoteLinks = 1000
+
+// Kinds of wiki links
+const (
+	LinkByID    = "id"    // [[note-id]]
+	LinkByTitle = "title" // [[Note Title]]
+)
+
+// wikiLink matches [[target]], optionally followed by a #heading and a |label inside the brackets
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]|#\n]+)(#[^\[\]|\n]*)?(\|[^\[\]\n]*)?\]\]`)
+
+// Backlink is a note linking to another note
+type Backlink struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// BrokenLink is a wiki link no note matches, or to a note in the trash
+type BrokenLink struct {
+	NoteID    uuid.UUID  `json:"noteId"` // note the link is in
+	NoteTitle string     `json:"noteTitle"`
+	Kind      string     `json:"kind"`
+	Target    string     `json:"target"`              // note ID or title as written in the link
+	TrashedID *uuid.UUID `json:"trashedId,omitempty"` // note in the trash the link pointed to
+}
+
+// GraphNode is a note of the link graph
+type GraphNode struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"` // empty for encrypted notes, their title is in titleCiphertext
+	Archived  bool      `json:"archived"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// GraphEdge is a wiki link from one note to another
+type GraphEdge struct {
+	Source uuid.UUID `json:"source"`
+	Target uuid.UUID `json:"target"`
+}
+
+// Graph is the notes of a user and the links between them
+type Graph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// wikiTarget is the target of a wiki link
+type wikiTarget struct {
+	Kind string
+	Text string // note ID in canonical form or title
+}
+
+// linkTarget reads the target of a wiki link: a note ID, or a title otherwise
+func linkTarget(text string) wikiTarget {
+	text = strings.TrimSpace(text)
+	if len(text) == 36 {
+		if id, err := uuid.Parse(text); err == nil {
+			return wikiTarget{Kind: LinkByID, Text: id.String()}
+		}
+	}
+	return wikiTarget{Kind: LinkByTitle, Text: text}
+}
+
+// linkableTitle reports whether a title can be the target of a [[Note Title]] link
+func linkableTitle(title string) bool {
+	return strings.TrimSpace(title) == title && title != "" &&
+		!strings.ContainsAny(title, "[]|#\n") && linkTarget(title).Kind == LinkByTitle
+}
+
+// mapWikiLinks replaces the wiki links of content with the result of replace, leaving code blocks alone
+func mapWikiLinks(content string, replace func(link string, match []string) string) string {
+	var out strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case strings.Contains(line, "[["):
+			line = wikiLink.ReplaceAllStringFunc(line, func(link string) string {
+				return replace(link, wikiLink.FindStringSubmatch(link))
+			})
+		}
+		out.WriteString(line)
+	}
+	return out.String()
+}
+
+// parseWikiLinks returns the distinct targets of the wiki links of content in order of appearance.
+// Titles are told apart case-insensitively, links in code blocks are ignored.
+func parseWikiLinks(content string) []wikiTarget {
+	if !strings.Contains(content, "[[") {
+		return nil
+	}
+
+	targets := []wikiTarget{}
+	seen := map[wikiTarget]bool{}
+	mapWikiLinks(content, func(link string, match []string) string {
+		target := linkTarget(match[1])
+		key := wikiTarget{Kind: target.Kind, Text: strings.ToLower(target.Text)}
+		if target.Text != "" && !seen[key] && len(targets) < MaxNoteLinks {
+			seen[key] = true
+			targets = append(targets, target)
+		}
+		return link
+	})
+	return targets
+}
+
+// rewriteWikiLinks points the [[Old Title]] links of content at a renamed note, keeping their heading and label.
+// The links get the ID of the note when its new title can't be written in a link.
+func rewriteWikiLinks(content string, oldTitle, newTitle string, id uuid.UUID) string {
+	target := newTitle
+	if !linkableTitle(newTitle) {
+		target = id.String()
+	}
+	return mapWikiLinks(content, func(link string, match []string) string {
+		if t := linkTarget(match[1]); t.Kind != LinkByTitle || !strings.EqualFold(t.Text, oldTitle) {
+			return link
+		}
+		return "[[" + target + match[2] + match[3] + "]]"
+	})
+}
+
+// resolveLinkSQL selects the note a link of table resolves to among the notes of userArg:
+// the note with its ID, or the oldest note in use with its title
+func resolveLinkSQL(table, userArg string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s.kind = 'id' THEN (
+		SELECT n.id FROM notes n WHERE n.id = %[1]s.target_text::uuid AND n.user_id = %[2]s
+	) ELSE (
+		SELECT n.id FROM notes n
+		WHERE n.user_id = %[2]s AND LOWER(n.title) = LOWER(%[1]s.target_text) AND n.deleted_at IS NULL
+		ORDER BY n.created_at, n.id
+		LIMIT 1
+	) END`, table, userArg)
+}
+
+// saveLinks replaces the stored wiki links of a note with the links of its content, resolved among the notes
+// of its owner. Encrypted notes have no links, the server can't read them.
+func saveLinks(ctx context.Context, tx pgx.Tx, ownerID, noteID uuid.UUID, content string, encrypted bool) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM note_links WHERE source_id = $1`, noteID); err != nil {
+		return err
+	}
+
+	var targets []wikiTarget
+	if !encrypted {
+		targets = parseWikiLinks(content)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	kinds := make([]string, len(targets))
+	texts := make([]string, len(targets))
+	for i, t := range targets {
+		kinds[i], texts[i] = t.Kind, t.Text
+	}
+
+	_, err := tx.Exec(ctx, `
+	INSERT INTO note_links(source_id, kind, target_text, target_id)
+	SELECT $1, t.kind, t.target_text, `+resolveLinkSQL("t", "$2")+`
+	FROM UNNEST($3::text[], $4::text[]) AS t(kind, target_text)
+	`, noteID, ownerID, kinds, texts)
+	return err
+}
+
+// resolveBrokenLinks resolves the broken links of the notes of a user to the ID or title of a note,
+// after it was created or renamed. Only links naming the note are looked at, so an import stays linear.
+func resolveBrokenLinks(ctx context.Context, tx pgx.Tx, ownerID, noteID uuid.UUID, title string) error {
+	_, err := tx.Exec(ctx, `
+	WITH resolved AS (
+		SELECT l.source_id, l.kind, l.target_text, `+resolveLinkSQL("l", "$1")+` AS target_id
+		FROM note_links l JOIN notes s ON s.id = l.source_id
+		WHERE s.user_id = $1 AND l.target_id IS NULL
+			AND ((l.kind = 'title' AND LOWER(l.target_text) = LOWER($2))
+				OR (l.kind = 'id' AND LOWER(l.target_text) = $3))
+	)
+	UPDATE note_links l
+	SET target_id = r.target_id
+	FROM resolved r
+	WHERE l.source_id = r.source_id AND l.kind = r.kind AND l.target_text = r.target_text
+		AND r.target_id IS NOT NULL
+	`, ownerID, title, noteID.String())
+	return err
+}
+
+// relinkTitle updates the title links of a user after a note was renamed: links to its old title
+// lose it, they move to another note with that title or break, and broken links to its new title
+// resolve to it
+func relinkTitle(ctx context.Context, tx pgx.Tx, ownerID, noteID uuid.UUID, title string) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE note_links
+	SET target_id = NULL
+	WHERE target_id = $1 AND kind = 'title' AND LOWER(target_text) <> LOWER($2)
+	`, noteID, title)
+	if err != nil {
+		return err
+	}
+	return resolveBrokenLinks(ctx, tx, ownerID, noteID, title)
+}
+
+// RewriteLinks points the [[Old Title]] links of the other notes of the owner at a note after it
+// was renamed from oldTitle, saving a revision of each note it changes. Only the owner can rewrite links.
+// It returns how many notes were changed.
+func (p *NotesPostgresRepository) RewriteLinks(ctx context.Context, userID uuid.UUID, id uuid.UUID, oldTitle string) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkOwner(ctx, tx, userID, id); err != nil {
+		return 0, err
+	}
+
+	var title string
+	var encrypted bool
+	if err := tx.QueryRow(ctx, `SELECT title, encrypted FROM notes WHERE id = $1`, id).Scan(&title, &encrypted); err != nil {
+		return 0, err
+	}
+	if encrypted {
+		return 0, ErrEncrypted
+	}
+	if strings.EqualFold(title, oldTitle) {
+		return 0, nil
+	}
+
+	// Links to the old title that no other note took over
+	rows, err := tx.Query(ctx, `
+	SELECT DISTINCT l.source_id
+	FROM note_links l JOIN notes s ON s.id = l.source_id
+	WHERE s.user_id = $1 AND s.deleted_at IS NULL AND l.source_id <> $2 AND l.kind = 'title'
+		AND LOWER(l.target_text) = LOWER($3) AND (l.target_id IS NULL OR l.target_id = $2)
+	`, userID, id, oldTitle)
+	if err != nil {
+		return 0, err
+	}
+	sources, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, sourceID := range sources {
+		current, err := lockNote(ctx, tx, userID, sourceID)
+		if err != nil {
+			return 0, err
+		}
+		if current.Encrypted {
+			continue
+		}
+		content := rewriteWikiLinks(current.Content, oldTitle, title, id)
+		if content == current.Content {
+			continue
+		}
+
+		revision, err := p.snapshot(ctx, tx, sourceID, current)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(ctx, `
+		UPDATE notes
+		SET content = $2, revision = $3, updated_at = NOW()
+		WHERE id = $1
+		`, sourceID, content, revision)
+		if err != nil {
+			return 0, err
+		}
+		if err := saveLinks(ctx, tx, userID, sourceID, content, false); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+
+	return changed, tx.Commit(ctx)
+}
+
+// Backlinks lists the notes linking to a note that the user can access, most recently updated first
+func (p *NotesPostgresRepository) Backlinks(ctx context.Context, userID uuid.UUID, id uuid.UUID) ([]*Backlink, error) {
+	query := `
+	SELECT s.id, s.title, s.updated_at
+	FROM notes s
+	WHERE s.deleted_at IS NULL AND (` + permissionSQL("s", "$2") + `) IS NOT NULL
+		AND EXISTS(SELECT 1 FROM note_links l WHERE l.source_id = s.id AND l.target_id = $1)
+	ORDER BY s.updated_at DESC, s.id
+	`
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkOwner(ctx, tx, userID, id); err != nil && !errors.Is(err, ErrNotOwner) {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Backlink{}
+	for rows.Next() {
+		var b Backlink
+		if err := rows.Scan(&b.ID, &b.Title, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, &b)
+	}
+
+	return list, rows.Err()
+}
+
+// BrokenLinks lists the wiki links of the notes of a user that don't lead to a note in use,
+// of a single note when noteID isn't nil
+func (p *NotesPostgresRepository) BrokenLinks(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID) ([]*BrokenLink, error) {
+	query := `
+	SELECT s.id, s.title, l.kind, l.target_text, l.target_id
+	FROM note_links l
+	JOIN notes s ON s.id = l.source_id
+	LEFT JOIN notes t ON t.id = l.target_id
+	WHERE s.user_id = $1 AND s.deleted_at IS NULL AND ($2::uuid IS NULL OR s.id = $2)
+		AND (t.id IS NULL OR t.deleted_at IS NOT NULL)
+	ORDER BY LOWER(s.title), s.id, l.kind, LOWER(l.target_text)
+	`
+
+	rows, err := p.db.Query(ctx, query, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*BrokenLink{}
+	for rows.Next() {
+		var b BrokenLink
+		if err := rows.Scan(&b.NoteID, &b.NoteTitle, &b.Kind, &b.Target, &b.TrashedID); err != nil {
+			return nil, err
+		}
+		list = append(list, &b)
+	}
+
+	return list, rows.Err()
+}
+
+// Graph returns the notes of a user in use and the wiki links between them
+func (p *NotesPostgresRepository) Graph(ctx context.Context, userID uuid.UUID) (*Graph, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	// Nodes and edges from the same snapshot, so every edge has its nodes
+	if _, err := tx.Exec(ctx, `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY`); err != nil {
+		return nil, err
+	}
+
+	graph := &Graph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+
+	rows, err := tx.Query(ctx, `
+	SELECT id, title, archived_at IS NOT NULL, encrypted
+	FROM notes
+	WHERE user_id = $1 AND deleted_at IS NULL
+	ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var n GraphNode
+		if err := rows.Scan(&n.ID, &n.Title, &n.Archived, &n.Encrypted); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		graph.Nodes = append(graph.Nodes, &n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, `
+	SELECT DISTINCT l.source_id, l.target_id
+	FROM note_links l
+	JOIN notes s ON s.id = l.source_id
+	JOIN notes t ON t.id = l.target_id
+	WHERE s.user_id = $1 AND s.deleted_at IS NULL AND t.deleted_at IS NULL
+	ORDER BY l.source_id, l.target_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e GraphEdge
+		if err := rows.Scan(&e.Source, &e.Target); err != nil {
+			return nil, err
+		}
+		graph.Edges = append(graph.Edges, &e)
+	}
+
+	return graph, rows.Err()
+}
+
+// BackfillLinks saves the links of up to limit notes queued in note_links_backfill, the notes written
+// before links were stored, and returns how many it did. SKIP LOCKED lets several server instances
+// work through the queue at the same time.
+func (p *NotesPostgresRepository) BackfillLinks(ctx context.Context, limit int) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT note_id FROM note_links_backfill
+	ORDER BY note_id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, err
+	}
+
+	// One note at a time so large notes aren't all in memory, locked so a save can't interleave
+	for _, id := range ids {
+		var ownerID uuid.UUID
+		var content string
+		var encrypted bool
+		err := tx.QueryRow(ctx, `SELECT user_id, content, encrypted FROM notes WHERE id = $1 FOR SHARE`, id).
+			Scan(&ownerID, &content, &encrypted)
+		if err != nil {
+			return 0, err
+		}
+		if err := saveLinks(ctx, tx, ownerID, id, content, encrypted); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM note_links_backfill WHERE note_id = ANY($1)`, ids); err != nil {
+		return 0, err
+	}
+	return len(ids), tx.Commit(ctx)
+}
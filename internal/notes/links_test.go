@@ -0,0 +1,32 @@
+package notes
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRewriteWikiLinks(t *testing.T) {
+	id := uuid.MustParse("11111111-2222-3333-4444-555555555555")
+
+	tests := []struct {
+		name     string
+		content  string
+		newTitle string
+		want     string
+	}{
+		{"plain, heading and label", "See [[Old]] and [[old#Part|label]].", "New", "See [[New]] and [[New#Part|label]]."},
+		{"other links kept", "See [[Other]] and [[Old]]", "New", "See [[Other]] and [[New]]"},
+		{"code block kept", "```\n[[Old]]\n```\n[[Old]]", "New", "```\n[[Old]]\n```\n[[New]]"},
+		{"unlinkable title", "[[Old]]", "A|B", "[[11111111-2222-3333-4444-555555555555]]"},
+		{"no links", "nothing here", "New", "nothing here"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteWikiLinks(tt.content, "Old", tt.newTitle, id); got != tt.want {
+				t.Errorf("rewriteWikiLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
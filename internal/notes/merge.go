@@ -0,0 +1,62 @@
+package notes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/subrat-dwi/shubserver/internal/diff"
+)
+
+// MergeConflict is returned with 409 when an edit based on an older revision conflicts
+// with the changes saved since. Title and content are merged with conflict markers.
+type MergeConflict struct {
+	Status          string `json:"status"`
+	Message         string `json:"message"`
+	BaseRevision    int    `json:"baseRevision"`    // revision the edit was based on
+	CurrentRevision int    `json:"currentRevision"` // revision the edit was merged with
+	Title           string `json:"title"`
+	Content         string `json:"content"`
+	Conflicts       int    `json:"conflicts"` // conflicting regions of title and content
+	Current         *Note  `json:"current"`
+}
+
+// Error returns the message of the conflict, so a conflict can be returned as an error
+func (c *MergeConflict) Error() string {
+	return c.Message
+}
+
+// Label of the submitted side in conflict markers
+const yourEditLabel = "your edit"
+
+// mergeNote merges the title and content of an edit based on revision base with the current version of the note.
+// It returns the merged note fields, a *MergeConflict when both sides changed the same lines,
+// or ErrEditNotMerged when a side changed too much to merge.
+func mergeNote(base *Revision, current *Note, title, content string) (string, string, error) {
+	currentLabel := fmt.Sprintf("revision %d", current.Revision)
+
+	mergedTitle, err := diff.Merge3(base.Title, title, current.Title, yourEditLabel, currentLabel)
+	if err != nil {
+		return "", "", fmt.Errorf("%w, %v", ErrEditNotMerged, err)
+	}
+	mergedContent, err := diff.Merge3(base.Content, content, current.Content, yourEditLabel, currentLabel)
+	if err != nil {
+		return "", "", fmt.Errorf("%w, %v", ErrEditNotMerged, err)
+	}
+
+	if conflicts := mergedTitle.Conflicts + mergedContent.Conflicts; conflicts > 0 {
+		return "", "", &MergeConflict{
+			Status: strconv.Itoa(http.StatusConflict),
+			Message: fmt.Sprintf("the note changed since revision %d and the edit conflicts with revision %d",
+				base.Revision, current.Revision),
+			BaseRevision:    base.Revision,
+			CurrentRevision: current.Revision,
+			Title:           mergedTitle.Text,
+			Content:         mergedContent.Text,
+			Conflicts:       conflicts,
+			Current:         current,
+		}
+	}
+
+	return mergedTitle.Text, mergedContent.Text, nil
+}
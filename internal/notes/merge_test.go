@@ -0,0 +1,52 @@
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/subrat-dwi/shubserver/internal/diff"
+)
+
+func TestMergeNote(t *testing.T) {
+	var rewritten strings.Builder
+	for i := 0; i <= diff.MaxEdits; i++ {
+		fmt.Fprintf(&rewritten, "line %d\n", i)
+	}
+	base := &Revision{Revision: 1, Title: "Title", Content: "a\nb\nc\n"}
+
+	tests := []struct {
+		name         string
+		current      string
+		content      string
+		want         string
+		wantConflict bool
+		wantErr      error
+	}{
+		{name: "clean", current: "A\nb\nc\n", content: "a\nb\nC\n", want: "A\nb\nC\n"},
+		{name: "conflict", current: "a\nX\nc\n", content: "a\nY\nc\n", wantConflict: true},
+		{name: "over the edit limit", current: "a\nb\nc\n", content: rewritten.String(), wantErr: ErrEditNotMerged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &Note{Revision: 2, Title: "Title", Content: tt.current}
+			_, content, err := mergeNote(base, current, "Title", tt.content)
+
+			var conflict *MergeConflict
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("mergeNote() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantConflict:
+				if !errors.As(err, &conflict) || conflict.Conflicts != 1 {
+					t.Errorf("mergeNote() error = %v, want one conflict", err)
+				}
+			case err != nil || content != tt.want:
+				t.Errorf("mergeNote() = %q, %v, want %q", content, err, tt.want)
+			}
+		})
+	}
+}
@@ -4,13 +4,43 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/envelope"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
 )
 
 type Note struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"userID,omitempty"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt,omitempty"`
-	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"userID,omitempty"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`             // only an excerpt in lists, see Truncated
+	ContentSize int        `json:"contentSize"`         // size of the full content in bytes
+	Truncated   bool       `json:"truncated,omitempty"` // Content is an excerpt of the full content
+	Language    string     `json:"language,omitempty"`  // text search configuration, e.g. "english"
+	Tags        []string   `json:"tags"`
+	NotebookID  *uuid.UUID `json:"notebookId"`
+	Revision    int        `json:"revision"` // increases with every change of title or content
+	Version     int64      `json:"version"`  // increases with every change, sent as the ETag
+	Pinned      bool       `json:"pinned"`
+	PinOrder    *int       `json:"pinOrder,omitempty"` // position among the pinned notes
+	Archived    bool       `json:"archived"`
+	Favorite    bool       `json:"favorite"`
+	Permission  string     `json:"permission,omitempty"` // access of the requesting user, see PermissionOwner
+
+	// Checked and total items of the checklist of the note
+	ChecklistDone  int `json:"checklistDone"`
+	ChecklistTotal int `json:"checklistTotal"`
+
+	// Tasks replacing the checklist on Update, split from the end of the saved content; nil keeps it
+	checklist []markdown.Task
+
+	// End-to-end encrypted notes carry the vault envelope instead of plaintext content,
+	// and an encrypted title instead of Title when TitleCiphertext is set
+	Encrypted       bool           `json:"encrypted"`
+	Ciphertext      envelope.Bytes `json:"ciphertext,omitempty"`
+	Nonce           envelope.Bytes `json:"nonce,omitempty"`
+	TitleCiphertext envelope.Bytes `json:"titleCiphertext,omitempty"`
+	TitleNonce      envelope.Bytes `json:"titleNonce,omitempty"`
+	EncryptVersion  int            `json:"encryptVersion,omitempty"`
+	CreatedAt       time.Time      `json:"createdAt,omitempty"`
+	UpdatedAt       time.Time      `json:"updatedAt,omitempty"`
 }
@@ -5,98 +5,341 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/subrat-dwi/shubserver/internal/db"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+	"github.com/subrat-dwi/shubserver/internal/utils"
 )
 
+// ErrNoteNotFound is returned when a note doesn't exist or belongs to another user
+var ErrNoteNotFound = errors.New("Note not Found")
+
+// ErrNoteExists is returned when a note is created with the ID of an existing note
+var ErrNoteExists = errors.New("a note with this ID already exists")
+
+// ErrVersionConflict is returned when a note changed since the version a write expected
+var ErrVersionConflict = errors.New("note was changed by someone else")
+
+// ErrNotebookNotFound is returned when a note is filed into a notebook the user doesn't own
+var ErrNotebookNotFound = errors.New("notebook not found")
+
+// SortKeys are the sort keys accepted by the notes list, the first is the default
+var SortKeys = []string{"created", "updated", "title"}
+
+// ListOptions holds the pagination, sorting and filters of a notes list
+type ListOptions struct {
+	Page   *utils.PageRequest
+	Filter Filter
+}
+
+// PreviewLength is the length in characters of the content excerpt of notes in lists
+const PreviewLength = 300
+
+// noteColumns is the column list selected for a Note, in scanNote order
+var noteColumns = noteColumnList("content")
+
+// previewColumns selects a Note like noteColumns with an excerpt of its content, for lists.
+// The excerpt and OCTET_LENGTH only decompress the start of large content.
+var previewColumns = noteColumnList(fmt.Sprintf("LEFT(content, %d)", PreviewLength))
+
+func noteColumnList(content string) string {
+	return `id, title, ` + content + `, OCTET_LENGTH(content), search_language::text, notebook_id, revision, version,
+	pin_order, archived_at IS NOT NULL, favorite,
+	encrypted, ciphertext, nonce, title_ciphertext, title_nonce, COALESCE(encrypt_version, 0),
+	created_at, updated_at,
+	COALESCE((
+		SELECT array_agg(t.name ORDER BY LOWER(t.name))
+		FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id = notes.id
+	), '{}'),
+	(SELECT COUNT(*) FILTER (WHERE checked) FROM checklist_items ci WHERE ci.note_id = notes.id),
+	(SELECT COUNT(*) FROM checklist_items ci WHERE ci.note_id = notes.id)`
+}
+
+// scanNote scans a row selected with noteColumns or previewColumns, followed by any extra columns
+func scanNote(row pgx.Row, n *Note, extra ...interface{}) error {
+	dest := append([]interface{}{
+		&n.ID, &n.Title, &n.Content, &n.ContentSize, &n.Language, &n.NotebookID, &n.Revision, &n.Version,
+		&n.PinOrder, &n.Archived, &n.Favorite,
+		&n.Encrypted, (*[]byte)(&n.Ciphertext), (*[]byte)(&n.Nonce), (*[]byte)(&n.TitleCiphertext), (*[]byte)(&n.TitleNonce), &n.EncryptVersion,
+		&n.CreatedAt, &n.UpdatedAt, &n.Tags, &n.ChecklistDone, &n.ChecklistTotal,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	n.Pinned = n.PinOrder != nil
+	n.Truncated = len(n.Content) < n.ContentSize
+	return nil
+}
+
 // Repository Interface
 type NotesRepository interface {
 	Create(ctx context.Context, note *Note) (*Note, error)
 	Get(ctx context.Context, userID uuid.UUID, id string) (*Note, error)
-	List(ctx context.Context, userID uuid.UUID) ([]*Note, error)
-	Delete(ctx context.Context, userID uuid.UUID, id string) error
-	Update(ctx context.Context, userID uuid.UUID, note *Note) error
+	OpenContent(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*ContentReader, error)
+	List(ctx context.Context, userID uuid.UUID, opts *ListOptions) (*utils.Page[*Note], error)
+	Search(ctx context.Context, userID uuid.UUID, opts *SearchOptions) (*utils.Page[*SearchResult], error)
+	Delete(ctx context.Context, userID uuid.UUID, id string, expectedVersion int64) error
+	Update(ctx context.Context, userID uuid.UUID, note *Note, expectedVersion int64) error
+	ListRevisions(ctx context.Context, userID uuid.UUID, id uuid.UUID) ([]*Revision, error)
+	GetRevision(ctx context.Context, userID uuid.UUID, id uuid.UUID, revision int) (*Revision, error)
+	RestoreRevision(ctx context.Context, userID uuid.UUID, id uuid.UUID, revision int) error
+	SetPinned(ctx context.Context, userID uuid.UUID, id uuid.UUID, pinned bool) error
+	SetFavorite(ctx context.Context, userID uuid.UUID, id uuid.UUID, favorite bool) error
+	SetArchived(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, archived bool) (int64, error)
+	SetDates(ctx context.Context, userID uuid.UUID, id uuid.UUID, created, updated *time.Time) error
+	ListShares(ctx context.Context, userID uuid.UUID, id uuid.UUID) ([]*Share, error)
+	ShareNote(ctx context.Context, userID uuid.UUID, id uuid.UUID, email, permission string) (*Share, error)
+	RevokeShare(ctx context.Context, userID uuid.UUID, id uuid.UUID, recipientID uuid.UUID) error
+	ListSharedWithMe(ctx context.Context, userID uuid.UUID, page *utils.PageRequest) (*utils.Page[*SharedNote], error)
+	EncryptNotes(ctx context.Context, userID uuid.UUID, notes []*EncryptedNote) ([]uuid.UUID, error)
+	GetChecklist(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Checklist, error)
+	AddChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, item *ChecklistItem, position *int) (*Checklist, error)
+	UpdateChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, itemID uuid.UUID, change ChecklistChange) (*Checklist, error)
+	MoveChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, itemID uuid.UUID, parentID *uuid.UUID, position int) (*Checklist, error)
+	DeleteChecklistItem(ctx context.Context, userID uuid.UUID, id uuid.UUID, itemID uuid.UUID) (*Checklist, error)
+	ReplaceChecklist(ctx context.Context, userID uuid.UUID, id uuid.UUID, tasks []markdown.Task) error
+	RewriteLinks(ctx context.Context, userID uuid.UUID, id uuid.UUID, oldTitle string) (int, error)
+	Backlinks(ctx context.Context, userID uuid.UUID, id uuid.UUID) ([]*Backlink, error)
+	BrokenLinks(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID) ([]*BrokenLink, error)
+	Graph(ctx context.Context, userID uuid.UUID) (*Graph, error)
 }
 
 // Postgres Repository
 type NotesPostgresRepository struct {
-	db *pgxpool.Pool
+	db        db.Conn
+	retention RevisionRetention
+}
+
+// Postgres Repository Constructor, retention limits the revisions kept per note
+func NewNotesPostgresRepository(pool *pgxpool.Pool, retention RevisionRetention) *NotesPostgresRepository {
+	return &NotesPostgresRepository{db: pool, retention: retention}
 }
 
-// Postgres Repository Constructor
-func NewNotesPostgresRepository(db *pgxpool.Pool) *NotesPostgresRepository {
-	return &NotesPostgresRepository{db: db}
+// WithTx returns a copy of the repository running its queries in tx
+func (p *NotesPostgresRepository) WithTx(tx pgx.Tx) *NotesPostgresRepository {
+	return &NotesPostgresRepository{db: tx, retention: p.retention}
 }
 
 // ------ CRUD Implementation on DB ------
 
-// Create a new note in the database
+// Create a new note in the database. A client generated note.ID is kept,
+// ErrNoteExists is returned when a note with that ID already exists.
 func (p *NotesPostgresRepository) Create(ctx context.Context, note *Note) (*Note, error) {
 	query := `
-	INSERT INTO notes(user_id, title, content)
-	VALUES ($1, $2, $3)
-	RETURNING id, created_at, updated_at
+	INSERT INTO notes(user_id, title, content, search_language, notebook_id,
+		encrypted, ciphertext, nonce, title_ciphertext, title_nonce, encrypt_version, id)
+	VALUES ($1, $2, $3, $4::regconfig, $5, $6, $7, $8, $9, $10, $11, COALESCE($12, gen_random_uuid()))
+	ON CONFLICT (id) DO NOTHING
+	RETURNING id, revision, version, created_at, updated_at
 	`
 
 	if len(note.UserID) == 0 {
 		return nil, errors.New("UserID not available")
 	}
 
-	err := p.db.QueryRow(ctx, query, note.UserID, note.Title, note.Content).Scan(&note.ID, &note.CreatedAt, &note.UpdatedAt)
-	return note, err
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkNotebook(ctx, tx, note.UserID, note.NotebookID); err != nil {
+		return nil, err
+	}
+
+	var id *uuid.UUID
+	if note.ID != uuid.Nil {
+		id = &note.ID
+	}
+
+	args := append([]interface{}{note.UserID, note.Title, note.Content, note.Language, note.NotebookID}, encryptionArgs(note)...)
+	args = append(args, id)
+	err = tx.QueryRow(ctx, query, args...).Scan(&note.ID, &note.Revision, &note.Version, &note.CreatedAt, &note.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoteExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	note.ContentSize = len(note.Content)
+
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+	if err := setNoteTags(ctx, tx, note.UserID, note.ID, note.Tags); err != nil {
+		return nil, err
+	}
+
+	// Links of the note, and links of other notes waiting for its title or ID
+	if err := saveLinks(ctx, tx, note.UserID, note.ID, note.Content, note.Encrypted); err != nil {
+		return nil, err
+	}
+	if err := resolveBrokenLinks(ctx, tx, note.UserID, note.ID, note.Title); err != nil {
+		return nil, err
+	}
+
+	return note, tx.Commit(ctx)
 }
 
-// Delete a note from the database
-func (p *NotesPostgresRepository) Delete(ctx context.Context, userID uuid.UUID, id string) error {
+// Delete moves a note to the trash, it is purged later by the trash module. Only the owner can delete a note.
+// A non-zero expectedVersion makes it fail with ErrVersionConflict when the note changed since.
+func (p *NotesPostgresRepository) Delete(ctx context.Context, userID uuid.UUID, id string, expectedVersion int64) error {
 	query := `
-	DELETE FROM notes
-	WHERE id = $1 AND user_id = $2
+	UPDATE notes
+	SET deleted_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3)
 	`
 
-	cmd, err := p.db.Exec(ctx, query, id, userID)
+	cmd, err := p.db.Exec(ctx, query, id, userID, expectedVersion)
 
 	if err != nil {
 		return err
 	}
 
 	if cmd.RowsAffected() == 0 {
-		return errors.New("Note not Found")
+		// Tell recipients of a shared note and outdated versions apart from users without access
+		if noteID, err := uuid.Parse(id); err == nil {
+			switch err := checkOwner(ctx, p.db, userID, noteID); {
+			case err == ErrNotOwner:
+				return ErrNotOwner
+			case err == nil && expectedVersion != 0:
+				return ErrVersionConflict
+			}
+		}
+		return ErrNoteNotFound
 	}
 
 	return nil
 }
 
-// Update an existing note in the database
-func (p *NotesPostgresRepository) Update(ctx context.Context, userID uuid.UUID, note *Note) error {
+// Update an existing note in the database, replacing its tags unless note.Tags is nil.
+// Wiki links to the note follow its title: links to the old title break unless RewriteLinks rewrites them.
+// A changed title or content first snapshots the previous version as a revision,
+// except for encrypted notes: the server can't diff them and keeps no revisions of them.
+// Editors of a shared note change its title and content only, the notebook and tags stay the owner's.
+// A non-zero expectedVersion makes it fail with ErrVersionConflict when the note changed since.
+func (p *NotesPostgresRepository) Update(ctx context.Context, userID uuid.UUID, note *Note, expectedVersion int64) error {
 	query := `
 	UPDATE notes
-	SET title = $2, content = $3
-	WHERE id = $1 AND user_id = $4
+	SET title = $2, content = $3, search_language = $4::regconfig, notebook_id = $5, revision = $6,
+		encrypted = $7, ciphertext = $8, nonce = $9, title_ciphertext = $10, title_nonce = $11, encrypt_version = $12,
+		updated_at = NOW()
+	WHERE id = $1
+	RETURNING updated_at, version
 	`
 
-	cmd, err := p.db.Exec(ctx, query, note.ID, note.Title, note.Content, userID)
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
+	current, err := lockNote(ctx, tx, userID, note.ID)
 	if err != nil {
 		return err
 	}
+	if expectedVersion != 0 && current.Version != expectedVersion {
+		return ErrVersionConflict
+	}
 
-	if cmd.RowsAffected() == 0 {
-		return errors.New("Note not Found")
+	if current.Permission != PermissionOwner {
+		note.NotebookID = current.NotebookID
+		note.Tags = nil
+	}
+
+	if err := checkNotebook(ctx, tx, current.OwnerID, note.NotebookID); err != nil {
+		return err
+	}
+
+	revision := current.Revision
+	switch {
+	case current.Encrypted || note.Encrypted:
+		if current.changedBy(note) {
+			revision++
+		}
+		// Plaintext revisions and checklists must not outlive the encryption of the note
+		if note.Encrypted && !current.Encrypted {
+			if _, err := tx.Exec(ctx, `DELETE FROM note_revisions WHERE note_id = $1`, note.ID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM checklist_items WHERE note_id = $1`, note.ID); err != nil {
+				return err
+			}
+		}
+	case note.Title != current.Title || note.Content != current.Content:
+		if revision, err = p.snapshot(ctx, tx, note.ID, current); err != nil {
+			return err
+		}
+	}
+
+	args := append([]interface{}{note.ID, note.Title, note.Content, note.Language, note.NotebookID, revision}, encryptionArgs(note)...)
+	err = tx.QueryRow(ctx, query, args...).Scan(&note.UpdatedAt, &note.Version)
+	if err != nil {
+		return err
+	}
+	note.Revision = revision
+	note.ContentSize = len(note.Content)
+
+	if note.Tags != nil {
+		if err := setNoteTags(ctx, tx, current.OwnerID, note.ID, note.Tags); err != nil {
+			return err
+		}
+	}
+
+	if note.checklist != nil && !note.Encrypted {
+		if err := writeChecklist(ctx, tx, note.ID, note.checklist); err != nil {
+			return err
+		}
+		note.ChecklistTotal, note.ChecklistDone = countTasks(note.checklist)
+	}
+
+	if note.Content != current.Content || note.Encrypted != current.Encrypted {
+		if err := saveLinks(ctx, tx, current.OwnerID, note.ID, note.Content, note.Encrypted); err != nil {
+			return err
+		}
+	}
+	if note.Title != current.Title {
+		if err := relinkTitle(ctx, tx, current.OwnerID, note.ID, note.Title); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkNotebook returns ErrNotebookNotFound unless notebookID is nil or a notebook of the user
+func checkNotebook(ctx context.Context, tx pgx.Tx, userID uuid.UUID, notebookID *uuid.UUID) error {
+	if notebookID == nil {
+		return nil
+	}
+
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM notebooks WHERE id = $1 AND user_id = $2)`, *notebookID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotebookNotFound
 	}
 
 	return nil
 }
 
-// Get a specific note from the database
+// Get a specific note from the database, owned by the user or shared with them
 func (p *NotesPostgresRepository) Get(ctx context.Context, userID uuid.UUID, id string) (*Note, error) {
 	query := `
-    SELECT id, title, content, created_at, updated_at
-    FROM notes
-    WHERE id = $1 AND user_id = $2
+    SELECT ` + noteColumns + `, user_id, permission
+    FROM notes, LATERAL (SELECT ` + permissionSQL("notes", "$2") + ` AS permission) access
+    WHERE id = $1 AND deleted_at IS NULL AND permission IS NOT NULL
     `
 	var n Note
-	err := p.db.QueryRow(ctx, query, id, userID).Scan(&n.ID, &n.Title, &n.Content, &n.CreatedAt, &n.UpdatedAt)
+	err := scanNote(p.db.QueryRow(ctx, query, id, userID), &n, &n.UserID, &n.Permission)
 
 	if err != nil {
 		return nil, err
@@ -105,34 +348,260 @@ func (p *NotesPostgresRepository) Get(ctx context.Context, userID uuid.UUID, id
 	return &n, nil
 }
 
-// List all notes for a specific user from the database
-func (p *NotesPostgresRepository) List(ctx context.Context, userID uuid.UUID) ([]*Note, error) {
-	query := `
-	SELECT id, title, content, updated_at
+// List a page of notes for a specific user from the database, with an excerpt of their content.
+// Pinned notes come first in pin order, archived notes are left out unless the filter asks for them.
+func (p *NotesPostgresRepository) List(ctx context.Context, userID uuid.UUID, opts *ListOptions) (*utils.Page[*Note], error) {
+	page := opts.Page
+	column, cast := sortColumn(page.Sort)
+
+	filter := opts.Filter
+	if filter.Archived == "" {
+		filter.Archived = ArchivedExclude
+	}
+
+	where := utils.NewWhere("user_id = ? AND deleted_at IS NULL", userID)
+	page.AddDateFilters(where)
+	filter.apply(where, userID)
+
+	result := &utils.Page[*Note]{Items: []*Note{}}
+
+	// Total ignores the cursor so it stays the same on every page
+	if page.IncludeTotal {
+		var total int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM notes WHERE %s`, where.SQL())
+		if err := p.db.QueryRow(ctx, query, where.Args...).Scan(&total); err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+
+	page.AddGroupedKeyset(where, "pin_order", column, cast)
+
+	// Fetch one extra row to know whether there is a next page
+	query := fmt.Sprintf(`
+	SELECT %s
 	FROM notes
-	WHERE user_id = $1
-	ORDER BY created_at DESC
-	`
+	WHERE %s
+	ORDER BY pin_order ASC NULLS LAST, %s %s, id %s
+	LIMIT %s
+	`, previewColumns, where.SQL(), column, page.Direction(), page.Direction(), where.Arg(page.Limit+1))
 
-	rows, err := p.db.Query(ctx, query, userID)
+	rows, err := p.db.Query(ctx, query, where.Args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var notes []*Note
-
 	for rows.Next() {
 		var n Note
 
-		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &n.UpdatedAt); err != nil {
+		if err := scanNote(rows, &n); err != nil {
+			return nil, err
+		}
+
+		result.Items = append(result.Items, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) > page.Limit {
+		result.Items = result.Items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		if last.PinOrder != nil {
+			result.NextCursor = page.NextGroupCursor(*last.PinOrder, last.ID.String())
+		} else {
+			result.NextCursor = page.NextCursor(sortValue(last, page.Sort), last.ID.String())
+		}
+	}
+
+	return result, nil
+}
+
+// Search notes of a user by full-text search on title and content, ranked by relevance.
+// Encrypted notes are never searched, the server can't read them.
+// When full-text search finds nothing on the first page, trigram similarity is used to tolerate typos.
+func (p *NotesPostgresRepository) Search(ctx context.Context, userID uuid.UUID, opts *SearchOptions) (*utils.Page[*SearchResult], error) {
+	terms := parseSearchQuery(opts.Query)
+	tsQuery := buildTSQuery(terms)
+
+	offset := opts.Page.Offset()
+
+	result := &utils.Page[*SearchResult]{Items: []*SearchResult{}}
+	if tsQuery != "" {
+		if err := p.fullTextSearch(ctx, userID, opts, tsQuery, offset, result); err != nil {
 			return nil, err
 		}
+	}
+
+	// Typo fallback, only when the exact search has no results at all.
+	// Fuzzy matches are a single best-effort page without a cursor.
+	if len(result.Items) == 0 && offset == 0 {
+		if text := fuzzyText(terms); text != "" {
+			if err := p.fuzzySearch(ctx, userID, opts, text, result); err != nil {
+				return nil, err
+			}
+			if result.Total != nil {
+				total := len(result.Items)
+				result.Total = &total
+			}
+			return result, nil
+		}
+	}
+
+	if len(result.Items) > opts.Page.Limit {
+		result.Items = result.Items[:opts.Page.Limit]
+		result.NextCursor = opts.Page.NextOffsetCursor(offset + opts.Page.Limit)
+	}
+
+	return result, nil
+}
 
-		notes = append(notes, &n)
+// fullTextSearch runs the tsvector search, filling result with up to Limit+1 rows
+func (p *NotesPostgresRepository) fullTextSearch(ctx context.Context, userID uuid.UUID, opts *SearchOptions, tsQuery string, offset int, result *utils.Page[*SearchResult]) error {
+	where := utils.NewWhere("user_id = ? AND deleted_at IS NULL AND NOT encrypted", userID)
+	lang := where.Arg(opts.Language)
+	queryArg := where.Arg(tsQuery)
+	where.Add("search_vector @@ query")
+	opts.Page.AddDateFilters(where)
+	opts.Filter.apply(where, userID)
+
+	from := fmt.Sprintf("notes, to_tsquery(%s::regconfig, %s) AS query", lang, queryArg)
+
+	if opts.Page.IncludeTotal {
+		var total int
+		countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, from, where.SQL())
+		if err := p.db.QueryRow(ctx, countQuery, where.Args...).Scan(&total); err != nil {
+			return err
+		}
+		result.Total = &total
 	}
 
-	return notes, rows.Err()
+	titleOpts := where.Arg("StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true")
+	contentOpts := where.Arg("StartSel=" + highlightStart + ", StopSel=" + highlightStop +
+		", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \"")
+
+	query := fmt.Sprintf(`
+	SELECT %s,
+		ts_rank_cd(search_vector, query) AS rank,
+		ts_headline(%s::regconfig, title, query, %s),
+		ts_headline(%s::regconfig, content, query, %s)
+	FROM %s
+	WHERE %s
+	ORDER BY rank DESC, updated_at DESC, id
+	LIMIT %s OFFSET %s
+	`, previewColumns, lang, titleOpts, lang, contentOpts, from, where.SQL(), where.Arg(opts.Page.Limit+1), where.Arg(offset))
+
+	rows, err := p.db.Query(ctx, query, where.Args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Note
+		var rank float64
+		var titleHeadline, contentHeadline string
+
+		if err := scanNote(rows, &n, &rank, &titleHeadline, &contentHeadline); err != nil {
+			return err
+		}
+
+		result.Items = append(result.Items, &SearchResult{
+			Note: &n,
+			Rank: rank,
+			Highlights: []Highlight{
+				parseHighlight("title", titleHeadline),
+				parseHighlight("content", contentHeadline),
+			},
+		})
+	}
+
+	return rows.Err()
+}
+
+// fuzzySearch finds notes whose title or content words are similar to the query text, filling result with up to Limit rows.
+// The % and <% operators can use the trigram indexes, their thresholds are set for the transaction only
+// so pooled connections keep the defaults.
+func (p *NotesPostgresRepository) fuzzySearch(ctx context.Context, userID uuid.UUID, opts *SearchOptions, text string, result *utils.Page[*SearchResult]) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+	SELECT set_config('pg_trgm.similarity_threshold', '0.3', true),
+		set_config('pg_trgm.word_similarity_threshold', '0.5', true)
+	`); err != nil {
+		return err
+	}
+
+	where := utils.NewWhere("user_id = ? AND deleted_at IS NULL AND NOT encrypted", userID)
+	textArg := where.Arg(text)
+	where.Add(fmt.Sprintf("(title %% %s OR %s <%% content)", textArg, textArg))
+	opts.Page.AddDateFilters(where)
+	opts.Filter.apply(where, userID)
+
+	query := fmt.Sprintf(`
+	SELECT %s,
+		GREATEST(similarity(title, %s), word_similarity(%s, content)) AS rank
+	FROM notes
+	WHERE %s
+	ORDER BY rank DESC, updated_at DESC, id
+	LIMIT %s
+	`, previewColumns, textArg, textArg, where.SQL(), where.Arg(opts.Page.Limit))
+
+	rows, err := tx.Query(ctx, query, where.Args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Note
+		var rank float64
+
+		if err := scanNote(rows, &n, &rank); err != nil {
+			return err
+		}
+
+		result.Items = append(result.Items, &SearchResult{
+			Note:  &n,
+			Rank:  rank,
+			Fuzzy: true,
+			Highlights: []Highlight{
+				plainSnippet("title", n.Title, 255),
+				plainSnippet("content", n.Content, 200),
+			},
+		})
+	}
+
+	return rows.Err()
+}
+
+// sortColumn maps a sort key to its column and SQL type
+func sortColumn(sort string) (string, string) {
+	switch sort {
+	case "updated":
+		return "updated_at", "timestamptz"
+	case "title":
+		return "title", "text"
+	default:
+		return "created_at", "timestamptz"
+	}
+}
+
+// sortValue returns the value of the sort key of a note, as stored in cursors
+func sortValue(n *Note, sort string) string {
+	switch sort {
+	case "updated":
+		return utils.FormatCursorTime(n.UpdatedAt)
+	case "title":
+		return n.Title
+	default:
+		return utils.FormatCursorTime(n.CreatedAt)
+	}
 }
 
 // ----------------------------------------
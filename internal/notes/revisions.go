@@ -0,0 +1,276 @@
+package notes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/subrat-dwi/shubserver/internal/diff"
+)
+
+// ErrRevisionNotFound is returned when a revision doesn't exist or was pruned
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is a snapshot of an earlier title and content of a note
+type Revision struct {
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"` // omitted in lists
+	Size      int       `json:"size"`              // content length in bytes
+	CreatedAt time.Time `json:"createdAt"`         // when this version was written
+}
+
+// RevisionRetention limits how many snapshots are kept per note.
+// Zero values disable the corresponding limit.
+type RevisionRetention struct {
+	MaxCount int           // keep at most this many snapshots per note
+	MaxAge   time.Duration // drop snapshots older than this
+}
+
+// RevisionDiff is the difference between two versions of a note
+type RevisionDiff struct {
+	From       int         `json:"from"`
+	To         int         `json:"to"`
+	Mode       string      `json:"mode"`
+	Title      []diff.Edit `json:"title"`
+	Content    []diff.Edit `json:"content"`
+	Insertions int         `json:"insertions"` // inserted lines or words of the content
+	Deletions  int         `json:"deletions"`  // deleted lines or words of the content
+}
+
+// Diff modes
+const (
+	DiffLines = "line"
+	DiffWords = "word"
+)
+
+// diffRevisions compares two versions of a note line by line or word by word.
+// It returns diff.ErrTooDifferent for versions too different to compare.
+func diffRevisions(from, to *Revision, mode string) (*RevisionDiff, error) {
+	split, count := diff.Lines, diff.Lines
+	if mode == DiffWords {
+		split, count = diff.Words, strings.Fields
+	}
+
+	content, err := diff.Diff(split(from.Content), split(to.Content))
+	if err != nil {
+		return nil, err
+	}
+	title, err := diff.Diff(diff.Words(from.Title), diff.Words(to.Title))
+	if err != nil {
+		return nil, err
+	}
+	insertions, deletions := diff.Stats(content, count)
+
+	return &RevisionDiff{
+		From:       from.Revision,
+		To:         to.Revision,
+		Mode:       mode,
+		Title:      title,
+		Content:    content,
+		Insertions: insertions,
+		Deletions:  deletions,
+	}, nil
+}
+
+// lockedNote is the current version of a note, read with its row locked
+type lockedNote struct {
+	OwnerID    uuid.UUID
+	NotebookID *uuid.UUID
+	Title      string
+	Content    string
+	Revision   int
+	Version    int64
+	UpdatedAt  time.Time
+	Permission string // of the user who locked it
+
+	Encrypted       bool
+	Ciphertext      []byte
+	TitleCiphertext []byte
+}
+
+// changedBy reports whether saving note would change the title or content of the locked version
+func (n *lockedNote) changedBy(note *Note) bool {
+	return note.Title != n.Title || note.Content != n.Content || note.Encrypted != n.Encrypted ||
+		!bytes.Equal(note.Ciphertext, n.Ciphertext) || !bytes.Equal(note.TitleCiphertext, n.TitleCiphertext)
+}
+
+// lockNote reads and locks the current version of a note the user may edit.
+// It returns ErrReadOnly when the note is only shared with them as a viewer.
+func lockNote(ctx context.Context, tx pgx.Tx, userID uuid.UUID, id uuid.UUID) (*lockedNote, error) {
+	query := `
+	SELECT user_id, notebook_id, title, content, revision, version, updated_at, encrypted, ciphertext, title_ciphertext,
+		` + permissionSQL("notes", "$2") + `
+	FROM notes
+	WHERE id = $1 AND deleted_at IS NULL
+	FOR UPDATE
+	`
+
+	var n lockedNote
+	var permission *string
+	err := tx.QueryRow(ctx, query, id, userID).Scan(&n.OwnerID, &n.NotebookID, &n.Title, &n.Content, &n.Revision, &n.Version, &n.UpdatedAt,
+		&n.Encrypted, &n.Ciphertext, &n.TitleCiphertext, &permission)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && permission == nil) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if *permission == PermissionViewer {
+		return nil, ErrReadOnly
+	}
+	n.Permission = *permission
+
+	return &n, nil
+}
+
+// snapshot stores the current version of a locked note as a revision and prunes old revisions.
+// It returns the revision number of the version that replaces it.
+func (p *NotesPostgresRepository) snapshot(ctx context.Context, tx pgx.Tx, noteID uuid.UUID, current *lockedNote) (int, error) {
+	_, err := tx.Exec(ctx, `
+	INSERT INTO note_revisions(note_id, revision, title, content, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`, noteID, current.Revision, current.Title, current.Content, current.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	if p.retention.MaxCount > 0 {
+		_, err := tx.Exec(ctx, `
+		DELETE FROM note_revisions
+		WHERE note_id = $1 AND revision <= (
+			SELECT revision FROM note_revisions
+			WHERE note_id = $1
+			ORDER BY revision DESC
+			OFFSET $2 LIMIT 1
+		)
+		`, noteID, p.retention.MaxCount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if p.retention.MaxAge > 0 {
+		_, err := tx.Exec(ctx, `
+		DELETE FROM note_revisions
+		WHERE note_id = $1 AND created_at < $2
+		`, noteID, time.Now().Add(-p.retention.MaxAge))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return current.Revision + 1, nil
+}
+
+// ListRevisions lists the stored revisions of a note, newest first, without their content
+func (p *NotesPostgresRepository) ListRevisions(ctx context.Context, userID uuid.UUID, id uuid.UUID) ([]*Revision, error) {
+	query := `
+	SELECT r.revision, r.title, OCTET_LENGTH(r.content), r.created_at
+	FROM note_revisions r JOIN notes n ON n.id = r.note_id
+	WHERE r.note_id = $1 AND (` + permissionSQL("n", "$2") + `) IS NOT NULL AND n.deleted_at IS NULL
+	ORDER BY r.revision DESC
+	`
+
+	rows, err := p.db.Query(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Revision{}
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.Revision, &rev.Title, &rev.Size, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, &rev)
+	}
+
+	return list, rows.Err()
+}
+
+// GetRevision returns a version of a note, the current one when revision is its current revision number
+func (p *NotesPostgresRepository) GetRevision(ctx context.Context, userID uuid.UUID, id uuid.UUID, revision int) (*Revision, error) {
+	query := `
+	SELECT revision, title, content, updated_at
+	FROM notes
+	WHERE id = $1 AND (` + permissionSQL("notes", "$2") + `) IS NOT NULL AND revision = $3 AND deleted_at IS NULL
+	UNION ALL
+	SELECT r.revision, r.title, r.content, r.created_at
+	FROM note_revisions r JOIN notes n ON n.id = r.note_id
+	WHERE r.note_id = $1 AND (` + permissionSQL("n", "$2") + `) IS NOT NULL AND r.revision = $3 AND n.deleted_at IS NULL
+	LIMIT 1
+	`
+
+	var rev Revision
+	err := p.db.QueryRow(ctx, query, id, userID, revision).Scan(&rev.Revision, &rev.Title, &rev.Content, &rev.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rev.Size = len(rev.Content)
+
+	return &rev, nil
+}
+
+// RestoreRevision makes an earlier revision the current version of a note.
+// The version it replaces is kept as a revision, so a restore can itself be undone.
+func (p *NotesPostgresRepository) RestoreRevision(ctx context.Context, userID uuid.UUID, id uuid.UUID, revision int) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockNote(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if current.Encrypted {
+		return ErrEncrypted
+	}
+
+	var title, content string
+	err = tx.QueryRow(ctx, `
+	SELECT title, content FROM note_revisions
+	WHERE note_id = $1 AND revision = $2
+	`, id, revision).Scan(&title, &content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRevisionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	next, err := p.snapshot(ctx, tx, id, current)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE notes
+	SET title = $2, content = $3, revision = $4, updated_at = NOW()
+	WHERE id = $1
+	`, id, title, content, next)
+	if err != nil {
+		return err
+	}
+
+	if err := saveLinks(ctx, tx, current.OwnerID, id, content, false); err != nil {
+		return err
+	}
+	if title != current.Title {
+		if err := relinkTitle(ctx, tx, current.OwnerID, id, title); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -11,10 +11,49 @@ func Routes(h *NotesHandler) chi.Router {
 	r.Use(middleware.AuthMiddleware)
 
 	r.Get("/", h.listNotes)
+	r.Get("/export", h.exportNotes)
+	r.Post("/import", h.importNotes)
+	r.Post("/import/enex", h.importENEX)
+	r.Post("/import/keep", h.importKeep)
+	r.Get("/import/jobs", h.listImportJobs)
+	r.Get("/import/jobs/{jobID}", h.getImportJob)
+	r.Post("/archive", h.archiveNotes)
+	r.Post("/unarchive", h.unarchiveNotes)
+	r.Post("/encrypt", h.encryptNotes)
+	r.Get("/shared-with-me", h.listSharedWithMe)
+	r.Get("/graph", h.getGraph)
+	r.Get("/broken-links", h.listBrokenLinks)
 	r.Get("/{id}", h.getNote)
+	r.Get("/{id}/content", h.getNoteContent)
 	r.Post("/", h.createNote)
 	r.Delete("/{id}", h.deleteNote)
 	r.Put("/{id}", h.updateNote)
+	r.Patch("/{id}", h.patchNote)
+
+	r.Post("/{id}/pin", h.setPinned)
+	r.Delete("/{id}/pin", h.setPinned)
+	r.Post("/{id}/favorite", h.setFavorite)
+	r.Delete("/{id}/favorite", h.setFavorite)
+	r.Post("/{id}/archive", h.setArchived)
+	r.Delete("/{id}/archive", h.setArchived)
+
+	r.Get("/{id}/revisions", h.listRevisions)
+	r.Get("/{id}/revisions/diff", h.diffRevisions)
+	r.Get("/{id}/revisions/{rev}", h.getRevision)
+	r.Post("/{id}/revisions/{rev}/restore", h.restoreRevision)
+
+	r.Get("/{id}/backlinks", h.listBacklinks)
+
+	r.Get("/{id}/checklist", h.getChecklist)
+	r.Post("/{id}/checklist", h.addChecklistItem)
+	r.Patch("/{id}/checklist/{itemID}", h.updateChecklistItem)
+	r.Delete("/{id}/checklist/{itemID}", h.deleteChecklistItem)
+	r.Post("/{id}/checklist/{itemID}/toggle", h.toggleChecklistItem)
+	r.Post("/{id}/checklist/{itemID}/move", h.moveChecklistItem)
+
+	r.Get("/{id}/shares", h.listShares)
+	r.Post("/{id}/shares", h.shareNote)
+	r.Delete("/{id}/shares/{userID}", h.revokeShare)
 
 	return r
 }
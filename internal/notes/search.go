@@ -0,0 +1,242 @@
+package notes
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// DefaultSearchLanguage is the text search configuration used when none is configured
+const DefaultSearchLanguage = "english"
+
+// searchLanguages are the built-in Postgres text search configurations
+var searchLanguages = map[string]bool{
+	"simple": true, "arabic": true, "armenian": true, "basque": true, "catalan": true,
+	"danish": true, "dutch": true, "english": true, "finnish": true, "french": true,
+	"german": true, "greek": true, "hindi": true, "hungarian": true, "indonesian": true,
+	"irish": true, "italian": true, "lithuanian": true, "nepali": true, "norwegian": true,
+	"portuguese": true, "romanian": true, "russian": true, "serbian": true, "spanish": true,
+	"swedish": true, "tamil": true, "turkish": true, "yiddish": true,
+}
+
+// Markers ts_headline puts around matches, stripped again by parseHighlight.
+// Control characters never occur in note text typed by users.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// SearchOptions holds a full-text search request
+type SearchOptions struct {
+	Query    string
+	Language string
+	Page     *utils.PageRequest // Sort is always "rank", the cursor value is an offset
+	Filter   Filter
+}
+
+// SearchResult is a note matching a search with its rank and highlighted snippets
+type SearchResult struct {
+	*Note
+	Rank       float64     `json:"rank"`
+	Fuzzy      bool        `json:"fuzzy,omitempty"` // matched by trigram similarity instead of full-text search
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Highlight is a snippet of a note field with the positions of the matched terms
+type Highlight struct {
+	Field   string  `json:"field"`
+	Snippet string  `json:"snippet"`
+	Matches []Match `json:"matches"`
+}
+
+// Match is a matched term inside a snippet, in characters (not bytes)
+type Match struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// IsSearchLanguage reports whether lang is a supported text search configuration
+func IsSearchLanguage(lang string) bool {
+	return searchLanguages[lang]
+}
+
+// searchTerm is one parsed term of a search query
+type searchTerm struct {
+	words  []string // more than one word for "quoted phrases"
+	negate bool     // -term
+	prefix bool     // term*
+	or     bool     // joined to the previous term with OR instead of AND
+}
+
+// parseSearchQuery splits a user query into terms. Supported syntax:
+//
+//	word        must contain word
+//	"a b"       must contain the phrase
+//	word*       words starting with word
+//	-word       must not contain word (also -"a b")
+//	a OR b      either term
+func parseSearchQuery(q string) []searchTerm {
+	var terms []searchTerm
+	nextOr := false
+
+	rest := strings.TrimSpace(q)
+	for rest != "" {
+		t := searchTerm{or: nextOr}
+		nextOr = false
+
+		if rest[0] == '-' && len(rest) > 1 {
+			t.negate = true
+			rest = rest[1:]
+		}
+
+		var raw string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				raw, rest = rest[1:], ""
+			} else {
+				raw, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw, rest = rest[:end], rest[end:]
+
+			if raw == "OR" && len(terms) > 0 && !t.negate {
+				nextOr = true
+				rest = strings.TrimSpace(rest)
+				continue
+			}
+			if strings.HasSuffix(raw, "*") {
+				t.prefix = true
+				raw = strings.TrimRight(raw, "*")
+			}
+		}
+		rest = strings.TrimSpace(rest)
+
+		t.words = searchWords(raw)
+		if len(t.words) > 0 {
+			terms = append(terms, t)
+		}
+	}
+
+	return terms
+}
+
+// searchWords splits text into words, dropping the characters that have a meaning in tsquery syntax
+func searchWords(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' && r != '\'' && r != '-'
+	})
+
+	// Keep only words with at least one letter or digit
+	words := fields[:0]
+	for _, f := range fields {
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) >= 0 {
+			words = append(words, f)
+		}
+	}
+	return words
+}
+
+// quoteLexeme quotes a word as a tsquery lexeme
+func quoteLexeme(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", "''") + "'"
+}
+
+// buildTSQuery converts parsed terms to to_tsquery syntax. OR binds tighter
+// than the implicit AND, so "a OR b -c" means (a | b) & !c.
+// It returns "" when no term can match on its own (e.g. only negations).
+func buildTSQuery(terms []searchTerm) string {
+	var groups [][]string
+	positives := 0
+
+	for _, t := range terms {
+		lexemes := make([]string, len(t.words))
+		for j, w := range t.words {
+			lexemes[j] = quoteLexeme(w)
+		}
+		if t.prefix {
+			lexemes[len(lexemes)-1] += ":*"
+		}
+
+		expr := strings.Join(lexemes, " <-> ")
+		if len(lexemes) > 1 {
+			expr = "(" + expr + ")"
+		}
+		if t.negate {
+			expr = "!" + expr
+		} else {
+			positives++
+		}
+
+		if t.or && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], expr)
+		} else {
+			groups = append(groups, []string{expr})
+		}
+	}
+
+	if positives == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(groups))
+	for i, g := range groups {
+		parts[i] = strings.Join(g, " | ")
+		if len(g) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// fuzzyText returns the positive words of the query, used for the trigram fallback
+func fuzzyText(terms []searchTerm) string {
+	var words []string
+	for _, t := range terms {
+		if !t.negate {
+			words = append(words, t.words...)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// parseHighlight strips the ts_headline markers from a snippet and records where the matches were
+func parseHighlight(field, marked string) Highlight {
+	h := Highlight{Field: field, Matches: []Match{}}
+
+	var b strings.Builder
+	pos := 0 // position in characters within the plain snippet
+	start := -1
+
+	for _, r := range marked {
+		switch string(r) {
+		case highlightStart:
+			start = pos
+		case highlightStop:
+			if start >= 0 {
+				h.Matches = append(h.Matches, Match{Start: start, Length: pos - start})
+				start = -1
+			}
+		default:
+			b.WriteRune(r)
+			pos++
+		}
+	}
+
+	h.Snippet = b.String()
+	return h
+}
+
+// plainSnippet returns the beginning of a text as a snippet without matches
+func plainSnippet(field, text string, maxChars int) Highlight {
+	if utf8.RuneCountInString(text) > maxChars {
+		text = string([]rune(text)[:maxChars]) + "…"
+	}
+	return Highlight{Field: field, Snippet: text, Matches: []Match{}}
+}
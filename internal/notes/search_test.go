@@ -0,0 +1,51 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []searchTerm
+	}{
+		{"", nil},
+		{"apple", []searchTerm{{words: []string{"apple"}}}},
+		{`-"a b" c*`, []searchTerm{{words: []string{"a", "b"}, negate: true}, {words: []string{"c"}, prefix: true}}},
+		{"x OR y", []searchTerm{{words: []string{"x"}}, {words: []string{"y"}, or: true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := parseSearchQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"apple", `'apple'`},
+		{"apple pie", `'apple' & 'pie'`},
+		{`"apple pie"`, `('apple' <-> 'pie')`},
+		{"app*", `'app':*`},
+		{"apple -pie", `'apple' & !'pie'`},
+		{"a OR b -c", `('a' | 'b') & !'c'`},
+		{"OR apple", `'OR' & 'apple'`},
+		{"it's", `'it''s'`},
+		{"-pie", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := buildTSQuery(parseSearchQuery(tt.query)); got != tt.want {
+				t.Errorf("buildTSQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Errors of writing notes
+var (
+	ErrOwnerOnly         = errors.New("only the owner can change the notebook or tags of a note")
+	ErrRewriteOwnerOnly  = errors.New("only the owner can rewrite links to a note")
+	ErrEditNotMerged     = errors.New("the edit can't be merged")
+	ErrLinksNotRewritten = errors.New("the note was saved but links to it weren't rewritten")
+)
+
+// NotesService validates and writes notes, for the notes handler and batches
+type NotesService struct {
+	repo           NotesRepository
+	searchLanguage string
+	maxContent     int // bytes
+}
+
+// NewNotesService creates a notes service, searchLanguage is the default text search configuration
+// and maxContent limits the size of note content in bytes
+func NewNotesService(repo NotesRepository, searchLanguage string, maxContent int) *NotesService {
+	if !IsSearchLanguage(searchLanguage) {
+		log.Printf("notes: unsupported search language %q, using %q", searchLanguage, DefaultSearchLanguage)
+		searchLanguage = DefaultSearchLanguage
+	}
+	if maxContent <= 0 {
+		maxContent = DefaultMaxContentBytes
+	}
+	return &NotesService{repo: repo, searchLanguage: searchLanguage, maxContent: maxContent}
+}
+
+// WithRepo returns a copy of the service writing to repo, e.g. a repository bound to a transaction
+func (s *NotesService) WithRepo(repo NotesRepository) *NotesService {
+	return &NotesService{repo: repo, searchLanguage: s.searchLanguage, maxContent: s.maxContent}
+}
+
+// Validation helper
+func (s *NotesService) validateNoteInput(title, content string) error {
+	if strings.TrimSpace(title) == "" {
+		return utils.NewValidationError("title is required")
+	}
+	if strings.TrimSpace(content) == "" {
+		return utils.NewValidationError("content is required")
+	}
+	if len(title) > 255 {
+		return utils.NewValidationError("title must be less than 255 characters")
+	}
+	if len(content) > s.maxContent {
+		return utils.NewValidationError(fmt.Sprintf("content must be at most %d bytes", s.maxContent))
+	}
+	return nil
+}
+
+// validateNote validates a submitted note, plaintext or encrypted
+func (s *NotesService) validateNote(note *Note) error {
+	if note.Encrypted {
+		return validateEncryptedNote(note, s.maxContent)
+	}
+	if note.Ciphertext != nil || note.Nonce != nil || note.TitleCiphertext != nil || note.TitleNonce != nil {
+		return utils.NewValidationError("ciphertext and nonce are only allowed on encrypted notes")
+	}
+	note.EncryptVersion = 0
+	return s.validateNoteInput(note.Title, note.Content)
+}
+
+// languageFor validates the requested search language of a note, falling back to the default
+func (s *NotesService) languageFor(requested, current string) (string, error) {
+	if requested == "" {
+		if current != "" {
+			return current, nil
+		}
+		return s.searchLanguage, nil
+	}
+	if !IsSearchLanguage(requested) {
+		return "", utils.NewValidationError("unsupported language")
+	}
+	return requested, nil
+}
+
+// CreateNote validates a new note of userID and stores it
+func (s *NotesService) CreateNote(ctx context.Context, userID uuid.UUID, note *Note) (*Note, error) {
+	if err := s.validateNote(note); err != nil {
+		return nil, err
+	}
+
+	language, err := s.languageFor(note.Language, "")
+	if err != nil {
+		return nil, err
+	}
+	note.Language = language
+
+	if note.Tags, err = normalizeTags(note.Tags); err != nil {
+		return nil, err
+	}
+
+	note.UserID = userID
+	return s.repo.Create(ctx, note)
+}
+
+// Members of a note a merge patch can change
+var patchableNoteFields = map[string]bool{
+	"title": true, "content": true, "language": true, "tags": true, "notebookId": true,
+	"encrypted": true, "ciphertext": true, "nonce": true, "titleCiphertext": true, "titleNonce": true,
+	"encryptVersion": true,
+}
+
+// PatchNote applies a JSON Merge Patch (RFC 7396) to the editable fields of the existing note
+// and saves the result like SaveNote. The version the patch was applied to must still be current.
+func (s *NotesService) PatchNote(ctx context.Context, userID uuid.UUID, existing *Note, patch map[string]json.RawMessage, expected int64, rewriteLinks bool) error {
+	for name := range patch {
+		if !patchableNoteFields[name] {
+			return utils.NewValidationError(fmt.Sprintf("%s can't be changed", name))
+		}
+	}
+
+	target, err := patchTarget(existing)
+	if err != nil {
+		return err
+	}
+	if err := utils.ApplyMergePatch(target, patch); err != nil {
+		return err
+	}
+
+	var payload Note
+	if err := remarshal(target, &payload); err != nil {
+		return utils.NewValidationError("invalid note: " + err.Error())
+	}
+	// Removing the tags clears them, omitted tags would keep them
+	if raw, ok := patch["tags"]; ok && utils.IsNull(raw) {
+		payload.Tags = []string{}
+	}
+
+	if expected == 0 {
+		expected = existing.Version
+	}
+	return s.SaveNote(ctx, userID, existing, &payload, patch, expected, rewriteLinks)
+}
+
+// patchTarget returns the editable fields of a note as the JSON object merge patches apply to
+func patchTarget(note *Note) (map[string]interface{}, error) {
+	target := map[string]interface{}{}
+	if err := remarshal(note, &target); err != nil {
+		return nil, err
+	}
+	for name := range target {
+		if !patchableNoteFields[name] {
+			delete(target, name)
+		}
+	}
+	return target, nil
+}
+
+// remarshal converts between JSON compatible values by encoding from and decoding into to
+func remarshal(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+// SaveNote validates payload and writes it over the existing note, fields are the members
+// present in the request body. expected is the version the write must find, 0 for any.
+// With rewriteLinks, a new title is also written into the wiki links of the other notes of the owner.
+// An edit that conflicts with the revisions saved since its base_revision returns a *MergeConflict.
+func (s *NotesService) SaveNote(ctx context.Context, userID uuid.UUID, existing *Note, payload *Note, fields map[string]json.RawMessage, expected int64, rewriteLinks bool) error {
+	oldTitle := existing.Title
+
+	if err := s.validateNote(payload); err != nil {
+		return err
+	}
+
+	// Links live in other notes of the owner, only they can rewrite them
+	if rewriteLinks && existing.Permission != PermissionOwner {
+		return ErrRewriteOwnerOnly
+	}
+
+	// An edit based on an older revision is merged with the changes saved since
+	if raw, ok := fields["base_revision"]; ok {
+		var base int
+		if err := json.Unmarshal(raw, &base); err != nil || base < 1 {
+			return utils.NewValidationError("base_revision must be a revision number")
+		}
+		if base != existing.Revision {
+			if err := s.mergeEdit(ctx, userID, existing, base, payload); err != nil {
+				return err
+			}
+			// The merge is only valid for the version it was made with
+			if expected == 0 {
+				expected = existing.Version
+			}
+		}
+	}
+
+	// A task list ending the content replaces the checklist, like in imported files,
+	// so a note read as Markdown can be edited and saved back
+	existing.checklist = nil
+	if _, ok := fields["content"]; ok && !payload.Encrypted {
+		payload.Content, existing.checklist = splitTaskList(payload.Content)
+	}
+
+	notebookChanged := false
+	if _, ok := fields["notebookId"]; ok {
+		notebookChanged = (existing.NotebookID == nil) != (payload.NotebookID == nil) ||
+			(payload.NotebookID != nil && *existing.NotebookID != *payload.NotebookID)
+		existing.NotebookID = payload.NotebookID
+	}
+
+	language, err := s.languageFor(payload.Language, existing.Language)
+	if err != nil {
+		return err
+	}
+
+	// Omitted tags keep the current ones, an empty list removes them
+	tags, err := normalizeTags(payload.Tags)
+	if err != nil {
+		return err
+	}
+
+	// The notebook and tags of a shared note belong to its owner
+	if existing.Permission != PermissionOwner &&
+		(notebookChanged || (tags != nil && !sameTags(tags, existing.Tags))) {
+		return ErrOwnerOnly
+	}
+
+	if tags != nil {
+		existing.Tags = tags
+	}
+
+	existing.Title = payload.Title
+	existing.Content = payload.Content
+	existing.Encrypted = payload.Encrypted
+	existing.Ciphertext = payload.Ciphertext
+	existing.Nonce = payload.Nonce
+	existing.TitleCiphertext = payload.TitleCiphertext
+	existing.TitleNonce = payload.TitleNonce
+	existing.EncryptVersion = payload.EncryptVersion
+	existing.Language = language
+	existing.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, userID, existing, expected); err != nil {
+		return err
+	}
+
+	if rewriteLinks && oldTitle != "" && oldTitle != existing.Title && !existing.Encrypted {
+		if _, err := s.repo.RewriteLinks(ctx, userID, existing.ID, oldTitle); err != nil {
+			return ErrLinksNotRewritten
+		}
+	}
+
+	return nil
+}
+
+// mergeEdit merges the title and content of payload, an edit based on revision base, with the existing note.
+// It returns a *MergeConflict or ErrEditNotMerged when the edit can't be merged.
+func (s *NotesService) mergeEdit(ctx context.Context, userID uuid.UUID, existing *Note, base int, payload *Note) error {
+	if existing.Encrypted || payload.Encrypted {
+		return fmt.Errorf("%w, encrypted notes can't be merged and the note changed since base_revision", ErrEditNotMerged)
+	}
+
+	baseRev, err := s.repo.GetRevision(ctx, userID, existing.ID, base)
+	if errors.Is(err, ErrRevisionNotFound) {
+		return fmt.Errorf("%w, base_revision is not stored anymore", ErrEditNotMerged)
+	}
+	if err != nil {
+		return err
+	}
+
+	title, content, err := mergeNote(baseRev, existing, payload.Title, payload.Content)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateNoteInput(title, content); err != nil {
+		return fmt.Errorf("%w, the merged note is invalid: %v", ErrEditNotMerged, err)
+	}
+	payload.Title, payload.Content = title, content
+	return nil
+}
@@ -0,0 +1,234 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Permissions a user can have on a note
+const (
+	PermissionOwner  = "owner"
+	PermissionEditor = "editor" // can change the title and content
+	PermissionViewer = "viewer" // can read the note and its revisions
+)
+
+// Sharing errors
+var (
+	ErrNotOwner          = errors.New("only the owner of the note can do this")
+	ErrReadOnly          = errors.New("the note is shared with you read-only")
+	ErrShareNotFound     = errors.New("share not found")
+	ErrShareUserNotFound = errors.New("no user with this email")
+)
+
+// Share is a user a note is shared with
+type Share struct {
+	UserID     uuid.UUID `json:"userId"`
+	Email      string    `json:"email"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SharedNote is a note another user shared with the current user
+type SharedNote struct {
+	*Note
+	OwnerEmail string    `json:"ownerEmail"`
+	SharedAt   time.Time `json:"sharedAt"`
+}
+
+// permissionSQL returns the permission of the user userArg on the notes row of table, NULL without access
+func permissionSQL(table, userArg string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s.user_id = %[2]s THEN 'owner' ELSE (
+		SELECT s.permission FROM note_shares s WHERE s.note_id = %[1]s.id AND s.user_id = %[2]s
+	) END`, table, userArg)
+}
+
+// rowQuerier is implemented by both the pool and transactions
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// checkOwner returns ErrNoteNotFound when the user has no access to a note and ErrNotOwner when they don't own it
+func checkOwner(ctx context.Context, q rowQuerier, userID, id uuid.UUID) error {
+	var permission *string
+	err := q.QueryRow(ctx, `
+	SELECT `+permissionSQL("notes", "$2")+`
+	FROM notes
+	WHERE id = $1 AND deleted_at IS NULL
+	`, id, userID).Scan(&permission)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && permission == nil) {
+		return ErrNoteNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if *permission != PermissionOwner {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// ListShares lists the users a note is shared with, only for its owner
+func (p *NotesPostgresRepository) ListShares(ctx context.Context, userID uuid.UUID, id uuid.UUID) ([]*Share, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkOwner(ctx, tx, userID, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+	SELECT s.user_id, u.email, s.permission, s.created_at
+	FROM note_shares s JOIN users u ON u.id = s.user_id
+	WHERE s.note_id = $1
+	ORDER BY s.created_at, u.email
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Share{}
+	for rows.Next() {
+		var s Share
+		if err := rows.Scan(&s.UserID, &s.Email, &s.Permission, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, &s)
+	}
+
+	return list, rows.Err()
+}
+
+// ShareNote shares a note of the user with the user registered under email,
+// or changes the permission of an existing share
+func (p *NotesPostgresRepository) ShareNote(ctx context.Context, userID uuid.UUID, id uuid.UUID, email, permission string) (*Share, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkOwner(ctx, tx, userID, id); err != nil {
+		return nil, err
+	}
+
+	s := Share{Permission: permission}
+	err = tx.QueryRow(ctx, `SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&s.UserID, &s.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrShareUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.UserID == userID {
+		return nil, utils.NewValidationError("you can't share a note with yourself")
+	}
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO note_shares(note_id, user_id, permission)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (note_id, user_id) DO UPDATE SET permission = EXCLUDED.permission
+	RETURNING created_at
+	`, id, s.UserID, permission).Scan(&s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, tx.Commit(ctx)
+}
+
+// RevokeShare stops sharing a note with a user. The owner can revoke any share,
+// a recipient can only remove their own.
+func (p *NotesPostgresRepository) RevokeShare(ctx context.Context, userID uuid.UUID, id uuid.UUID, recipientID uuid.UUID) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if recipientID != userID {
+		if err := checkOwner(ctx, tx, userID, id); err != nil {
+			return err
+		}
+	}
+
+	cmd, err := tx.Exec(ctx, `DELETE FROM note_shares WHERE note_id = $1 AND user_id = $2`, id, recipientID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrShareNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListSharedWithMe lists a page of the notes other users shared with the user, with an excerpt of their content
+func (p *NotesPostgresRepository) ListSharedWithMe(ctx context.Context, userID uuid.UUID, page *utils.PageRequest) (*utils.Page[*SharedNote], error) {
+	column, cast := sortColumn(page.Sort)
+
+	where := utils.NewWhere("deleted_at IS NULL")
+	from := fmt.Sprintf(`notes, LATERAL (
+		SELECT s.permission, s.created_at AS shared_at, u.email AS owner_email
+		FROM note_shares s, users u
+		WHERE s.note_id = notes.id AND s.user_id = %s AND u.id = notes.user_id
+	) share`, where.Arg(userID))
+	page.AddDateFilters(where)
+
+	result := &utils.Page[*SharedNote]{Items: []*SharedNote{}}
+
+	// Total ignores the cursor so it stays the same on every page
+	if page.IncludeTotal {
+		var total int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, from, where.SQL())
+		if err := p.db.QueryRow(ctx, query, where.Args...).Scan(&total); err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+
+	page.AddKeyset(where, column, cast)
+
+	// Fetch one extra row to know whether there is a next page
+	query := fmt.Sprintf(`
+	SELECT %s, notes.user_id, share.permission, share.owner_email, share.shared_at
+	FROM %s
+	WHERE %s
+	ORDER BY %s %s, id %s
+	LIMIT %s
+	`, previewColumns, from, where.SQL(), column, page.Direction(), page.Direction(), where.Arg(page.Limit+1))
+
+	rows, err := p.db.Query(ctx, query, where.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n := SharedNote{Note: &Note{}}
+		if err := scanNote(rows, n.Note, &n.UserID, &n.Permission, &n.OwnerEmail, &n.SharedAt); err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) > page.Limit {
+		result.Items = result.Items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		result.NextCursor = page.NextCursor(sortValue(last.Note, page.Sort), last.ID.String())
+	}
+
+	return result, nil
+}
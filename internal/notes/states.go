@@ -0,0 +1,114 @@
+package notes
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxBulkNotes is the most notes a bulk request may change at once
+const MaxBulkNotes = 500
+
+// SetPinned pins a note after the already pinned notes, or unpins it.
+// Pinning an archived note unarchives it, so it shows up in the list again.
+func (p *NotesPostgresRepository) SetPinned(ctx context.Context, userID uuid.UUID, id uuid.UUID, pinned bool) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize pins of the same user, pin positions are unique
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('note-pins:' || $1::text))`, userID); err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE notes
+	SET pin_order = NULL
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+	if pinned {
+		query = `
+		UPDATE notes
+		SET archived_at = NULL, pin_order = COALESCE(pin_order, (
+			SELECT COALESCE(MAX(pin_order), 0) + 1 FROM notes WHERE user_id = $2
+		))
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		`
+	}
+
+	cmd, err := tx.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetFavorite marks or unmarks a note as a favorite
+func (p *NotesPostgresRepository) SetFavorite(ctx context.Context, userID uuid.UUID, id uuid.UUID, favorite bool) error {
+	query := `
+	UPDATE notes
+	SET favorite = $3
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, userID, favorite)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+
+	return nil
+}
+
+// SetArchived archives or unarchives notes of a user and returns how many changed.
+// Archived notes are unpinned. Notes that are missing, trashed or already in that state are skipped.
+func (p *NotesPostgresRepository) SetArchived(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, archived bool) (int64, error) {
+	query := `
+	UPDATE notes
+	SET archived_at = NULL
+	WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL AND archived_at IS NOT NULL
+	`
+	if archived {
+		query = `
+		UPDATE notes
+		SET archived_at = NOW(), pin_order = NULL
+		WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL AND archived_at IS NULL
+		`
+	}
+
+	cmd, err := p.db.Exec(ctx, query, ids, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return cmd.RowsAffected(), nil
+}
+
+// SetDates sets the creation and modification dates of a note, e.g. to the dates of an imported note.
+// A nil date is left unchanged.
+func (p *NotesPostgresRepository) SetDates(ctx context.Context, userID uuid.UUID, id uuid.UUID, created, updated *time.Time) error {
+	query := `
+	UPDATE notes
+	SET created_at = COALESCE($3, created_at), updated_at = COALESCE($4, updated_at)
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, userID, created, updated)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package notes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Tag limits
+const (
+	MaxTagLength   = 64
+	MaxTagsPerNote = 20
+)
+
+// normalizeTags trims tag names, drops case-insensitive duplicates and validates them
+func normalizeTags(names []string) ([]string, error) {
+	if names == nil {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, utils.NewValidationError("tag names cannot be empty")
+		}
+		if len(name) > MaxTagLength {
+			return nil, utils.NewValidationError(fmt.Sprintf("tag names must be at most %d characters", MaxTagLength))
+		}
+
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, name)
+	}
+
+	if len(tags) > MaxTagsPerNote {
+		return nil, utils.NewValidationError(fmt.Sprintf("a note can have at most %d tags", MaxTagsPerNote))
+	}
+
+	return tags, nil
+}
+
+// setNoteTags replaces the tags of a note, creating tags the user doesn't have yet.
+// Existing tags are matched ignoring case and keep their original spelling.
+func setNoteTags(ctx context.Context, tx pgx.Tx, userID, noteID uuid.UUID, names []string) error {
+	if len(names) > 0 {
+		_, err := tx.Exec(ctx, `
+		INSERT INTO tags(user_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, LOWER(name)) DO NOTHING
+		`, userID, names)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM note_tags WHERE note_id = $1`, noteID); err != nil {
+		return err
+	}
+
+	if len(names) > 0 {
+		_, err := tx.Exec(ctx, `
+		INSERT INTO note_tags(note_id, tag_id)
+		SELECT $1, id
+		FROM tags
+		WHERE user_id = $2 AND LOWER(name) IN (SELECT LOWER(x) FROM unnest($3::text[]) x)
+		`, noteID, userID, names)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
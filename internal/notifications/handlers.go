@@ -0,0 +1,68 @@
+package notifications
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Handler struct for notifications
+type NotificationsHandler struct {
+	service *NotificationService
+}
+
+// Constructor for handler
+func NewNotificationsHandler(service *NotificationService) *NotificationsHandler {
+	return &NotificationsHandler{service: service}
+}
+
+// Handler to list the user's notifications, optionally only unread ones
+func (h *NotificationsHandler) listNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	list, err := h.service.List(r.Context(), userID, unreadOnly)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access notifications")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"notifications": list,
+	})
+}
+
+// Handler to mark a single notification as read
+func (h *NotificationsHandler) markRead(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid notification ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.service.MarkRead(r.Context(), userID, id); err != nil {
+		utils.Error(w, http.StatusNotFound, "notification not found")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "notification marked as read",
+	})
+}
+
+// Handler to mark every notification as read
+func (h *NotificationsHandler) markAllRead(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.service.MarkAllRead(r.Context(), userID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to update notifications")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "all notifications marked as read",
+	})
+}
@@ -0,0 +1,114 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Notifications Repository Interface
+type NotificationsRepository interface {
+	Create(ctx context.Context, n *Notification) (*Notification, error)
+	List(ctx context.Context, userID uuid.UUID, unreadOnly bool) ([]*Notification, error)
+	MarkRead(ctx context.Context, userID, id uuid.UUID) error
+	MarkAllRead(ctx context.Context, userID uuid.UUID) error
+}
+
+// Postgres Repository
+type NotificationsPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewNotificationsPostgresRepository(db *pgxpool.Pool) *NotificationsPostgresRepository {
+	return &NotificationsPostgresRepository{db: db}
+}
+
+// Create stores a new notification
+func (p *NotificationsPostgresRepository) Create(ctx context.Context, n *Notification) (*Notification, error) {
+	query := `
+	INSERT INTO notifications(user_id, kind, title, body, data)
+	VALUES($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+	`
+
+	if n.Data == nil {
+		n.Data = map[string]string{}
+	}
+
+	err := p.db.QueryRow(ctx, query, n.UserID, n.Kind, n.Title, n.Body, n.Data).Scan(&n.ID, &n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// List returns a user's notifications, newest first
+func (p *NotificationsPostgresRepository) List(ctx context.Context, userID uuid.UUID, unreadOnly bool) ([]*Notification, error) {
+	query := `
+	SELECT id, user_id, kind, title, body, data, read_at, created_at
+	FROM notifications
+	WHERE user_id = $1`
+
+	if unreadOnly {
+		query += `
+		AND read_at IS NULL`
+	}
+
+	query += `
+	ORDER BY created_at DESC
+	LIMIT 200
+	`
+
+	rows, err := p.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &n.Data, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, &n)
+	}
+
+	return list, rows.Err()
+}
+
+// MarkRead marks a single notification as read
+func (p *NotificationsPostgresRepository) MarkRead(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+	UPDATE notifications
+	SET read_at = COALESCE(read_at, NOW())
+	WHERE id = $1 AND user_id = $2
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return errors.New("notification not found")
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of a user as read
+func (p *NotificationsPostgresRepository) MarkAllRead(ctx context.Context, userID uuid.UUID) error {
+	query := `
+	UPDATE notifications
+	SET read_at = NOW()
+	WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	_, err := p.db.Exec(ctx, query, userID)
+	return err
+}
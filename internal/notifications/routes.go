@@ -0,0 +1,18 @@
+package notifications
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the routes for the notifications module
+func Routes(h *NotificationsHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.listNotifications)
+	r.Post("/read", h.markAllRead)
+	r.Post("/{id}/read", h.markRead)
+
+	return r
+}
@@ -0,0 +1,63 @@
+package notifications
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/mailer"
+)
+
+// NotificationService stores in-app notifications and delivers them by email
+type NotificationService struct {
+	repo   NotificationsRepository
+	mailer mailer.Mailer
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(repo NotificationsRepository, mailer mailer.Mailer) *NotificationService {
+	return &NotificationService{repo: repo, mailer: mailer}
+}
+
+// Notify stores the notification in the user's in-app list and emails it to them.
+// Email failures are logged but do not fail the call, the in-app copy is the source of truth.
+func (s *NotificationService) Notify(ctx context.Context, userID uuid.UUID, email string, n *Notification) error {
+	n.UserID = userID
+
+	if _, err := s.repo.Create(ctx, n); err != nil {
+		return err
+	}
+
+	if email != "" {
+		if err := s.mailer.Send(ctx, email, n.Title, n.Body); err != nil {
+			log.Printf("notifications: email to user %s failed: %v", userID, err)
+		}
+	}
+
+	return nil
+}
+
+// NotifyUser builds and sends a notification, see Notify
+func (s *NotificationService) NotifyUser(ctx context.Context, userID uuid.UUID, email, kind, title, body string, data map[string]string) error {
+	return s.Notify(ctx, userID, email, &Notification{
+		Kind:  kind,
+		Title: title,
+		Body:  body,
+		Data:  data,
+	})
+}
+
+// List returns a user's notifications
+func (s *NotificationService) List(ctx context.Context, userID uuid.UUID, unreadOnly bool) ([]*Notification, error) {
+	return s.repo.List(ctx, userID, unreadOnly)
+}
+
+// MarkRead marks a notification as read
+func (s *NotificationService) MarkRead(ctx context.Context, userID, id uuid.UUID) error {
+	return s.repo.MarkRead(ctx, userID, id)
+}
+
+// MarkAllRead marks every notification of a user as read
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID uuid.UUID) error {
+	return s.repo.MarkAllRead(ctx, userID)
+}
@@ -1,12 +1,15 @@
 package passwordmanager
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/auth"
 	"github.com/subrat-dwi/shubserver/internal/utils"
 )
 
@@ -14,19 +17,47 @@ import (
 
 // PasswordItem struct for API responses
 type PasswordItem struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Username  string `json:"username"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Username      string `json:"username"`
+	RequireReauth bool   `json:"require_reauth"`
+	Version       int64  `json:"version"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
 }
 
 // Request struct for creating a password item
 type CreatePasswordRequest struct {
-	Name       string `json:"name" validate:"required"`
-	Username   string `json:"username" validate:"required"`
-	Ciphertext string `json:"password" validate:"required"` // base64 encoded ciphertext
-	Nonce      string `json:"nonce" validate:"required"`    // base64 encoded nonce
+	ID            string `json:"id,omitempty"` // optional client generated ID, only used on create
+	Name          string `json:"name" validate:"required"`
+	Username      string `json:"username" validate:"required"`
+	Ciphertext    string `json:"password" validate:"required"` // base64 encoded ciphertext
+	Nonce         string `json:"nonce" validate:"required"`    // base64 encoded nonce
+	RequireReauth *bool  `json:"require_reauth"`               // only reveal ciphertext after recent reauth, kept when omitted
+}
+
+// NewPassword decodes the request into a password item with the given IDs, id may be nil on create.
+// RequireReauth is set as requested, updates pass req.RequireReauth to the service instead.
+func (req *CreatePasswordRequest) NewPassword(id, userID uuid.UUID) (*Password, error) {
+	ciphertext, err := base64.RawStdEncoding.DecodeString(req.Ciphertext)
+	if err != nil {
+		return nil, utils.NewValidationError("Invalid ciphertext encoding")
+	}
+	nonce, err := base64.RawStdEncoding.DecodeString(req.Nonce)
+	if err != nil {
+		return nil, utils.NewValidationError("Invalid nonce encoding")
+	}
+
+	return &Password{
+		ID:             id,
+		UserID:         userID,
+		Name:           req.Name,
+		Username:       req.Username,
+		Ciphertext:     ciphertext,
+		Nonce:          nonce,
+		EncryptVersion: 1,
+		RequireReauth:  req.RequireReauth != nil && *req.RequireReauth,
+	}, nil
 }
 
 // Response struct for creating a password item
@@ -36,17 +67,26 @@ type CreatePasswordResponse struct {
 
 // Response struct for listing password items
 type ListPasswordsResponse struct {
-	Passwords []PasswordItem `json:"passwords"`
+	Passwords  []PasswordItem `json:"passwords"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Total      *int           `json:"total,omitempty"`
 }
 
 type GetPasswordResponse struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Username   string `json:"username"`
-	CreatedAt  string `json:"created_at"`
-	UpdatedAt  string `json:"updated_at"`
-	Ciphertext string `json:"password"` // base64 encoded ciphertext
-	Nonce      string `json:"nonce"`    // base64 encoded nonce
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Username      string `json:"username"`
+	RequireReauth bool   `json:"require_reauth"`
+	Version       int64  `json:"version"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	Ciphertext    string `json:"password"` // base64 encoded ciphertext
+	Nonce         string `json:"nonce"`    // base64 encoded nonce
+}
+
+// Response struct for exporting the whole vault
+type ExportPasswordsResponse struct {
+	Passwords []GetPasswordResponse `json:"passwords"`
 }
 
 // Handler struct for password manager API
@@ -69,41 +109,39 @@ func (h *PasswordHandler) createPassword(w http.ResponseWriter, r *http.Request)
 
 	userID := r.Context().Value("userID").(uuid.UUID)
 
-	ciphertext, err := base64.RawStdEncoding.DecodeString(req.Ciphertext)
-	if err != nil {
-		utils.Error(w, http.StatusBadRequest, "Invalid ciphertext encoding")
-		return
+	var id uuid.UUID
+	if req.ID != "" {
+		var err error
+		if id, err = uuid.Parse(req.ID); err != nil {
+			utils.Error(w, http.StatusBadRequest, "invalid password ID")
+			return
+		}
 	}
 
-	nonce, err := base64.RawStdEncoding.DecodeString(req.Nonce)
+	password, err := req.NewPassword(id, userID)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, "Invalid nonce encoding")
+		utils.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	password := &Password{
-		UserID:         userID,
-		Name:           req.Name,
-		Username:       req.Username,
-		Ciphertext:     ciphertext,
-		Nonce:          nonce,
-		EncryptVersion: 1,
-	}
 	// Call the service layer to create the password item
 	created, err := h.passwordService.CreatePassword(r.Context(), password)
+	if errors.Is(err, ErrPasswordExists) {
+		// A retried create with If-None-Match: * gets the stored copy back
+		if utils.CreateOnly(r) {
+			h.preconditionFailed(w, r, userID, id)
+			return
+		}
+		utils.Error(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	resp := CreatePasswordResponse{
-		PasswordItem: PasswordItem{
-			ID:        created.ID.String(),
-			Name:      created.Name,
-			Username:  created.Username,
-			CreatedAt: created.CreatedAt.String(),
-			UpdatedAt: created.UpdatedAt.String(),
-		},
+		PasswordItem: ToPasswordItem(created),
 	}
+	w.Header().Set("ETag", utils.ETag(created.Version))
 	utils.JSON(w, http.StatusCreated, resp)
 }
 
@@ -112,21 +150,30 @@ func (h *PasswordHandler) listPasswords(w http.ResponseWriter, r *http.Request)
 	userID := r.Context().Value("userID").(uuid.UUID)
 	searchQuery := r.URL.Query().Get("search")
 
-	passwords, err := h.passwordService.ListPasswords(r.Context(), userID, searchQuery)
+	// Searches are ranked and paged by offset
+	parsePage := utils.ParsePageRequest
+	if searchQuery != "" {
+		parsePage = utils.ParseOffsetPageRequest
+	}
+	page, err := parsePage(r.URL.Query(), SortKeys...)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	passwords, err := h.passwordService.ListPasswords(r.Context(), userID, searchQuery, page)
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	var resp ListPasswordsResponse
-	for _, p := range passwords {
-		resp.Passwords = append(resp.Passwords, PasswordItem{
-			ID:        p.ID.String(),
-			Name:      p.Name,
-			Username:  p.Username,
-			CreatedAt: p.CreatedAt.String(),
-			UpdatedAt: p.UpdatedAt.String(),
-		})
+	resp := ListPasswordsResponse{
+		Passwords:  []PasswordItem{},
+		NextCursor: passwords.NextCursor,
+		Total:      passwords.Total,
+	}
+	for _, p := range passwords.Items {
+		resp.Passwords = append(resp.Passwords, ToPasswordItem(p))
 	}
 	utils.JSON(w, http.StatusOK, resp)
 }
@@ -146,21 +193,66 @@ func (h *PasswordHandler) getPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ciphertextBase64 := base64.RawStdEncoding.EncodeToString(password.Ciphertext)
-	nonceBase64 := base64.RawStdEncoding.EncodeToString(password.Nonce)
+	// Items flagged as sensitive are only revealed to recently reauthenticated sessions
+	if password.RequireReauth && !auth.IsRecentlyAuthenticated(r.Context()) {
+		reauthRequired(w, errRecentAuthRequired)
+		return
+	}
+
+	w.Header().Set("ETag", utils.ETag(password.Version))
+	if utils.IfNoneMatch(r, password.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, toGetPasswordResponse(password))
+}
+
+// Handler function to export every password item including ciphertext
+func (h *PasswordHandler) exportPasswords(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
 
-	resp := GetPasswordResponse{
-		ID:         password.ID.String(),
-		Name:       password.Name,
-		Username:   password.Username,
-		CreatedAt:  password.CreatedAt.String(),
-		UpdatedAt:  password.UpdatedAt.String(),
-		Ciphertext: ciphertextBase64,
-		Nonce:      nonceBase64,
+	passwords, err := h.passwordService.ExportPasswords(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := ExportPasswordsResponse{Passwords: []GetPasswordResponse{}}
+	for _, p := range passwords {
+		resp.Passwords = append(resp.Passwords, toGetPasswordResponse(p))
 	}
 	utils.JSON(w, http.StatusOK, resp)
 }
 
+// ToPasswordItem converts a password item to its API form without the ciphertext
+func ToPasswordItem(password *Password) PasswordItem {
+	return PasswordItem{
+		ID:            password.ID.String(),
+		Name:          password.Name,
+		Username:      password.Username,
+		RequireReauth: password.RequireReauth,
+		Version:       password.Version,
+		CreatedAt:     password.CreatedAt.String(),
+		UpdatedAt:     password.UpdatedAt.String(),
+	}
+}
+
+// toGetPasswordResponse converts a password item to its API form including the encoded ciphertext
+func toGetPasswordResponse(password *Password) GetPasswordResponse {
+	return GetPasswordResponse{
+		ID:            password.ID.String(),
+		Name:          password.Name,
+		Username:      password.Username,
+		RequireReauth: password.RequireReauth,
+		Version:       password.Version,
+		CreatedAt:     password.CreatedAt.String(),
+		UpdatedAt:     password.UpdatedAt.String(),
+		Ciphertext:    base64.RawStdEncoding.EncodeToString(password.Ciphertext),
+		Nonce:         base64.RawStdEncoding.EncodeToString(password.Nonce),
+	}
+}
+
 // Handler function to update an existing password item
 func (h *PasswordHandler) updatePassword(w http.ResponseWriter, r *http.Request) {
 	passwordIDStr := chi.URLParam(r, "id")
@@ -178,41 +270,142 @@ func (h *PasswordHandler) updatePassword(w http.ResponseWriter, r *http.Request)
 	}
 	userID := r.Context().Value("userID").(uuid.UUID)
 
-	ciphertextBytes, err := base64.RawStdEncoding.DecodeString(req.Ciphertext)
+	expected, ok := h.ifMatch(w, r, userID, passwordID)
+	if !ok {
+		return
+	}
+
+	password, err := req.NewPassword(passwordID, userID)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.passwordService.UpdatePassword(r.Context(), password, req.RequireReauth, expected)
+	if errors.Is(err, ErrReauthRequired) {
+		reauthRequired(w, err)
+		return
+	}
+	if errors.Is(err, ErrPasswordNotFound) {
+		utils.Error(w, http.StatusNotFound, "password not found")
+		return
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		h.preconditionFailed(w, r, userID, passwordID)
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := ToPasswordItem(updated)
+	w.Header().Set("ETag", utils.ETag(updated.Version))
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// Handler function to change some fields of a password item with a JSON Merge Patch (RFC 7396),
+// e.g. renaming it without sending the ciphertext again
+func (h *PasswordHandler) patchPassword(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid password ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	fields, err := utils.ReadMergePatch(r)
+	if errors.Is(err, utils.ErrMergePatchType) {
+		utils.Error(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, "Invalid ciphertext encoding")
+		utils.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	nonceBytes, err := base64.RawStdEncoding.DecodeString(req.Nonce)
+
+	patch, err := DecodePasswordPatch(fields)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, "Invalid nonce encoding")
+		utils.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	password := &Password{
-		ID:             passwordID,
-		UserID:         userID,
-		Name:           req.Name,
-		Username:       req.Username,
-		Ciphertext:     ciphertextBytes,
-		Nonce:          nonceBytes,
-		EncryptVersion: 1,
+
+	expected, ok := h.ifMatch(w, r, userID, passwordID)
+	if !ok {
+		return
 	}
 
-	updated, err := h.passwordService.UpdatePassword(r.Context(), password)
+	updated, err := h.passwordService.PatchPassword(r.Context(), userID, passwordID, patch, expected)
+	if errors.Is(err, ErrReauthRequired) {
+		reauthRequired(w, err)
+		return
+	}
+	if utils.IsValidationError(err) {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, ErrPasswordNotFound) {
+		utils.Error(w, http.StatusNotFound, "password not found")
+		return
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		h.preconditionFailed(w, r, userID, passwordID)
+		return
+	}
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	resp := PasswordItem{
-		ID:        updated.ID.String(),
-		Name:      updated.Name,
-		Username:  updated.Username,
-		CreatedAt: updated.CreatedAt.String(),
-		UpdatedAt: updated.UpdatedAt.String(),
-	}
+	resp := ToPasswordItem(updated)
+	w.Header().Set("ETag", utils.ETag(updated.Version))
 	utils.JSON(w, http.StatusOK, resp)
 }
 
+// DecodePasswordPatch decodes the members of a merge patch of a password item.
+// Name, username, password and nonce can't be removed; removing require_reauth turns it off,
+// which the service only allows to recently reauthenticated sessions.
+func DecodePasswordPatch(fields map[string]json.RawMessage) (*PasswordPatch, error) {
+	var patch PasswordPatch
+	for name, raw := range fields {
+		if utils.IsNull(raw) && name != "require_reauth" {
+			return nil, utils.NewValidationError(name + " can't be removed")
+		}
+
+		var err error
+		switch name {
+		case "name":
+			err = json.Unmarshal(raw, &patch.Name)
+		case "username":
+			err = json.Unmarshal(raw, &patch.Username)
+		case "password", "nonce":
+			var encoded string
+			if err = json.Unmarshal(raw, &encoded); err != nil {
+				break
+			}
+			var decoded []byte
+			if decoded, err = base64.RawStdEncoding.DecodeString(encoded); err != nil {
+				return nil, utils.NewValidationError("Invalid " + name + " encoding")
+			}
+			if name == "password" {
+				patch.Ciphertext = decoded
+			} else {
+				patch.Nonce = decoded
+			}
+		case "require_reauth":
+			reauth := false
+			if !utils.IsNull(raw) {
+				err = json.Unmarshal(raw, &reauth)
+			}
+			patch.RequireReauth = &reauth
+		default:
+			return nil, utils.NewValidationError(name + " can't be changed")
+		}
+		if err != nil {
+			return nil, utils.NewValidationError("invalid " + name)
+		}
+	}
+	return &patch, nil
+}
+
 // Handler function to delete a password item
 func (h *PasswordHandler) deletePassword(w http.ResponseWriter, r *http.Request) {
 	passwordIDStr := chi.URLParam(r, "id")
@@ -222,10 +415,72 @@ func (h *PasswordHandler) deletePassword(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	userID := r.Context().Value("userID").(uuid.UUID)
-	err = h.passwordService.DeletePassword(r.Context(), userID, passwordID)
+
+	expected, ok := h.ifMatch(w, r, userID, passwordID)
+	if !ok {
+		return
+	}
+
+	err = h.passwordService.DeletePassword(r.Context(), userID, passwordID, expected)
+	if errors.Is(err, ErrPasswordNotFound) {
+		utils.Error(w, http.StatusNotFound, "password not found")
+		return
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		h.preconditionFailed(w, r, userID, passwordID)
+		return
+	}
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	utils.JSON(w, http.StatusNoContent, nil)
 }
+
+// ifMatch checks If-Match against the current version of a password item and returns the version
+// a write must still find, 0 without the header. The response is written when ok is false.
+func (h *PasswordHandler) ifMatch(w http.ResponseWriter, r *http.Request, userID, passwordID uuid.UUID) (expected int64, ok bool) {
+	if r.Header.Get("If-Match") == "" {
+		return 0, true
+	}
+
+	password, err := h.passwordService.GetPassword(r.Context(), userID, passwordID)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "password not found")
+		return 0, false
+	}
+
+	if expected, ok = utils.CheckIfMatch(r, password.Version); !ok {
+		utils.PreconditionFailed(w, password.Version, ServerCopy(r.Context(), password))
+	}
+	return expected, ok
+}
+
+// errRecentAuthRequired is answered for entries that require reauthentication to be revealed
+var errRecentAuthRequired = errors.New("recent authentication required")
+
+// reauthRequired answers 401 to a request that needs a recently reauthenticated session,
+// hinting the client to step up with POST /users/reauth and retry, like middleware.RequireRecentAuth
+func reauthRequired(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", auth.ReauthChallenge)
+	utils.Error(w, http.StatusUnauthorized, err.Error())
+}
+
+// preconditionFailed answers 412 with the current copy of a password item
+func (h *PasswordHandler) preconditionFailed(w http.ResponseWriter, r *http.Request, userID, passwordID uuid.UUID) {
+	password, err := h.passwordService.GetPassword(r.Context(), userID, passwordID)
+	if err != nil {
+		utils.PreconditionFailed(w, 0, nil)
+		return
+	}
+	utils.PreconditionFailed(w, password.Version, ServerCopy(r.Context(), password))
+}
+
+// ServerCopy is the current copy of a password item sent with a 412, the ciphertext of
+// items that require reauthentication is left out unless the session recently reauthenticated
+func ServerCopy(ctx context.Context, password *Password) interface{} {
+	if password.RequireReauth && !auth.IsRecentlyAuthenticated(ctx) {
+		return ToPasswordItem(password)
+	}
+	return toGetPasswordResponse(password)
+}
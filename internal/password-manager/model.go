@@ -14,6 +14,8 @@ type Password struct {
 	Ciphertext     []byte
 	Nonce          []byte
 	EncryptVersion int
+	RequireReauth  bool
+	Version        int64 // increases with every change, sent as the ETag
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
@@ -2,51 +2,84 @@ package passwordmanager
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/subrat-dwi/shubserver/internal/db"
+	"github.com/subrat-dwi/shubserver/internal/utils"
 )
 
+// ErrPasswordNotFound is returned when an entry doesn't exist, belongs to another user or is in the trash
+var ErrPasswordNotFound = errors.New("password not found")
+
+// ErrPasswordExists is returned when an entry is created with the ID of an existing entry
+var ErrPasswordExists = errors.New("a password with this ID already exists")
+
+// ErrVersionConflict is returned when an entry changed since the version a write expected
+var ErrVersionConflict = errors.New("password was changed since it was read")
+
+// SortKeys are the sort keys accepted by the passwords list, the first is the default
+var SortKeys = []string{"created", "updated", "name"}
+
 // Password Repository Interface
 type PasswordRepository interface {
 	Create(ctx context.Context, password *Password) (*Password, error)
-	List(ctx context.Context, userID uuid.UUID, searchQuery string) ([]*Password, error)
+	List(ctx context.Context, userID uuid.UUID, searchQuery string, page *utils.PageRequest) (*utils.Page[*Password], error)
 	Get(ctx context.Context, userID, passwordID uuid.UUID) (*Password, error)
-	Update(ctx context.Context, password *Password) (*Password, error)
-	Delete(ctx context.Context, userID, passwordID uuid.UUID) error
+	Update(ctx context.Context, password *Password, expectedVersion int64) (*Password, error)
+	Delete(ctx context.Context, userID, passwordID uuid.UUID, expectedVersion int64) error
 	Search(ctx context.Context, userID uuid.UUID, searchQuery string) ([]*Password, error)
 }
 
 // Postgres Password Repo
 type PasswordsPostgresRepository struct {
-	db *pgxpool.Pool
+	db db.Conn
 }
 
 // Postgres repo constructor
-func NewPasswordsPostgresRepository(db *pgxpool.Pool) *PasswordsPostgresRepository {
-	return &PasswordsPostgresRepository{db: db}
+func NewPasswordsPostgresRepository(pool *pgxpool.Pool) *PasswordsPostgresRepository {
+	return &PasswordsPostgresRepository{db: pool}
+}
+
+// WithTx returns a copy of the repository running its queries in tx
+func (p *PasswordsPostgresRepository) WithTx(tx pgx.Tx) *PasswordsPostgresRepository {
+	return &PasswordsPostgresRepository{db: tx}
 }
 
 // CRUD implementation on DB
 
-// Create a new password entry in the database
+// Create a new password entry in the database. A client generated password.ID is kept,
+// ErrPasswordExists is returned when an entry with that ID already exists.
 func (p *PasswordsPostgresRepository) Create(ctx context.Context, password *Password) (*Password, error) {
 	query := `
-	INSERT INTO passwords(user_id, name, username, ciphertext, nonce)
-	VALUES($1, $2, $3, $4, $5)
-	RETURNING id, encrypt_version, created_at, updated_at
+	INSERT INTO passwords(user_id, name, username, ciphertext, nonce, require_reauth, id)
+	VALUES($1, $2, $3, $4, $5, $6, COALESCE($7, gen_random_uuid()))
+	ON CONFLICT (id) DO NOTHING
+	RETURNING id, encrypt_version, require_reauth, version, created_at, updated_at
 	`
 	var created Password
 
+	var id *uuid.UUID
+	if password.ID != uuid.Nil {
+		id = &password.ID
+	}
+
 	err := p.db.QueryRow(ctx, query,
 		password.UserID,
 		password.Name,
 		password.Username,
 		password.Ciphertext,
 		password.Nonce,
-	).Scan(&created.ID, &created.EncryptVersion, &created.CreatedAt, &created.UpdatedAt)
+		password.RequireReauth,
+		id,
+	).Scan(&created.ID, &created.EncryptVersion, &created.RequireReauth, &created.Version, &created.CreatedAt, &created.UpdatedAt)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPasswordExists
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -60,36 +93,52 @@ func (p *PasswordsPostgresRepository) Create(ctx context.Context, password *Pass
 	return &created, nil
 }
 
-// List all password entries for a user from the database
-func (p *PasswordsPostgresRepository) List(ctx context.Context, userID uuid.UUID, searchQuery string) ([]*Password, error) {
-	var (
-		rows pgx.Rows
-		err  error
-	)
+// List a page of password entries for a user from the database, optionally filtered by name.
+// Searches are ranked by similarity of the name and paged by offset, like note searches.
+func (p *PasswordsPostgresRepository) List(ctx context.Context, userID uuid.UUID, searchQuery string, page *utils.PageRequest) (*utils.Page[*Password], error) {
+	column, cast := sortColumn(page.Sort)
 
-	query := `
-	SELECT id, user_id, name, username, ciphertext, nonce, encrypt_version, created_at, updated_at
-	FROM passwords
-	WHERE user_id = $1`
+	where := utils.NewWhere("user_id = ? AND deleted_at IS NULL", userID)
+	if searchQuery != "" {
+		where.Add("name ILIKE ?", "%"+searchQuery+"%")
+	}
+	page.AddDateFilters(where)
+
+	result := &utils.Page[*Password]{Items: []*Password{}}
+
+	// Total ignores the cursor so it stays the same on every page
+	if page.IncludeTotal {
+		var total int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM passwords WHERE %s`, where.SQL())
+		if err := p.db.QueryRow(ctx, query, where.Args...).Scan(&total); err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
 
+	offset := page.Offset()
+	orderBy := fmt.Sprintf("%s %s, id %s", column, page.Direction(), page.Direction())
 	if searchQuery != "" {
-		query += `
-		AND (name ILIKE $2)
-		ORDER BY similarity(name, $2) DESC, created_at DESC`
-		rows, err = p.db.Query(ctx, query, userID, "%"+searchQuery+"%")
+		orderBy = fmt.Sprintf("similarity(name, %s) DESC, created_at DESC, id DESC", where.Arg(searchQuery))
 	} else {
-		query += `
-		ORDER BY created_at DESC
-		`
-		rows, err = p.db.Query(ctx, query, userID)
+		page.AddKeyset(where, column, cast)
 	}
 
+	// Fetch one extra row to know whether there is a next page
+	query := fmt.Sprintf(`
+	SELECT id, user_id, name, username, ciphertext, nonce, encrypt_version, require_reauth, version, created_at, updated_at
+	FROM passwords
+	WHERE %s
+	ORDER BY %s
+	LIMIT %s OFFSET %d
+	`, where.SQL(), orderBy, where.Arg(page.Limit+1), offset)
+
+	rows, err := p.db.Query(ctx, query, where.Args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var passwords []*Password
 	for rows.Next() {
 		var password Password
 		if err := rows.Scan(
@@ -100,23 +149,62 @@ func (p *PasswordsPostgresRepository) List(ctx context.Context, userID uuid.UUID
 			&password.Ciphertext,
 			&password.Nonce,
 			&password.EncryptVersion,
+			&password.RequireReauth,
+			&password.Version,
 			&password.CreatedAt,
 			&password.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
-		passwords = append(passwords, &password)
+		result.Items = append(result.Items, &password)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return passwords, nil
+	if len(result.Items) > page.Limit {
+		result.Items = result.Items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		if searchQuery != "" {
+			result.NextCursor = page.NextOffsetCursor(offset + page.Limit)
+		} else {
+			result.NextCursor = page.NextCursor(sortValue(last, page.Sort), last.ID.String())
+		}
+	}
+
+	return result, nil
+}
+
+// sortColumn maps a sort key to its column and SQL type
+func sortColumn(sort string) (string, string) {
+	switch sort {
+	case "updated":
+		return "updated_at", "timestamptz"
+	case "name":
+		return "name", "text"
+	default:
+		return "created_at", "timestamptz"
+	}
+}
+
+// sortValue returns the value of the sort key of a password entry, as stored in cursors
+func sortValue(p *Password, sort string) string {
+	switch sort {
+	case "updated":
+		return utils.FormatCursorTime(p.UpdatedAt)
+	case "name":
+		return p.Name
+	default:
+		return utils.FormatCursorTime(p.CreatedAt)
+	}
 }
 
 // Get a specific password entry from the database
 func (p *PasswordsPostgresRepository) Get(ctx context.Context, userID, passwordID uuid.UUID) (*Password, error) {
 	query := `
-	SELECT id, user_id, name, username, ciphertext, nonce, encrypt_version, created_at, updated_at
+	SELECT id, user_id, name, username, ciphertext, nonce, encrypt_version, require_reauth, version, created_at, updated_at
 	FROM passwords
-	WHERE id = $1 AND user_id = $2
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
 	`
 	var password Password
 	err := p.db.QueryRow(ctx, query, passwordID, userID).Scan(
@@ -127,6 +215,8 @@ func (p *PasswordsPostgresRepository) Get(ctx context.Context, userID, passwordI
 		&password.Ciphertext,
 		&password.Nonce,
 		&password.EncryptVersion,
+		&password.RequireReauth,
+		&password.Version,
 		&password.CreatedAt,
 		&password.UpdatedAt,
 	)
@@ -136,13 +226,14 @@ func (p *PasswordsPostgresRepository) Get(ctx context.Context, userID, passwordI
 	return &password, nil
 }
 
-// Update a password entry in Database
-func (p *PasswordsPostgresRepository) Update(ctx context.Context, password *Password) (*Password, error) {
+// Update a password entry of password.UserID in Database.
+// A non-zero expectedVersion makes it fail with ErrVersionConflict when the entry changed since.
+func (p *PasswordsPostgresRepository) Update(ctx context.Context, password *Password, expectedVersion int64) (*Password, error) {
 	query := `
 	UPDATE passwords
-	SET name = $1, username = $2, ciphertext = $3, nonce = $4, encrypt_version = $5, updated_at = NOW()
-	WHERE id = $6
-	RETURNING id, user_id, name, username, ciphertext, nonce, encrypt_version, created_at, updated_at
+	SET name = $1, username = $2, ciphertext = $3, nonce = $4, encrypt_version = $5, require_reauth = $6, updated_at = NOW()
+	WHERE id = $7 AND user_id = $8 AND deleted_at IS NULL AND ($9::bigint = 0 OR version = $9)
+	RETURNING id, user_id, name, username, ciphertext, nonce, encrypt_version, require_reauth, version, created_at, updated_at
 	`
 	var updated Password
 	err := p.db.QueryRow(ctx, query,
@@ -151,7 +242,10 @@ func (p *PasswordsPostgresRepository) Update(ctx context.Context, password *Pass
 		password.Ciphertext,
 		password.Nonce,
 		password.EncryptVersion,
+		password.RequireReauth,
 		password.ID,
+		password.UserID,
+		expectedVersion,
 	).Scan(
 		&updated.ID,
 		&updated.UserID,
@@ -160,31 +254,64 @@ func (p *PasswordsPostgresRepository) Update(ctx context.Context, password *Pass
 		&updated.Ciphertext,
 		&updated.Nonce,
 		&updated.EncryptVersion,
+		&updated.RequireReauth,
+		&updated.Version,
 		&updated.CreatedAt,
 		&updated.UpdatedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, p.missing(ctx, password.UserID, password.ID, expectedVersion)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &updated, nil
 }
 
-// Delete a password entry from Database
-func (p *PasswordsPostgresRepository) Delete(ctx context.Context, userID, passwordID uuid.UUID) error {
+// missing explains why a conditional write found no entry: ErrVersionConflict when
+// it exists with another version, ErrPasswordNotFound otherwise
+func (p *PasswordsPostgresRepository) missing(ctx context.Context, userID, passwordID uuid.UUID, expectedVersion int64) error {
+	if expectedVersion == 0 {
+		return ErrPasswordNotFound
+	}
+
+	var exists bool
+	err := p.db.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM passwords WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, passwordID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrPasswordNotFound
+}
+
+// Delete moves a password entry to the trash, it is purged later by the trash module.
+// A non-zero expectedVersion makes it fail with ErrVersionConflict when the entry changed since.
+func (p *PasswordsPostgresRepository) Delete(ctx context.Context, userID, passwordID uuid.UUID, expectedVersion int64) error {
 	query := `
-	DELETE FROM passwords
-	WHERE id = $1 AND user_id = $2
+	UPDATE passwords
+	SET deleted_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3)
 	`
-	_, err := p.db.Exec(ctx, query, passwordID, userID)
-	return err
+	cmd, err := p.db.Exec(ctx, query, passwordID, userID, expectedVersion)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return p.missing(ctx, userID, passwordID, expectedVersion)
+	}
+	return nil
 }
 
 // Search password entries for a user in the database based on name or username
 func (p *PasswordsPostgresRepository) Search(ctx context.Context, userID uuid.UUID, searchQuery string) ([]*Password, error) {
 	query := `
-	SELECT id, user_id, name, username, ciphertext, nonce, encrypt_version, created_at, updated_at
+	SELECT id, user_id, name, username, ciphertext, nonce, encrypt_version, require_reauth, version, created_at, updated_at
 	FROM passwords
-	WHERE (name ILIKE $1 OR username ILIKE $1) AND user_id = $2
+	WHERE (name ILIKE $1 OR username ILIKE $1) AND user_id = $2 AND deleted_at IS NULL
 	ORDER BY created_at DESC
 	`
 	rows, err := p.db.Query(ctx, query, "%"+searchQuery+"%", userID)
@@ -204,6 +331,8 @@ func (p *PasswordsPostgresRepository) Search(ctx context.Context, userID uuid.UU
 			&password.Ciphertext,
 			&password.Nonce,
 			&password.EncryptVersion,
+			&password.RequireReauth,
+			&password.Version,
 			&password.CreatedAt,
 			&password.UpdatedAt,
 		); err != nil {
@@ -14,7 +14,11 @@ func Routes(h *PasswordHandler) chi.Router {
 	r.Post("/", h.createPassword)
 	r.Get("/{id}", h.getPassword)
 	r.Put("/{id}", h.updatePassword)
-	r.Delete("/{id}", h.deletePassword)
+	r.Patch("/{id}", h.patchPassword)
+
+	// Sensitive operations require the user to have authenticated recently (see POST /users/reauth)
+	r.With(middleware.RequireRecentAuth).Get("/export", h.exportPasswords)
+	r.With(middleware.RequireRecentAuth).Delete("/{id}", h.deletePassword)
 
 	return r
 }
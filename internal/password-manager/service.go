@@ -2,10 +2,15 @@ package passwordmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/subrat-dwi/shubserver/internal/auth"
+	"github.com/subrat-dwi/shubserver/internal/envelope"
+	"github.com/subrat-dwi/shubserver/internal/utils"
 )
 
 // Validation constants
@@ -14,12 +19,16 @@ const (
 	MaxNameLength     = 255
 	MinUsernameLength = 1
 	MaxUsernameLength = 255
-	MaxCiphertextSize = 1024 * 1024 // 1 MB
-	ExpectedNonceSize = 12          // GCM standard: 96 bits = 12 bytes
-	MinCiphertextSize = 1           // At least 1 byte
-	MaxEncryptVersion = 1
+	MaxCiphertextSize = envelope.MaxCiphertextSize
+	ExpectedNonceSize = envelope.NonceSize
+	MinCiphertextSize = envelope.MinCiphertextSize
+	MaxEncryptVersion = envelope.MaxVersion
 )
 
+// ErrReauthRequired is returned when require_reauth of an entry is turned off by a session
+// that didn't reauthenticate recently
+var ErrReauthRequired = errors.New("turning off require_reauth needs a recent authentication, see POST /users/reauth")
+
 // PasswordService struct
 type PasswordService struct {
 	repo PasswordRepository
@@ -107,44 +116,25 @@ func (s *PasswordService) validateUsername(username string) error {
 
 // validateCiphertext validates the encrypted password data
 func (s *PasswordService) validateCiphertext(ciphertext []byte) error {
-	if len(ciphertext) == 0 {
-		return fmt.Errorf("ciphertext cannot be empty")
-	}
-
-	if len(ciphertext) < MinCiphertextSize {
-		return fmt.Errorf("ciphertext must be at least %d byte(s), got %d", MinCiphertextSize, len(ciphertext))
-	}
-
-	if len(ciphertext) > MaxCiphertextSize {
-		return fmt.Errorf("ciphertext must not exceed %d bytes (1 MB), got %d bytes", MaxCiphertextSize, len(ciphertext))
-	}
-
-	return nil
+	return envelope.ValidateCiphertext(ciphertext)
 }
 
 // validateNonce validates the encryption nonce (GCM expects exactly 12 bytes)
 func (s *PasswordService) validateNonce(nonce []byte) error {
-	if len(nonce) == 0 {
-		return fmt.Errorf("nonce cannot be empty")
-	}
-
-	if len(nonce) != ExpectedNonceSize {
-		return fmt.Errorf("nonce must be exactly %d bytes for AES-GCM, got %d bytes", ExpectedNonceSize, len(nonce))
-	}
-
-	return nil
+	return envelope.ValidateNonce(nonce)
 }
 
 // validateEncryptVersion validates the encryption version for future compatibility
 func (s *PasswordService) validateEncryptVersion(version int) error {
-	if version <= 0 {
-		return fmt.Errorf("encryption version must be greater than 0, got %d", version)
-	}
+	return envelope.ValidateVersion(version)
+}
 
-	if version > MaxEncryptVersion {
-		return fmt.Errorf("unsupported encryption version %d (current supported: %d)", version, MaxEncryptVersion)
+// checkReauthChange refuses to turn off require_reauth of an entry unless the session of ctx
+// recently reauthenticated, otherwise any token could lift the step-up on the ciphertext
+func checkReauthChange(ctx context.Context, current *Password, requireReauth bool) error {
+	if current.RequireReauth && !requireReauth && !auth.IsRecentlyAuthenticated(ctx) {
+		return ErrReauthRequired
 	}
-
 	return nil
 }
 
@@ -160,12 +150,35 @@ func (s *PasswordService) CreatePassword(ctx context.Context, password *Password
 	return s.repo.Create(ctx, password)
 }
 
-// ListPasswords lists all password entries for a user
-func (s *PasswordService) ListPasswords(ctx context.Context, userID uuid.UUID, searchQuery string) ([]*Password, error) {
+// ListPasswords lists a page of password entries for a user
+func (s *PasswordService) ListPasswords(ctx context.Context, userID uuid.UUID, searchQuery string, page *utils.PageRequest) (*utils.Page[*Password], error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID cannot be empty")
+	}
+	return s.repo.List(ctx, userID, searchQuery, page)
+}
+
+// ExportPasswords returns every password entry of a user, oldest first
+func (s *PasswordService) ExportPasswords(ctx context.Context, userID uuid.UUID) ([]*Password, error) {
 	if userID == uuid.Nil {
 		return nil, fmt.Errorf("user ID cannot be empty")
 	}
-	return s.repo.List(ctx, userID, searchQuery)
+
+	page := &utils.PageRequest{Limit: utils.MaxPageLimit, Sort: SortKeys[0]}
+	var all []*Password
+	for {
+		result, err := s.repo.List(ctx, userID, "", page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, result.Items...)
+
+		if result.NextCursor == "" {
+			return all, nil
+		}
+		last := result.Items[len(result.Items)-1]
+		page.Cursor = &utils.Cursor{Sort: page.Sort, Value: utils.FormatCursorTime(last.CreatedAt), ID: last.ID.String()}
+	}
 }
 
 // GetPassword retrieves a specific password entry by ID
@@ -179,8 +192,9 @@ func (s *PasswordService) GetPassword(ctx context.Context, userID, passwordID uu
 	return s.repo.Get(ctx, userID, passwordID)
 }
 
-// UpdatePassword updates an existing password entry
-func (s *PasswordService) UpdatePassword(ctx context.Context, password *Password) (*Password, error) {
+// UpdatePassword updates an existing password entry, expectedVersion 0 updates any version.
+// A nil requireReauth keeps the stored flag; turning it off needs a recent authentication.
+func (s *PasswordService) UpdatePassword(ctx context.Context, password *Password, requireReauth *bool, expectedVersion int64) (*Password, error) {
 	// Validate ID fields
 	if password.UserID == uuid.Nil {
 		return nil, fmt.Errorf("user ID cannot be empty")
@@ -194,16 +208,102 @@ func (s *PasswordService) UpdatePassword(ctx context.Context, password *Password
 		return nil, err
 	}
 
-	return s.repo.Update(ctx, password)
+	current, err := s.GetPassword(ctx, password.UserID, password.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPasswordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && current.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	password.RequireReauth = current.RequireReauth
+	if requireReauth != nil {
+		if err := checkReauthChange(ctx, current, *requireReauth); err != nil {
+			return nil, err
+		}
+		password.RequireReauth = *requireReauth
+	}
+
+	// The flag was checked against this version, it must still be current when it is saved
+	return s.repo.Update(ctx, password, current.Version)
+}
+
+// PasswordPatch is a partial update of a password entry, nil fields are kept
+type PasswordPatch struct {
+	Name          *string
+	Username      *string
+	Ciphertext    []byte
+	Nonce         []byte
+	RequireReauth *bool
+}
+
+// PatchPassword changes the fields set in patch, validating only those.
+// A new ciphertext always comes with a new nonce, expectedVersion 0 patches any version.
+// Turning require_reauth off needs a recent authentication.
+func (s *PasswordService) PatchPassword(ctx context.Context, userID, passwordID uuid.UUID, patch *PasswordPatch, expectedVersion int64) (*Password, error) {
+	if (patch.Ciphertext == nil) != (patch.Nonce == nil) {
+		return nil, utils.NewValidationError("password and nonce must be changed together")
+	}
+	if patch.Name != nil {
+		if err := s.validateName(*patch.Name); err != nil {
+			return nil, utils.NewValidationError(err.Error())
+		}
+	}
+	if patch.Username != nil {
+		if err := s.validateUsername(*patch.Username); err != nil {
+			return nil, utils.NewValidationError(err.Error())
+		}
+	}
+	if patch.Ciphertext != nil {
+		if err := s.validateCiphertext(patch.Ciphertext); err != nil {
+			return nil, utils.NewValidationError(err.Error())
+		}
+		if err := s.validateNonce(patch.Nonce); err != nil {
+			return nil, utils.NewValidationError(err.Error())
+		}
+	}
+
+	password, err := s.GetPassword(ctx, userID, passwordID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPasswordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && password.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	if patch.Name != nil {
+		password.Name = *patch.Name
+	}
+	if patch.Username != nil {
+		password.Username = *patch.Username
+	}
+	if patch.Ciphertext != nil {
+		password.Ciphertext, password.Nonce, password.EncryptVersion = patch.Ciphertext, patch.Nonce, 1
+	}
+	if patch.RequireReauth != nil {
+		if err := checkReauthChange(ctx, password, *patch.RequireReauth); err != nil {
+			return nil, err
+		}
+		password.RequireReauth = *patch.RequireReauth
+	}
+
+	// The patch was applied to this version, it must still be current when it is saved
+	return s.repo.Update(ctx, password, password.Version)
 }
 
-// DeletePassword deletes a password entry by ID
-func (s *PasswordService) DeletePassword(ctx context.Context, userID, passwordID uuid.UUID) error {
+// DeletePassword moves a password entry to the trash by ID, expectedVersion 0 deletes any version
+func (s *PasswordService) DeletePassword(ctx context.Context, userID, passwordID uuid.UUID, expectedVersion int64) error {
 	if userID == uuid.Nil {
 		return fmt.Errorf("user ID cannot be empty")
 	}
 	if passwordID == uuid.Nil {
 		return fmt.Errorf("password ID cannot be empty")
 	}
-	return s.repo.Delete(ctx, userID, passwordID)
+	return s.repo.Delete(ctx, userID, passwordID, expectedVersion)
 }
@@ -0,0 +1,202 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/mailer"
+)
+
+// Notification kind of in-app reminders
+const notificationKindReminder = "reminder"
+
+// webhookTimeout limits one webhook request
+const webhookTimeout = 10 * time.Second
+
+// Deliverer delivers a fired reminder over one channel
+type Deliverer interface {
+	Deliver(ctx context.Context, d *Delivery) error
+}
+
+// Notifier stores an in-app notification for a user.
+// Implemented by the notifications module.
+type Notifier interface {
+	NotifyUser(ctx context.Context, userID uuid.UUID, email, kind, title, body string, data map[string]string) error
+}
+
+// reminderText returns the subject and body of a reminder
+func reminderText(d *Delivery) (string, string) {
+	at := d.OccurrenceAt
+	if loc, err := time.LoadLocation(d.Timezone); err == nil {
+		at = at.In(loc)
+	}
+
+	body := d.Message
+	if body == "" {
+		body = "You asked to be reminded of this note."
+	}
+	return "Reminder: " + d.NoteTitle, body + "\n\nDue " + at.Format("Mon, 2 Jan 2006 15:04 MST")
+}
+
+// ------ Email ------
+
+// EmailDeliverer emails reminders to the address of the user
+type EmailDeliverer struct {
+	mailer mailer.Mailer
+}
+
+// NewEmailDeliverer creates the email channel
+func NewEmailDeliverer(m mailer.Mailer) *EmailDeliverer {
+	return &EmailDeliverer{mailer: m}
+}
+
+// Deliver emails the reminder
+func (e *EmailDeliverer) Deliver(ctx context.Context, d *Delivery) error {
+	subject, body := reminderText(d)
+	return e.mailer.Send(ctx, d.Email, subject, body)
+}
+
+// ------ In-app ------
+
+// InAppDeliverer adds reminders to the in-app notifications of the user
+type InAppDeliverer struct {
+	notifier Notifier
+}
+
+// NewInAppDeliverer creates the in-app channel
+func NewInAppDeliverer(notifier Notifier) *InAppDeliverer {
+	return &InAppDeliverer{notifier: notifier}
+}
+
+// Deliver stores the reminder as a notification, without email
+func (i *InAppDeliverer) Deliver(ctx context.Context, d *Delivery) error {
+	title, body := reminderText(d)
+	return i.notifier.NotifyUser(ctx, d.UserID, "", notificationKindReminder, title, body, map[string]string{
+		"reminder_id":   d.ReminderID.String(),
+		"note_id":       d.NoteID.String(),
+		"occurrence_at": d.OccurrenceAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// ------ Webhook ------
+
+// WebhookPayload is the JSON body POSTed to the webhook of a reminder
+type WebhookPayload struct {
+	DeliveryID   uuid.UUID `json:"delivery_id"`
+	ReminderID   uuid.UUID `json:"reminder_id"`
+	NoteID       uuid.UUID `json:"note_id"`
+	NoteTitle    string    `json:"note_title"`
+	Message      string    `json:"message"`
+	OccurrenceAt time.Time `json:"occurrence_at"`
+	Timezone     string    `json:"timezone"`
+}
+
+// WebhookDeliverer POSTs reminders to the webhook URL of the reminder. The body is signed
+// with the webhook secret in X-Reminder-Signature (sha256=<hex HMAC-SHA256>), and the
+// delivery ID in X-Reminder-Delivery lets receivers drop retried duplicates.
+type WebhookDeliverer struct {
+	client *http.Client
+}
+
+// NewWebhookDeliverer creates the webhook channel. Webhooks can't reach private,
+// loopback or link-local addresses, so users can't probe the server's network.
+func NewWebhookDeliverer() *WebhookDeliverer {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	}
+	return &WebhookDeliverer{client: &http.Client{
+		Transport: transport,
+		Timeout:   webhookTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// publicIP is false for addresses of the local network
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute http(s) URL
+func validateWebhookURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("webhook_url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return errors.New("webhook_url can't contain credentials")
+	}
+	return nil
+}
+
+// Sign returns the signature of a webhook body, receivers compare it to X-Reminder-Signature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver POSTs the reminder, any status but 2xx is a failure
+func (wd *WebhookDeliverer) Deliver(ctx context.Context, d *Delivery) error {
+	body, err := json.Marshal(WebhookPayload{
+		DeliveryID:   d.ID,
+		ReminderID:   d.ReminderID,
+		NoteID:       d.NoteID,
+		NoteTitle:    d.NoteTitle,
+		Message:      d.Message,
+		OccurrenceAt: d.OccurrenceAt.UTC(),
+		Timezone:     d.Timezone,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shubserver-reminders")
+	req.Header.Set("X-Reminder-Delivery", d.ID.String())
+	req.Header.Set("X-Reminder-Signature", Sign(d.WebhookSecret, body))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", strings.TrimSpace(resp.Status))
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package reminders
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Reminder limits
+const (
+	MaxMessageLength     = 500
+	DefaultUpcomingDays  = 7
+	MaxUpcomingDays      = 90
+	DefaultUpcomingLimit = 100
+	MaxUpcomingLimit     = 500
+	webhookSecretBytes   = 32
+)
+
+// Handler struct for reminders
+type RemindersHandler struct {
+	repo RemindersRepository
+}
+
+// Constructor for handler
+func NewRemindersHandler(repo RemindersRepository) *RemindersHandler {
+	return &RemindersHandler{repo: repo}
+}
+
+// Request struct for creating or replacing a reminder, note_id is only read on create
+type ReminderRequest struct {
+	NoteID     uuid.UUID `json:"note_id"`
+	Message    string    `json:"message"`
+	DueAt      string    `json:"due_at"`   // RFC 3339, or a local time in timezone
+	Timezone   string    `json:"timezone"` // IANA name
+	RRule      *string   `json:"rrule"`
+	Channels   []string  `json:"channels"` // in_app when empty
+	WebhookURL *string   `json:"webhook_url"`
+}
+
+// Response struct for the upcoming occurrences
+type UpcomingResponse struct {
+	From        time.Time     `json:"from"`
+	Until       time.Time     `json:"until"`
+	Occurrences []*Occurrence `json:"occurrences"`
+}
+
+// apply validates the request and sets the fields of the reminder, including its next occurrence
+func (req *ReminderRequest) apply(rem *Reminder, now time.Time) error {
+	if len(req.Message) > MaxMessageLength {
+		return utils.NewValidationError(fmt.Sprintf("message must be at most %d characters", MaxMessageLength))
+	}
+
+	loc, err := loadLocation(req.Timezone)
+	if err != nil {
+		return err
+	}
+	if req.DueAt == "" {
+		return utils.NewValidationError("due_at is required")
+	}
+	dueAt, err := parseDueAt(req.DueAt, loc)
+	if err != nil {
+		return err
+	}
+
+	var rule *string
+	if req.RRule != nil && strings.TrimSpace(*req.RRule) != "" {
+		normalized, err := parseRule(*req.RRule, loc)
+		if err != nil {
+			return err
+		}
+		rule = &normalized
+	}
+
+	channels := []string{}
+	for _, c := range req.Channels {
+		if c != ChannelEmail && c != ChannelInApp && c != ChannelWebhook {
+			return utils.NewValidationError("channels must be email, in_app or webhook")
+		}
+		if !slices.Contains(channels, c) {
+			channels = append(channels, c)
+		}
+	}
+	if len(channels) == 0 {
+		channels = []string{ChannelInApp}
+	}
+
+	var webhookURL *string
+	if req.WebhookURL != nil && *req.WebhookURL != "" {
+		if err := validateWebhookURL(*req.WebhookURL); err != nil {
+			return utils.NewValidationError(err.Error())
+		}
+		webhookURL = req.WebhookURL
+	}
+	if slices.Contains(channels, ChannelWebhook) && webhookURL == nil {
+		return utils.NewValidationError("webhook_url is required for the webhook channel")
+	}
+
+	rem.Message = req.Message
+	rem.DueAt = dueAt
+	rem.Timezone = loc.String()
+	rem.RRule = rule
+	rem.Channels = channels
+	rem.WebhookURL = webhookURL
+
+	s, err := newSchedule(rem)
+	if err != nil {
+		return utils.NewValidationError("invalid rrule: " + err.Error())
+	}
+	rem.NextFireAt = s.next(now)
+	if rem.NextFireAt == nil {
+		if rule == nil {
+			return utils.NewValidationError("due_at must be in the future")
+		}
+		return utils.NewValidationError("the rrule has no occurrence in the future")
+	}
+
+	return nil
+}
+
+// newWebhookSecret generates the key webhook bodies are signed with
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RemindersHandler to list the reminders of the user, ?note_id= limits it to one note
+func (h *RemindersHandler) listReminders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var noteID *uuid.UUID
+	if value := r.URL.Query().Get("note_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			utils.Error(w, http.StatusBadRequest, "invalid note ID")
+			return
+		}
+		noteID = &id
+	}
+
+	list, err := h.repo.List(r.Context(), userID, noteID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to list reminders")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, list)
+}
+
+// RemindersHandler to list the occurrences of the user's reminders in the next ?days= (7 by default),
+// at most ?limit= of them (100 by default). Recurring reminders are expanded.
+func (h *RemindersHandler) upcomingReminders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	days, err := queryInt(r, "days", DefaultUpcomingDays, MaxUpcomingDays)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(r, "limit", DefaultUpcomingLimit, MaxUpcomingLimit)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	until := now.AddDate(0, 0, days)
+
+	list, err := h.repo.ListActive(r.Context(), userID, until)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to list reminders")
+		return
+	}
+
+	occurrences := []*Occurrence{}
+	for _, rem := range list {
+		s, err := newSchedule(rem)
+		if err != nil {
+			continue
+		}
+		// A reminder the scheduler hasn't fired yet is still upcoming
+		for _, at := range s.between(*rem.NextFireAt, until, limit) {
+			occurrences = append(occurrences, &Occurrence{
+				ReminderID: rem.ID,
+				NoteID:     rem.NoteID,
+				NoteTitle:  rem.NoteTitle,
+				Message:    rem.Message,
+				At:         at,
+				Timezone:   rem.Timezone,
+				Recurring:  rem.RRule != nil,
+			})
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].At.Before(occurrences[j].At)
+	})
+	if len(occurrences) > limit {
+		occurrences = occurrences[:limit]
+	}
+
+	utils.JSON(w, http.StatusOK, UpcomingResponse{From: now, Until: until, Occurrences: occurrences})
+}
+
+// RemindersHandler to create a reminder on a note the user owns or that is shared with them
+func (h *RemindersHandler) createReminder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req ReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.NoteID == uuid.Nil {
+		utils.Error(w, http.StatusBadRequest, "note_id is required")
+		return
+	}
+
+	rem := &Reminder{NoteID: req.NoteID, UserID: userID}
+	if err := req.apply(rem, time.Now()); err != nil {
+		reminderError(w, err, "failed to create reminder")
+		return
+	}
+
+	// The secret is only shown now, receivers need it to check signatures
+	if rem.WebhookURL != nil {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, "failed to create reminder")
+			return
+		}
+		rem.WebhookSecret = secret
+	}
+
+	if err := h.repo.Create(r.Context(), rem); err != nil {
+		reminderError(w, err, "failed to create reminder")
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, rem)
+}
+
+// RemindersHandler to get a reminder
+func (h *RemindersHandler) getReminder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid ID")
+		return
+	}
+
+	rem, err := h.repo.Get(r.Context(), userID, id)
+	if err != nil {
+		reminderError(w, err, "failed to get reminder")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, rem)
+}
+
+// RemindersHandler to replace the message, timing and channels of a reminder.
+// Its occurrences start over from the new schedule.
+func (h *RemindersHandler) updateReminder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid ID")
+		return
+	}
+
+	var req ReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	rem, err := h.repo.Get(r.Context(), userID, id)
+	if err != nil {
+		reminderError(w, err, "failed to update reminder")
+		return
+	}
+	hadWebhook := rem.WebhookURL != nil
+
+	if err := req.apply(rem, time.Now()); err != nil {
+		reminderError(w, err, "failed to update reminder")
+		return
+	}
+
+	// A webhook added now gets a fresh secret, shown in this response only
+	if rem.WebhookURL != nil && !hadWebhook {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, "failed to update reminder")
+			return
+		}
+		rem.WebhookSecret = secret
+	}
+
+	if err := h.repo.Update(r.Context(), rem); err != nil {
+		reminderError(w, err, "failed to update reminder")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, rem)
+}
+
+// RemindersHandler to delete a reminder
+func (h *RemindersHandler) deleteReminder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid ID")
+		return
+	}
+
+	if err := h.repo.Delete(r.Context(), userID, id); err != nil {
+		reminderError(w, err, "failed to delete reminder")
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// queryInt reads an integer query parameter between 1 and max, def when absent
+func queryInt(r *http.Request, name string, def, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, max)
+	}
+	return n, nil
+}
+
+// reminderError writes the response for a validation or repository error
+func reminderError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case utils.IsValidationError(err):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrReminderNotFound), errors.Is(err, ErrNoteNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, message)
+	}
+}
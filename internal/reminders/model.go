@@ -0,0 +1,86 @@
+package reminders
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery channels of a reminder
+const (
+	ChannelEmail   = "email"
+	ChannelInApp   = "in_app"
+	ChannelWebhook = "webhook"
+)
+
+// Statuses of a delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Reminder is a one-off or recurring reminder on a note. Times are returned in the
+// reminder's time zone.
+type Reminder struct {
+	ID            uuid.UUID  `json:"id"`
+	NoteID        uuid.UUID  `json:"note_id"`
+	UserID        uuid.UUID  `json:"-"`
+	NoteTitle     string     `json:"note_title"`
+	Message       string     `json:"message"`
+	DueAt         time.Time  `json:"due_at"`   // first occurrence
+	Timezone      string     `json:"timezone"` // IANA name, e.g. Europe/Berlin
+	RRule         *string    `json:"rrule"`    // RFC 5545 recurrence rule, nil for a one-off reminder
+	Channels      []string   `json:"channels"`
+	WebhookURL    *string    `json:"webhook_url,omitempty"`
+	WebhookSecret string     `json:"webhook_secret,omitempty"` // only returned when it is generated
+	NextFireAt    *time.Time `json:"next_fire_at"`             // nil once the reminder is over
+	LastFiredAt   *time.Time `json:"last_fired_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Occurrence is an upcoming occurrence of a reminder
+type Occurrence struct {
+	ReminderID uuid.UUID `json:"reminder_id"`
+	NoteID     uuid.UUID `json:"note_id"`
+	NoteTitle  string    `json:"note_title"`
+	Message    string    `json:"message"`
+	At         time.Time `json:"at"`
+	Timezone   string    `json:"timezone"`
+	Recurring  bool      `json:"recurring"`
+}
+
+// Delivery is a fired occurrence of a reminder being delivered over one channel
+type Delivery struct {
+	ID            uuid.UUID
+	ReminderID    uuid.UUID
+	NoteID        uuid.UUID
+	UserID        uuid.UUID
+	Email         string
+	Channel       string
+	OccurrenceAt  time.Time
+	Attempts      int // including the current one
+	NoteTitle     string
+	Message       string
+	Timezone      string
+	WebhookURL    string
+	WebhookSecret string
+}
+
+// localize returns the times of the reminder in its time zone
+func (r *Reminder) localize() {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return
+	}
+	r.DueAt = r.DueAt.In(loc)
+	if r.NextFireAt != nil {
+		t := r.NextFireAt.In(loc)
+		r.NextFireAt = &t
+	}
+	if r.LastFiredAt != nil {
+		t := r.LastFiredAt.In(loc)
+		r.LastFiredAt = &t
+	}
+}
@@ -0,0 +1,123 @@
+package reminders
+
+import (
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones work without the system database
+
+	"github.com/subrat-dwi/shubserver/internal/utils"
+	"github.com/teambition/rrule-go"
+)
+
+// localLayout is a due time without offset, read in the time zone of the reminder
+const localLayout = "2006-01-02T15:04:05"
+
+// schedule computes the occurrences of a reminder in its time zone, so recurring
+// reminders keep their wall-clock time across daylight saving changes
+type schedule struct {
+	start time.Time
+	rule  *rrule.RRule // nil for a one-off reminder
+}
+
+// loadLocation loads a time zone by IANA name, UTC isn't assumed for an empty name
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, utils.NewValidationError("timezone is required")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, utils.NewValidationError("unknown timezone " + name)
+	}
+	return loc, nil
+}
+
+// parseDueAt reads an RFC 3339 time or a local time like 2026-03-01T09:00:00 in loc
+func parseDueAt(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+	if t, err := time.ParseInLocation(localLayout, value, loc); err == nil {
+		return t, nil
+	}
+	return time.Time{}, utils.NewValidationError("due_at must be an RFC 3339 timestamp or a local time like 2006-01-02T15:04:05")
+}
+
+// parseRule validates a recurrence rule and returns it normalized. DTSTART comes from
+// due_at, and rules firing more than hourly are refused.
+func parseRule(value string, loc *time.Location) (string, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if strings.Contains(strings.ToUpper(value), "DTSTART") {
+		return "", utils.NewValidationError("rrule can't contain DTSTART, the first occurrence is due_at")
+	}
+
+	opt, err := rrule.StrToROptionInLocation(value, loc)
+	if err != nil {
+		return "", utils.NewValidationError("invalid rrule: " + err.Error())
+	}
+	// More than one minute an hour would fire several times an hour, e.g. FREQ=HOURLY;BYMINUTE=0,30
+	if opt.Freq == rrule.SECONDLY || opt.Freq == rrule.MINUTELY || len(opt.Bysecond) > 0 || len(opt.Byminute) > 1 {
+		return "", utils.NewValidationError("reminders can recur at most hourly")
+	}
+	if _, err := rrule.NewRRule(*opt); err != nil {
+		return "", utils.NewValidationError("invalid rrule: " + err.Error())
+	}
+
+	return opt.RRuleString(), nil
+}
+
+// newSchedule builds the schedule of a reminder whose fields were validated
+func newSchedule(r *Reminder) (*schedule, error) {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	s := &schedule{start: r.DueAt.In(loc).Truncate(time.Second)}
+	if r.RRule == nil {
+		return s, nil
+	}
+
+	opt, err := rrule.StrToROptionInLocation(*r.RRule, loc)
+	if err != nil {
+		return nil, err
+	}
+	opt.Dtstart = s.start
+	if s.rule, err = rrule.NewRRule(*opt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// next returns the first occurrence after t, nil when there are no more
+func (s *schedule) next(t time.Time) *time.Time {
+	if s.rule == nil {
+		if s.start.After(t) {
+			return &s.start
+		}
+		return nil
+	}
+
+	next := s.rule.After(t, false)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// between returns up to limit occurrences from after (inclusive) until before
+func (s *schedule) between(after, before time.Time, limit int) []time.Time {
+	list := []time.Time{}
+	if s.rule == nil {
+		if !s.start.Before(after) && s.start.Before(before) {
+			list = append(list, s.start)
+		}
+		return list
+	}
+
+	for _, t := range s.rule.Between(after, before, true) {
+		if len(list) == limit || !t.Before(before) {
+			break
+		}
+		list = append(list, t)
+	}
+	return list
+}
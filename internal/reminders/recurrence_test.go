@@ -0,0 +1,81 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+func TestParseRule(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "FREQ=WEEKLY;BYDAY=MO,FR", want: "FREQ=WEEKLY;BYDAY=MO,FR"},
+		{value: "RRULE:FREQ=DAILY;COUNT=3", want: "FREQ=DAILY;COUNT=3"},
+		{value: "FREQ=HOURLY;BYMINUTE=0", want: "FREQ=HOURLY;BYMINUTE=0"},
+		{value: "FREQ=DAILY;UNTIL=20260401T000000Z", want: "FREQ=DAILY;UNTIL=20260401T000000Z"},
+		{value: "", wantErr: true},
+		{value: "freq=daily", wantErr: true},
+		{value: "FREQ=FOO", wantErr: true},
+		{value: "FREQ=MINUTELY", wantErr: true},
+		{value: "FREQ=HOURLY;BYMINUTE=0,30", wantErr: true},
+		{value: "FREQ=DAILY;BYSECOND=5", wantErr: true},
+		{value: "DTSTART:20260101T090000Z\nFREQ=DAILY", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseRule(tt.value, loc)
+			if tt.wantErr {
+				if !utils.IsValidationError(err) {
+					t.Errorf("parseRule() error = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseRule() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleKeepsLocalTimeAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+	rule := "FREQ=DAILY"
+	s, err := newSchedule(&Reminder{
+		DueAt:    time.Date(2026, 3, 27, 9, 0, 0, 0, loc),
+		Timezone: "Europe/Berlin",
+		RRule:    &rule,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Summer time starts on 29 March 2026
+	tests := []struct {
+		after time.Time
+		want  time.Time
+	}{
+		{time.Date(2026, 3, 27, 9, 0, 0, 0, loc), time.Date(2026, 3, 28, 9, 0, 0, 0, loc)},
+		{time.Date(2026, 3, 28, 9, 0, 0, 0, loc), time.Date(2026, 3, 29, 9, 0, 0, 0, loc)},
+		{time.Date(2026, 3, 29, 9, 0, 0, 0, loc), time.Date(2026, 3, 30, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		got := s.next(tt.after)
+		if got == nil || !got.Equal(tt.want) {
+			t.Errorf("next(%v) = %v, want %v", tt.after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Reminder errors
+var (
+	ErrReminderNotFound = errors.New("reminder not found")
+	ErrNoteNotFound     = errors.New("note not found")
+)
+
+// noteAccess is true when the user of the reminders row r can read the notes row n
+const noteAccess = `(n.deleted_at IS NULL AND (n.user_id = r.user_id OR EXISTS (
+	SELECT 1 FROM note_shares s WHERE s.note_id = n.id AND s.user_id = r.user_id
+)))`
+
+// reminderColumns is the column list selected for a Reminder, in scanReminder order
+const reminderColumns = `r.id, r.note_id, r.user_id, COALESCE(NULLIF(n.title, ''), 'Encrypted note'), r.message,
+	r.due_at, r.timezone, r.rrule, r.channels, r.webhook_url, r.next_fire_at, r.last_fired_at, r.created_at, r.updated_at`
+
+// Repository Interface
+type RemindersRepository interface {
+	Create(ctx context.Context, r *Reminder) error
+	Get(ctx context.Context, userID, id uuid.UUID) (*Reminder, error)
+	List(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID) ([]*Reminder, error)
+	ListActive(ctx context.Context, userID uuid.UUID, before time.Time) ([]*Reminder, error)
+	Update(ctx context.Context, r *Reminder) error
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	FireDue(ctx context.Context, now time.Time, limit int) (int, error)
+	ClaimDeliveries(ctx context.Context, lease time.Duration, limit int) ([]*Delivery, error)
+	MarkDelivered(ctx context.Context, id uuid.UUID) error
+	MarkFailed(ctx context.Context, id uuid.UUID, message string, retryAt *time.Time) error
+}
+
+// Postgres Repository
+type RemindersPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewRemindersPostgresRepository(db *pgxpool.Pool) *RemindersPostgresRepository {
+	return &RemindersPostgresRepository{db: db}
+}
+
+// scanReminder scans a row selected with reminderColumns
+func scanReminder(row pgx.Row, r *Reminder) error {
+	if err := row.Scan(&r.ID, &r.NoteID, &r.UserID, &r.NoteTitle, &r.Message, &r.DueAt, &r.Timezone, &r.RRule,
+		&r.Channels, &r.WebhookURL, &r.NextFireAt, &r.LastFiredAt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return err
+	}
+	r.localize()
+	return nil
+}
+
+// listReminders runs a query selecting reminderColumns
+func (p *RemindersPostgresRepository) listReminders(ctx context.Context, query string, args ...any) ([]*Reminder, error) {
+	rows, err := p.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Reminder{}
+	for rows.Next() {
+		var r Reminder
+		if err := scanReminder(rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, &r)
+	}
+
+	return list, rows.Err()
+}
+
+// Create a reminder on a note the user owns or that is shared with them
+func (p *RemindersPostgresRepository) Create(ctx context.Context, r *Reminder) error {
+	query := `
+	INSERT INTO reminders(note_id, user_id, message, due_at, timezone, rrule, channels, webhook_url, webhook_secret, next_fire_at)
+	SELECT n.id, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10
+	FROM notes n, (SELECT $2::uuid AS user_id) r
+	WHERE n.id = $1 AND ` + noteAccess + `
+	RETURNING id, COALESCE(NULLIF((SELECT title FROM notes WHERE id = $1), ''), 'Encrypted note'), created_at, updated_at
+	`
+
+	err := p.db.QueryRow(ctx, query, r.NoteID, r.UserID, r.Message, r.DueAt, r.Timezone, r.RRule, r.Channels,
+		r.WebhookURL, r.WebhookSecret, r.NextFireAt).Scan(&r.ID, &r.NoteTitle, &r.CreatedAt, &r.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoteNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	r.localize()
+	return nil
+}
+
+// Get a reminder of the user
+func (p *RemindersPostgresRepository) Get(ctx context.Context, userID, id uuid.UUID) (*Reminder, error) {
+	var r Reminder
+	err := scanReminder(p.db.QueryRow(ctx, `
+	SELECT `+reminderColumns+`
+	FROM reminders r JOIN notes n ON n.id = r.note_id
+	WHERE r.id = $1 AND r.user_id = $2
+	`, id, userID), &r)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReminderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// List the reminders of the user, optionally only those on one note, next due first
+func (p *RemindersPostgresRepository) List(ctx context.Context, userID uuid.UUID, noteID *uuid.UUID) ([]*Reminder, error) {
+	return p.listReminders(ctx, `
+	SELECT `+reminderColumns+`
+	FROM reminders r JOIN notes n ON n.id = r.note_id
+	WHERE r.user_id = $1 AND ($2::uuid IS NULL OR r.note_id = $2)
+	ORDER BY r.next_fire_at NULLS LAST, r.created_at
+	`, userID, noteID)
+}
+
+// ListActive lists the reminders of the user that fire before a time on notes they can still read
+func (p *RemindersPostgresRepository) ListActive(ctx context.Context, userID uuid.UUID, before time.Time) ([]*Reminder, error) {
+	return p.listReminders(ctx, `
+	SELECT `+reminderColumns+`
+	FROM reminders r JOIN notes n ON n.id = r.note_id
+	WHERE r.user_id = $1 AND r.next_fire_at < $2 AND `+noteAccess+`
+	ORDER BY r.next_fire_at
+	`, userID, before)
+}
+
+// Update the message, timing and channels of a reminder of the user. A webhook secret
+// is only written when one is given.
+func (p *RemindersPostgresRepository) Update(ctx context.Context, r *Reminder) error {
+	query := `
+	UPDATE reminders
+	SET message = $3, due_at = $4, timezone = $5, rrule = $6, channels = $7, webhook_url = $8,
+		webhook_secret = COALESCE(NULLIF($9, ''), webhook_secret), next_fire_at = $10, updated_at = NOW()
+	WHERE id = $1 AND user_id = $2
+	RETURNING updated_at
+	`
+
+	err := p.db.QueryRow(ctx, query, r.ID, r.UserID, r.Message, r.DueAt, r.Timezone, r.RRule, r.Channels,
+		r.WebhookURL, r.WebhookSecret, r.NextFireAt).Scan(&r.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrReminderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	r.localize()
+	return nil
+}
+
+// Delete a reminder of the user, deliveries not sent yet are dropped with it
+func (p *RemindersPostgresRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	result, err := p.db.Exec(ctx, `DELETE FROM reminders WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrReminderNotFound
+	}
+	return nil
+}
+
+// FireDue fires up to limit reminders due at now and returns how many it handled. A delivery is queued per channel and the
+// reminder moves on to its first occurrence after now, so occurrences missed while the server
+// was down fire once. Reminders locked by another instance are skipped and the deliveries are
+// unique per occurrence, so an occurrence never fires twice. Reminders on notes the user can
+// no longer read move on without firing.
+func (p *RemindersPostgresRepository) FireDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT `+reminderColumns+`, `+noteAccess+`
+	FROM reminders r JOIN notes n ON n.id = r.note_id
+	WHERE r.next_fire_at <= $1
+	ORDER BY r.next_fire_at
+	LIMIT $2
+	FOR UPDATE OF r SKIP LOCKED
+	`, now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type due struct {
+		reminder *Reminder
+		live     bool
+	}
+	list := []due{}
+	for rows.Next() {
+		var d due
+		d.reminder = &Reminder{}
+		r := d.reminder
+		if err := rows.Scan(&r.ID, &r.NoteID, &r.UserID, &r.NoteTitle, &r.Message, &r.DueAt, &r.Timezone, &r.RRule,
+			&r.Channels, &r.WebhookURL, &r.NextFireAt, &r.LastFiredAt, &r.CreatedAt, &r.UpdatedAt, &d.live); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range list {
+		r := d.reminder
+		occurrence := *r.NextFireAt
+
+		var next *time.Time
+		if s, err := newSchedule(r); err != nil {
+			log.Printf("reminders: schedule of reminder %s: %v", r.ID, err)
+		} else {
+			next = s.next(now)
+		}
+
+		if d.live {
+			_, err := tx.Exec(ctx, `
+			INSERT INTO reminder_deliveries(reminder_id, channel, occurrence_at)
+			SELECT $1, channel, $3 FROM UNNEST($2::text[]) AS channel
+			ON CONFLICT (reminder_id, occurrence_at, channel) DO NOTHING
+			`, r.ID, r.Channels, occurrence)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		_, err := tx.Exec(ctx, `
+		UPDATE reminders SET next_fire_at = $2, last_fired_at = CASE WHEN $3 THEN $4 ELSE last_fired_at END
+		WHERE id = $1
+		`, r.ID, next, d.live, occurrence)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(list), tx.Commit(ctx)
+}
+
+// ClaimDeliveries claims up to limit deliveries due for sending. They are pushed back by
+// lease, so another instance only retries them when this one didn't finish in time.
+func (p *RemindersPostgresRepository) ClaimDeliveries(ctx context.Context, lease time.Duration, limit int) ([]*Delivery, error) {
+	rows, err := p.db.Query(ctx, `
+	WITH claimed AS (
+		SELECT id FROM reminder_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE reminder_deliveries d
+	SET attempts = d.attempts + 1, next_attempt_at = NOW() + $2::int * INTERVAL '1 second'
+	FROM claimed, reminders r, notes n, users u
+	WHERE d.id = claimed.id AND r.id = d.reminder_id AND n.id = r.note_id AND u.id = r.user_id
+	RETURNING d.id, d.reminder_id, r.note_id, r.user_id, u.email, d.channel, d.occurrence_at, d.attempts,
+		COALESCE(NULLIF(n.title, ''), 'Encrypted note'), r.message, r.timezone,
+		COALESCE(r.webhook_url, ''), COALESCE(r.webhook_secret, '')
+	`, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Delivery{}
+	for rows.Next() {
+		var d Delivery
+		if err := rows.Scan(&d.ID, &d.ReminderID, &d.NoteID, &d.UserID, &d.Email, &d.Channel, &d.OccurrenceAt, &d.Attempts,
+			&d.NoteTitle, &d.Message, &d.Timezone, &d.WebhookURL, &d.WebhookSecret); err != nil {
+			return nil, err
+		}
+		list = append(list, &d)
+	}
+
+	return list, rows.Err()
+}
+
+// MarkDelivered records that a delivery was sent
+func (p *RemindersPostgresRepository) MarkDelivered(ctx context.Context, id uuid.UUID) error {
+	_, err := p.db.Exec(ctx, `
+	UPDATE reminder_deliveries SET status = 'delivered', delivered_at = NOW(), last_error = NULL
+	WHERE id = $1
+	`, id)
+	return err
+}
+
+// MarkFailed records a failed attempt, the delivery is retried at retryAt or given up when it is nil
+func (p *RemindersPostgresRepository) MarkFailed(ctx context.Context, id uuid.UUID, message string, retryAt *time.Time) error {
+	_, err := p.db.Exec(ctx, `
+	UPDATE reminder_deliveries
+	SET status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		next_attempt_at = COALESCE($3, next_attempt_at), last_error = $2
+	WHERE id = $1
+	`, id, message, retryAt)
+	return err
+}
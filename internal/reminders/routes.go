@@ -0,0 +1,21 @@
+package reminders
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the routes for the reminders module
+func Routes(h *RemindersHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.listReminders)
+	r.Get("/upcoming", h.upcomingReminders)
+	r.Post("/", h.createReminder)
+	r.Get("/{id}", h.getReminder)
+	r.Put("/{id}", h.updateReminder)
+	r.Delete("/{id}", h.deleteReminder)
+
+	return r
+}
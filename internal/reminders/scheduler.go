@@ -0,0 +1,118 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Scheduler settings
+const (
+	// ScheduleInterval is how often the scheduler looks for due reminders and deliveries
+	ScheduleInterval = 15 * time.Second
+	// deliveryLease is how long a delivery stays claimed by the instance sending it
+	deliveryLease = time.Minute
+	// maxDeliveryAttempts is how often a delivery is tried before it is given up
+	maxDeliveryAttempts = 5
+	// scheduleBatch is how many reminders or deliveries are handled per query
+	scheduleBatch = 100
+)
+
+// Scheduler fires due reminders and sends their deliveries. All its state is in the
+// database, so it picks up where it left off after a restart, and several instances
+// can run it side by side without firing or delivering anything twice.
+type Scheduler struct {
+	repo       RemindersRepository
+	deliverers map[string]Deliverer
+}
+
+// NewScheduler creates the background reminder scheduler, deliverers maps each channel to its Deliverer
+func NewScheduler(repo RemindersRepository, deliverers map[string]Deliverer) *Scheduler {
+	return &Scheduler{repo: repo, deliverers: deliverers}
+}
+
+// Run fires and delivers reminders right away and then every ScheduleInterval until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(ScheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		s.fire(ctx)
+		s.deliver(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fire queues the deliveries of every due reminder, errors are logged and retried on the next run
+func (s *Scheduler) fire(ctx context.Context) {
+	for {
+		handled, err := s.repo.FireDue(ctx, time.Now(), scheduleBatch)
+		if err != nil {
+			log.Printf("reminders: firing due reminders: %v", err)
+			return
+		}
+		if handled < scheduleBatch {
+			return
+		}
+	}
+}
+
+// deliver sends the pending deliveries, failures are retried with a growing delay
+func (s *Scheduler) deliver(ctx context.Context) {
+	for {
+		list, err := s.repo.ClaimDeliveries(ctx, deliveryLease, scheduleBatch)
+		if err != nil {
+			log.Printf("reminders: claiming deliveries: %v", err)
+			return
+		}
+
+		for _, d := range list {
+			s.send(ctx, d)
+		}
+
+		if len(list) < scheduleBatch {
+			return
+		}
+	}
+}
+
+// send delivers one fired reminder and records the outcome
+func (s *Scheduler) send(ctx context.Context, d *Delivery) {
+	deliverer, ok := s.deliverers[d.Channel]
+	if !ok {
+		s.failed(ctx, d, fmt.Errorf("no deliverer for channel %s", d.Channel), false)
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, deliveryLease/2)
+	err := deliverer.Deliver(sendCtx, d)
+	cancel()
+	if err != nil {
+		s.failed(ctx, d, err, d.Attempts < maxDeliveryAttempts)
+		return
+	}
+
+	if err := s.repo.MarkDelivered(ctx, d.ID); err != nil {
+		log.Printf("reminders: recording delivery %s: %v", d.ID, err)
+	}
+}
+
+// failed records a failed delivery, retried after 1, 2, 4... minutes when retry is set
+func (s *Scheduler) failed(ctx context.Context, d *Delivery, cause error, retry bool) {
+	log.Printf("reminders: %s delivery %s of reminder %s failed (attempt %d): %v", d.Channel, d.ID, d.ReminderID, d.Attempts, cause)
+
+	var retryAt *time.Time
+	if retry {
+		t := time.Now().Add(time.Minute << (d.Attempts - 1))
+		retryAt = &t
+	}
+	if err := s.repo.MarkFailed(ctx, d.ID, cause.Error(), retryAt); err != nil {
+		log.Printf("reminders: recording failed delivery %s: %v", d.ID, err)
+	}
+}
@@ -0,0 +1,284 @@
+package sharelinks
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Link limits
+const (
+	tokenBytes        = 32 // 256 bits, links can't be guessed
+	MaxPasswordLength = 72 // bcrypt only uses the first 72 bytes
+)
+
+// publicMediaTypes are the representations a link can be viewed in, HTML for browsers first
+var publicMediaTypes = []string{"text/html", "application/json"}
+
+// Handler struct for share links
+type ShareLinksHandler struct {
+	repo      ShareLinksRepository
+	publicURL string
+}
+
+// Constructor for handler, publicURL is the base of the link URLs
+func NewShareLinksHandler(repo ShareLinksRepository, publicURL string) *ShareLinksHandler {
+	return &ShareLinksHandler{repo: repo, publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+// Request struct for creating a link, every field is optional
+type CreateLinkRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Password  *string    `json:"password"`
+	MaxViews  *int       `json:"maxViews"`
+}
+
+// Response struct for viewing a note through a link as JSON
+type ViewLinkResponse struct {
+	*SharedNote
+	HTML string `json:"html"` // sanitized rendering of the content
+}
+
+// hashToken hashes a link token, only the hash is stored
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// newToken generates a random URL-safe link token
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// noteID parses the note ID of the URL
+func noteID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(chi.URLParam(r, "noteID"))
+	if err != nil {
+		return uuid.Nil, errors.New("invalid note ID")
+	}
+	return id, nil
+}
+
+// ShareLinksHandler to create a link to a note
+func (h *ShareLinksHandler) createLink(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	id, err := noteID(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req CreateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.Error(w, http.StatusBadRequest, "expiresAt must be in the future")
+		return
+	}
+	if req.MaxViews != nil && *req.MaxViews < 1 {
+		utils.Error(w, http.StatusBadRequest, "maxViews must be at least 1")
+		return
+	}
+
+	link := &Link{NoteID: id, ExpiresAt: req.ExpiresAt, MaxViews: req.MaxViews}
+	if req.Password != nil {
+		if *req.Password == "" || len(*req.Password) > MaxPasswordLength {
+			utils.Error(w, http.StatusBadRequest, "password must be between 1 and 72 characters")
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, "failed to create link")
+			return
+		}
+		passwordHash := string(hash)
+		link.PasswordHash = &passwordHash
+	}
+
+	token, err := newToken()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to create link")
+		return
+	}
+
+	if err := h.repo.Create(r.Context(), userID, link, hashToken(token)); err != nil {
+		if errors.Is(err, ErrNoteNotFound) {
+			utils.Error(w, http.StatusNotFound, "note not found")
+			return
+		}
+		if errors.Is(err, ErrNoteEncrypted) {
+			utils.Error(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.Error(w, http.StatusInternalServerError, "failed to create link")
+		return
+	}
+
+	// The token is not stored, this is the only time the URL can be shown
+	link.URL = h.publicURL + "/s/" + token
+
+	utils.JSON(w, http.StatusCreated, link)
+}
+
+// ShareLinksHandler to list the links to a note
+func (h *ShareLinksHandler) listLinks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	id, err := noteID(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	links, err := h.repo.List(r.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, ErrNoteNotFound) {
+			utils.Error(w, http.StatusNotFound, "note not found")
+			return
+		}
+		utils.Error(w, http.StatusInternalServerError, "can't access links")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"links": links,
+	})
+}
+
+// ShareLinksHandler to revoke a link
+func (h *ShareLinksHandler) revokeLink(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	id, err := noteID(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	linkID, err := uuid.Parse(chi.URLParam(r, "linkID"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid link ID")
+		return
+	}
+
+	if err := h.repo.Revoke(r.Context(), userID, id, linkID); err != nil {
+		if errors.Is(err, ErrLinkNotFound) {
+			utils.Error(w, http.StatusNotFound, "link not found")
+			return
+		}
+		utils.Error(w, http.StatusInternalServerError, "failed to revoke link")
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// ShareLinksHandler to view a note through a link, without authentication.
+// Password protected links take the password from a POSTed form or JSON body, or the X-Share-Password header.
+func (h *ShareLinksHandler) viewLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Cache-Control", "no-store")
+
+	mediaType := utils.Negotiate(r, publicMediaTypes...)
+	if mediaType == "" {
+		utils.Error(w, http.StatusNotAcceptable, "supported types are "+strings.Join(publicMediaTypes, ", "))
+		return
+	}
+	fail := func(status int, message string, askPassword bool) {
+		if mediaType == "text/html" {
+			writePage(w, status, page{Title: http.StatusText(status), Message: message, AskPassword: askPassword})
+			return
+		}
+		utils.Error(w, status, message)
+	}
+
+	link, err := h.repo.Resolve(r.Context(), hashToken(chi.URLParam(r, "token")))
+	if errors.Is(err, ErrLinkNotFound) {
+		fail(http.StatusNotFound, "This link doesn't exist or was revoked.", false)
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, "Something went wrong.", false)
+		return
+	}
+
+	if (link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now())) || (link.MaxViews != nil && link.ViewCount >= *link.MaxViews) {
+		fail(http.StatusGone, "This link has expired.", false)
+		return
+	}
+
+	if link.PasswordHash != nil {
+		password := linkPassword(w, r)
+		if password == "" {
+			fail(http.StatusUnauthorized, "This note is protected by a password.", true)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(*link.PasswordHash), []byte(password)) != nil {
+			fail(http.StatusUnauthorized, "Wrong password.", true)
+			return
+		}
+	}
+
+	note, err := h.repo.View(r.Context(), link.ID)
+	if errors.Is(err, ErrLinkExpired) {
+		fail(http.StatusGone, "This link has expired.", false)
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, "Something went wrong.", false)
+		return
+	}
+
+	doc, err := markdown.Render(note.Content)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Something went wrong.", false)
+		return
+	}
+
+	if mediaType == "text/html" {
+		writePage(w, http.StatusOK, page{
+			Title:   note.Title,
+			Updated: note.UpdatedAt.UTC().Format("January 2, 2006"),
+			Body:    template.HTML(doc.HTML),
+		})
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, ViewLinkResponse{SharedNote: note, HTML: doc.HTML})
+}
+
+// linkPassword reads the password sent to view a protected link
+func linkPassword(w http.ResponseWriter, r *http.Request) string {
+	if password := r.Header.Get("X-Share-Password"); password != "" {
+		return password
+	}
+	if r.Method != http.MethodPost {
+		return ""
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var body struct {
+			Password string `json:"password"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		return body.Password
+	}
+	return r.PostFormValue("password")
+}
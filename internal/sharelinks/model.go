@@ -0,0 +1,29 @@
+package sharelinks
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Link is a public read-only link to a note
+type Link struct {
+	ID           uuid.UUID  `json:"id"`
+	NoteID       uuid.UUID  `json:"noteId"`
+	URL          string     `json:"url,omitempty"` // only returned when the link is created
+	HasPassword  bool       `json:"hasPassword"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxViews     *int       `json:"maxViews"`
+	ViewCount    int        `json:"viewCount"`
+	LastViewedAt *time.Time `json:"lastViewedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+
+	PasswordHash *string `json:"-"`
+}
+
+// SharedNote is the part of a note shown through a link
+type SharedNote struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
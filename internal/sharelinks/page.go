@@ -0,0 +1,59 @@
+package sharelinks
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// pageTemplate is the standalone page a link is shown with in a browser
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 48rem; margin: 2rem auto; padding: 0 1rem; font: 16px/1.6 system-ui, sans-serif; color: #222; }
+pre { overflow-x: auto; background: #f5f5f5; padding: .75rem; }
+code { background: #f5f5f5; }
+img { max-width: 100%; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: .25rem .5rem; }
+.meta { color: #777; font-size: .875rem; }
+</style>
+</head>
+<body>
+{{if .Body}}<h1>{{.Title}}</h1>
+<p class="meta">Last updated {{.Updated}}</p>
+{{.Body}}
+{{else}}<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .AskPassword}}<form method="post">
+<input type="password" name="password" placeholder="Password" autofocus required>
+<button type="submit">View note</button>
+</form>{{end}}
+{{end}}</body>
+</html>
+`))
+
+// page is the data of pageTemplate, either a note (Body) or a message
+type page struct {
+	Title       string
+	Updated     string
+	Body        template.HTML // sanitized note HTML
+	Message     string
+	AskPassword bool
+}
+
+// writePage renders pageTemplate with the headers every public page gets
+func writePage(w http.ResponseWriter, status int, p page) {
+	// Note HTML is already sanitized, the policy keeps anything that slipped through from running
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:; form-action 'self'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	pageTemplate.Execute(w, p)
+}
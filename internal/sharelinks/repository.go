@@ -0,0 +1,232 @@
+package sharelinks
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/subrat-dwi/shubserver/internal/markdown"
+)
+
+// Share link errors
+var (
+	ErrNoteNotFound  = errors.New("note not found")
+	ErrLinkNotFound  = errors.New("link not found")
+	ErrLinkExpired   = errors.New("link expired")
+	ErrNoteEncrypted = errors.New("encrypted notes can't be shared by link")
+)
+
+// Repository Interface
+type ShareLinksRepository interface {
+	Create(ctx context.Context, userID uuid.UUID, link *Link, tokenHash []byte) error
+	List(ctx context.Context, userID, noteID uuid.UUID) ([]*Link, error)
+	Revoke(ctx context.Context, userID, noteID, id uuid.UUID) error
+	Resolve(ctx context.Context, tokenHash []byte) (*Link, error)
+	View(ctx context.Context, id uuid.UUID) (*SharedNote, error)
+}
+
+// Postgres Repository
+type ShareLinksPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewShareLinksPostgresRepository(db *pgxpool.Pool) *ShareLinksPostgresRepository {
+	return &ShareLinksPostgresRepository{db: db}
+}
+
+// linkColumns is the column list selected for a Link, in scanLink order
+const linkColumns = `id, note_id, password_hash, expires_at, max_views, view_count, last_viewed_at, created_at`
+
+// scanLink scans a row selected with linkColumns
+func scanLink(row pgx.Row, l *Link) error {
+	if err := row.Scan(&l.ID, &l.NoteID, &l.PasswordHash, &l.ExpiresAt, &l.MaxViews, &l.ViewCount, &l.LastViewedAt, &l.CreatedAt); err != nil {
+		return err
+	}
+	l.HasPassword = l.PasswordHash != nil
+	return nil
+}
+
+// Create a link to a note of the user, only the owner of a note can create links to it.
+// Encrypted notes can't be linked, the server can't show them to anyone.
+func (p *ShareLinksPostgresRepository) Create(ctx context.Context, userID uuid.UUID, link *Link, tokenHash []byte) error {
+	var encrypted bool
+	err := p.db.QueryRow(ctx, `
+	SELECT encrypted FROM notes WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, link.NoteID, userID).Scan(&encrypted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoteNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return ErrNoteEncrypted
+	}
+
+	query := `
+	INSERT INTO share_links(note_id, user_id, token_hash, password_hash, expires_at, max_views)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+
+	err = p.db.QueryRow(ctx, query, link.NoteID, userID, tokenHash, link.PasswordHash, link.ExpiresAt, link.MaxViews).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		return err
+	}
+	link.HasPassword = link.PasswordHash != nil
+
+	return nil
+}
+
+// List the links to a note of the user, newest first
+func (p *ShareLinksPostgresRepository) List(ctx context.Context, userID, noteID uuid.UUID) ([]*Link, error) {
+	var exists bool
+	err := p.db.QueryRow(ctx, `
+	SELECT EXISTS(SELECT 1 FROM notes WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, noteID, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNoteNotFound
+	}
+
+	rows, err := p.db.Query(ctx, `
+	SELECT `+linkColumns+`
+	FROM share_links
+	WHERE note_id = $1
+	ORDER BY created_at DESC
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Link{}
+	for rows.Next() {
+		var l Link
+		if err := scanLink(rows, &l); err != nil {
+			return nil, err
+		}
+		list = append(list, &l)
+	}
+
+	return list, rows.Err()
+}
+
+// Revoke deletes a link to a note of the user, it stops working immediately
+func (p *ShareLinksPostgresRepository) Revoke(ctx context.Context, userID, noteID, id uuid.UUID) error {
+	query := `
+	DELETE FROM share_links
+	WHERE id = $1 AND note_id = $2 AND user_id = $3
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, noteID, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+// Resolve finds the link with a token hash, including expired links of notes that are not trashed or encrypted
+func (p *ShareLinksPostgresRepository) Resolve(ctx context.Context, tokenHash []byte) (*Link, error) {
+	query := `
+	SELECT ` + linkColumns + `
+	FROM share_links
+	WHERE token_hash = $1 AND EXISTS(SELECT 1 FROM notes n WHERE n.id = note_id AND n.deleted_at IS NULL AND NOT n.encrypted)
+	`
+
+	var l Link
+	err := scanLink(p.db.QueryRow(ctx, query, tokenHash), &l)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// View counts a view of a link and returns its note. The count is checked and increased
+// in one statement, so concurrent views can't go over max_views.
+func (p *ShareLinksPostgresRepository) View(ctx context.Context, id uuid.UUID) (*SharedNote, error) {
+	query := `
+	WITH viewed AS (
+		UPDATE share_links
+		SET view_count = view_count + 1, last_viewed_at = NOW()
+		WHERE id = $1
+			AND (max_views IS NULL OR view_count < max_views)
+			AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING note_id
+	)
+	SELECT n.id, n.title, n.content, n.updated_at
+	FROM viewed JOIN notes n ON n.id = viewed.note_id
+	WHERE n.deleted_at IS NULL AND NOT n.encrypted
+	`
+
+	var n SharedNote
+	var noteID uuid.UUID
+	err := p.db.QueryRow(ctx, query, id).Scan(&noteID, &n.Title, &n.Content, &n.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrLinkExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The checklist of the note is shown as a task list after its content
+	tasks, err := p.checklist(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) > 0 {
+		if n.Content = strings.TrimRight(n.Content, "\n"); n.Content != "" {
+			n.Content += "\n\n"
+		}
+		n.Content += markdown.TaskList(tasks)
+	}
+
+	return &n, nil
+}
+
+// checklist loads the checklist of a note as Markdown tasks
+func (p *ShareLinksPostgresRepository) checklist(ctx context.Context, noteID uuid.UUID) ([]markdown.Task, error) {
+	rows, err := p.db.Query(ctx, `
+	SELECT id, parent_id, text, checked
+	FROM checklist_items
+	WHERE note_id = $1
+	ORDER BY parent_id IS NOT NULL, position
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []markdown.Task{}
+	index := map[uuid.UUID]int{} // top-level item ID to its task
+	for rows.Next() {
+		var id uuid.UUID
+		var parentID *uuid.UUID
+		var t markdown.Task
+		if err := rows.Scan(&id, &parentID, &t.Text, &t.Checked); err != nil {
+			return nil, err
+		}
+		if parentID == nil {
+			index[id] = len(tasks)
+			tasks = append(tasks, t)
+		} else if i, ok := index[*parentID]; ok {
+			tasks[i].Subtasks = append(tasks[i].Subtasks, t)
+		}
+	}
+
+	return tasks, rows.Err()
+}
@@ -0,0 +1,28 @@
+package sharelinks
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the routes to manage the links of a note, mounted under /notes/{noteID}/links
+func Routes(h *ShareLinksHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.listLinks)
+	r.Post("/", h.createLink)
+	r.Delete("/{linkID}", h.revokeLink)
+
+	return r
+}
+
+// PublicRoutes sets up the unauthenticated routes that serve links, mounted under /s
+func PublicRoutes(h *ShareLinksHandler) chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/{token}", h.viewLink)
+	r.Post("/{token}", h.viewLink)
+
+	return r
+}
@@ -0,0 +1,121 @@
+package tags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// MaxNameLength matches the tag_name_max_length constraint
+const MaxNameLength = 64
+
+// colorPattern matches the accepted #rrggbb colors
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Handler struct for tags
+type TagsHandler struct {
+	repo TagsRepository
+}
+
+// Constructor for handler
+func NewTagsHandler(repo TagsRepository) *TagsHandler {
+	return &TagsHandler{repo: repo}
+}
+
+// Request struct for updating a tag, omitted fields are left unchanged
+type UpdateTagRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"` // "" removes the color
+}
+
+// Response struct for updating a tag
+type UpdateTagResponse struct {
+	*Tag
+	Merged bool `json:"merged"` // the tag was renamed onto an existing tag and merged into it
+}
+
+// TagsHandler to list all tags with note counts
+func (h *TagsHandler) listTags(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	list, err := h.repo.List(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access tags")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"tags": list,
+	})
+}
+
+// TagsHandler to rename (merging on collision) and/or recolor a tag
+func (h *TagsHandler) updateTag(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid tag ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req UpdateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			utils.Error(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		if len(name) > MaxNameLength {
+			utils.Error(w, http.StatusBadRequest, fmt.Sprintf("name must be at most %d characters", MaxNameLength))
+			return
+		}
+		req.Name = &name
+	}
+	if req.Color != nil && *req.Color != "" && !colorPattern.MatchString(*req.Color) {
+		utils.Error(w, http.StatusBadRequest, "color must be formatted as #rrggbb")
+		return
+	}
+
+	tag, merged, err := h.repo.Update(r.Context(), userID, id, req.Name, req.Color)
+	if errors.Is(err, ErrTagNotFound) {
+		utils.Error(w, http.StatusNotFound, "tag not found")
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to update")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, UpdateTagResponse{Tag: tag, Merged: merged})
+}
+
+// TagsHandler to delete a tag, notes keep existing without it
+func (h *TagsHandler) deleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid tag ID")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.repo.Delete(r.Context(), userID, id); err != nil {
+		utils.Error(w, http.StatusNotFound, "tag not found")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": "tag deleted successfully",
+	})
+}
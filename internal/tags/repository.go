@@ -0,0 +1,183 @@
+package tags
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrTagNotFound is returned when a tag doesn't exist or belongs to another user
+var ErrTagNotFound = errors.New("tag not found")
+
+// Repository Interface
+type TagsRepository interface {
+	List(ctx context.Context, userID uuid.UUID) ([]*Tag, error)
+	Get(ctx context.Context, userID, id uuid.UUID) (*Tag, error)
+	Update(ctx context.Context, userID, id uuid.UUID, name *string, color *string) (*Tag, bool, error)
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+}
+
+// Postgres Repository
+type TagsPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewTagsPostgresRepository(db *pgxpool.Pool) *TagsPostgresRepository {
+	return &TagsPostgresRepository{db: db}
+}
+
+// tagColumns is the column list selected for a Tag, including its note count without trashed notes
+const tagColumns = `id, name, color, created_at, updated_at,
+	(SELECT COUNT(*) FROM note_tags nt JOIN notes n ON n.id = nt.note_id WHERE nt.tag_id = tags.id AND n.deleted_at IS NULL)`
+
+// scanTag scans a row selected with tagColumns
+func scanTag(row pgx.Row, t *Tag) error {
+	return row.Scan(&t.ID, &t.Name, &t.Color, &t.CreatedAt, &t.UpdatedAt, &t.NoteCount)
+}
+
+// List all tags of a user with their note counts
+func (p *TagsPostgresRepository) List(ctx context.Context, userID uuid.UUID) ([]*Tag, error) {
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags
+	WHERE user_id = $1
+	ORDER BY LOWER(name)
+	`
+
+	rows, err := p.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := scanTag(rows, &t); err != nil {
+			return nil, err
+		}
+		list = append(list, &t)
+	}
+
+	return list, rows.Err()
+}
+
+// Get a specific tag of a user
+func (p *TagsPostgresRepository) Get(ctx context.Context, userID, id uuid.UUID) (*Tag, error) {
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags
+	WHERE id = $1 AND user_id = $2
+	`
+
+	var t Tag
+	if err := scanTag(p.db.QueryRow(ctx, query, id, userID), &t); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Update renames and/or recolors a tag; nil fields are left unchanged and an empty color clears it.
+// Renaming to the name of another tag of the user merges this tag into it: its notes are moved
+// over and it is deleted. The resulting tag is returned together with whether a merge happened.
+func (p *TagsPostgresRepository) Update(ctx context.Context, userID, id uuid.UUID, name *string, color *string) (*Tag, bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the tag so concurrent renames can't interleave
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT TRUE FROM tags WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, ErrTagNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	target := id
+	merged := false
+
+	if name != nil {
+		var other uuid.UUID
+		err := tx.QueryRow(ctx, `
+		SELECT id FROM tags
+		WHERE user_id = $1 AND LOWER(name) = LOWER($2) AND id != $3
+		`, userID, *name, id).Scan(&other)
+
+		switch {
+		case err == nil:
+			// Merge: move the notes to the existing tag and drop this one
+			_, err = tx.Exec(ctx, `
+			INSERT INTO note_tags(note_id, tag_id)
+			SELECT note_id, $2 FROM note_tags WHERE tag_id = $1
+			ON CONFLICT DO NOTHING
+			`, id, other)
+			if err != nil {
+				return nil, false, err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM tags WHERE id = $1`, id); err != nil {
+				return nil, false, err
+			}
+			target = other
+			merged = true
+
+		case errors.Is(err, pgx.ErrNoRows):
+			_, err = tx.Exec(ctx, `UPDATE tags SET name = $2, updated_at = NOW() WHERE id = $1`, id, *name)
+			if err != nil {
+				return nil, false, err
+			}
+
+		default:
+			return nil, false, err
+		}
+	}
+
+	if color != nil {
+		var value interface{}
+		if *color != "" {
+			value = *color
+		}
+		_, err := tx.Exec(ctx, `UPDATE tags SET color = $2, updated_at = NOW() WHERE id = $1`, target, value)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	var t Tag
+	query := `SELECT ` + tagColumns + ` FROM tags WHERE id = $1`
+	if err := scanTag(tx.QueryRow(ctx, query, target), &t); err != nil {
+		return nil, false, err
+	}
+
+	return &t, merged, tx.Commit(ctx)
+}
+
+// Delete a tag, removing it from all notes
+func (p *TagsPostgresRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+	DELETE FROM tags
+	WHERE id = $1 AND user_id = $2
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
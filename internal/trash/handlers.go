@@ -0,0 +1,143 @@
+package trash
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/subrat-dwi/shubserver/internal/auth"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// Handler struct for the trash
+type TrashHandler struct {
+	repo      TrashRepository
+	retention time.Duration
+}
+
+// Constructor for handler, retention is how long items stay in the trash
+func NewTrashHandler(repo TrashRepository, retention time.Duration) *TrashHandler {
+	return &TrashHandler{repo: repo, retention: retention}
+}
+
+// Response struct for listing the trash
+type ListTrashResponse struct {
+	Items      []*Item `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      *int    `json:"total,omitempty"`
+}
+
+// TrashHandler to list trashed notes and vault entries, ?kind= limits it to one kind
+func (h *TrashHandler) listTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	kind := r.URL.Query().Get("kind")
+	if _, ok := tableFor(kind); kind != "" && !ok {
+		utils.Error(w, http.StatusBadRequest, "kind must be note or password")
+		return
+	}
+
+	page, err := utils.ParsePageRequest(r.URL.Query(), "deleted")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := h.repo.List(r.Context(), userID, kind, page)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "can't access trash")
+		return
+	}
+
+	for _, item := range list.Items {
+		item.PurgeAt = item.DeletedAt.Add(h.retention)
+	}
+
+	utils.JSON(w, http.StatusOK, ListTrashResponse{
+		Items:      list.Items,
+		NextCursor: list.NextCursor,
+		Total:      list.Total,
+	})
+}
+
+// TrashHandler to restore a trashed item
+func (h *TrashHandler) restoreItem(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := itemParams(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.repo.Restore(r.Context(), userID, kind, id); err != nil {
+		itemError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"message": kind + " restored successfully",
+	})
+}
+
+// TrashHandler to permanently delete a trashed item, vault entries need a recent authentication
+func (h *TrashHandler) purgeItem(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := itemParams(w, r)
+	if !ok {
+		return
+	}
+	if kind == KindPassword && !auth.IsRecentlyAuthenticated(r.Context()) {
+		w.Header().Set("WWW-Authenticate", auth.ReauthChallenge)
+		utils.Error(w, http.StatusUnauthorized, "recent authentication required")
+		return
+	}
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.repo.Purge(r.Context(), userID, kind, id); err != nil {
+		itemError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// TrashHandler to permanently delete everything in the trash
+func (h *TrashHandler) emptyTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	removed, err := h.repo.Empty(r.Context(), userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "failed to empty trash")
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]int64{
+		"deleted": removed,
+	})
+}
+
+// itemParams reads the kind and id of a trashed item from the URL, writing a 400 when invalid
+func itemParams(w http.ResponseWriter, r *http.Request) (string, uuid.UUID, bool) {
+	kind := chi.URLParam(r, "kind")
+	if _, ok := tableFor(kind); !ok {
+		utils.Error(w, http.StatusBadRequest, "kind must be note or password")
+		return "", uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "invalid ID")
+		return "", uuid.Nil, false
+	}
+
+	return kind, id, true
+}
+
+// itemError writes the response for a repository error on a single item
+func itemError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrItemNotFound) {
+		utils.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	utils.Error(w, http.StatusInternalServerError, "failed to update trash")
+}
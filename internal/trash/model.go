@@ -0,0 +1,34 @@
+package trash
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of trashed items
+const (
+	KindNote     = "note"
+	KindPassword = "password"
+)
+
+// Item is a trashed note or vault entry
+type Item struct {
+	Kind      string    `json:"kind"`
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"` // note title or vault entry name
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"` // when the purge job removes it for good
+}
+
+// tableFor maps an item kind to its table
+func tableFor(kind string) (string, bool) {
+	switch kind {
+	case KindNote:
+		return "notes", true
+	case KindPassword:
+		return "passwords", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,49 @@
+package trash
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeInterval is how often the purge job looks for expired trash
+const PurgeInterval = time.Hour
+
+// Purger permanently deletes items that have been in the trash longer than the retention
+type Purger struct {
+	repo      TrashRepository
+	retention time.Duration
+}
+
+// NewPurger creates the background purge job
+func NewPurger(repo TrashRepository, retention time.Duration) *Purger {
+	return &Purger{repo: repo, retention: retention}
+}
+
+// Run purges expired trash right away and then every PurgeInterval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge runs one purge pass, errors are logged and retried on the next tick
+func (p *Purger) purge(ctx context.Context) {
+	removed, err := p.repo.PurgeExpired(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		log.Printf("trash: purging expired items: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("trash: purged %d expired items", removed)
+	}
+}
@@ -0,0 +1,176 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/subrat-dwi/shubserver/internal/utils"
+)
+
+// ErrItemNotFound is returned when an item isn't in the user's trash
+var ErrItemNotFound = errors.New("item not found in trash")
+
+// trashed selects the trashed notes and vault entries of a user ($1) with a common shape
+const trashed = `(
+	SELECT 'note' AS kind, id, COALESCE(NULLIF(title, ''), 'Encrypted note') AS name, deleted_at FROM notes
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	UNION ALL
+	SELECT 'password' AS kind, id, name, deleted_at FROM passwords
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+) AS trash`
+
+// Repository Interface
+type TrashRepository interface {
+	List(ctx context.Context, userID uuid.UUID, kind string, page *utils.PageRequest) (*utils.Page[*Item], error)
+	Restore(ctx context.Context, userID uuid.UUID, kind string, id uuid.UUID) error
+	Purge(ctx context.Context, userID uuid.UUID, kind string, id uuid.UUID) error
+	Empty(ctx context.Context, userID uuid.UUID) (int64, error)
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Postgres Repository
+type TrashPostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+// Postgres Repository Constructor
+func NewTrashPostgresRepository(db *pgxpool.Pool) *TrashPostgresRepository {
+	return &TrashPostgresRepository{db: db}
+}
+
+// List a page of the user's trash, most recently deleted first by default. kind "" lists both kinds.
+func (p *TrashPostgresRepository) List(ctx context.Context, userID uuid.UUID, kind string, page *utils.PageRequest) (*utils.Page[*Item], error) {
+	where := utils.NewWhere("TRUE")
+	where.Arg(userID) // $1, used by the trashed subquery
+	if kind != "" {
+		where.Add("kind = ?", kind)
+	}
+
+	result := &utils.Page[*Item]{Items: []*Item{}}
+
+	if page.IncludeTotal {
+		var total int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, trashed, where.SQL())
+		if err := p.db.QueryRow(ctx, query, where.Args...).Scan(&total); err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+
+	page.AddKeyset(where, "deleted_at", "timestamptz")
+
+	query := fmt.Sprintf(`
+	SELECT kind, id, name, deleted_at
+	FROM %s
+	WHERE %s
+	ORDER BY deleted_at %s, id %s
+	LIMIT %s
+	`, trashed, where.SQL(), page.Direction(), page.Direction(), where.Arg(page.Limit+1))
+
+	rows, err := p.db.Query(ctx, query, where.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Kind, &item.ID, &item.Name, &item.DeletedAt); err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) > page.Limit {
+		result.Items = result.Items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		result.NextCursor = page.NextCursor(utils.FormatCursorTime(last.DeletedAt), last.ID.String())
+	}
+
+	return result, nil
+}
+
+// Restore takes an item out of the trash
+func (p *TrashPostgresRepository) Restore(ctx context.Context, userID uuid.UUID, kind string, id uuid.UUID) error {
+	table, ok := tableFor(kind)
+	if !ok {
+		return ErrItemNotFound
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET deleted_at = NULL
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	`, table)
+
+	cmd, err := p.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrItemNotFound
+	}
+
+	return nil
+}
+
+// Purge permanently deletes a trashed item
+func (p *TrashPostgresRepository) Purge(ctx context.Context, userID uuid.UUID, kind string, id uuid.UUID) error {
+	table, ok := tableFor(kind)
+	if !ok {
+		return ErrItemNotFound
+	}
+
+	query := fmt.Sprintf(`
+	DELETE FROM %s
+	WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	`, table)
+
+	cmd, err := p.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrItemNotFound
+	}
+
+	return nil
+}
+
+// Empty permanently deletes everything in the user's trash and returns how many items were removed
+func (p *TrashPostgresRepository) Empty(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return p.purge(ctx, "user_id = $1", userID)
+}
+
+// PurgeExpired permanently deletes the items of all users trashed before the given time
+func (p *TrashPostgresRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return p.purge(ctx, "deleted_at < $1", before)
+}
+
+// purge deletes the trashed notes and vault entries matching cond in one transaction
+func (p *TrashPostgresRepository) purge(ctx context.Context, cond string, arg interface{}) (int64, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var removed int64
+	for _, table := range []string{"notes", "passwords"} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE deleted_at IS NOT NULL AND %s`, table, cond)
+		cmd, err := tx.Exec(ctx, query, arg)
+		if err != nil {
+			return 0, err
+		}
+		removed += cmd.RowsAffected()
+	}
+
+	return removed, tx.Commit(ctx)
+}
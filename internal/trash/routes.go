@@ -0,0 +1,21 @@
+package trash
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/subrat-dwi/shubserver/internal/middleware"
+)
+
+// Routes sets up the routes for the trash module
+func Routes(h *TrashHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware)
+
+	r.Get("/", h.listTrash)
+	r.Post("/{kind}/{id}/restore", h.restoreItem)
+	r.Delete("/{kind}/{id}", h.purgeItem)
+
+	// Emptying the trash also destroys vault entries
+	r.With(middleware.RequireRecentAuth).Delete("/", h.emptyTrash)
+
+	return r
+}
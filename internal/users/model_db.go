@@ -8,10 +8,23 @@ import (
 
 // UserDB represents the user data structure as stored in the database
 type UserDB struct {
-	Id           uuid.UUID
-	Email        string
-	PasswordHash string
-	Salt         []byte
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	Id                 uuid.UUID
+	Email              string
+	PasswordHash       string
+	Salt               []byte
+	SessionsRevokedAt  *time.Time
+	MustChangePassword bool
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// Device represents a device a user has signed in from
+type Device struct {
+	ID              uuid.UUID `json:"id"`
+	UserID          uuid.UUID `json:"-"`
+	Fingerprint     string    `json:"-"`
+	UserAgentFamily string    `json:"user_agent_family"`
+	IPPrefix        string    `json:"ip_prefix"`
+	FirstSeenAt     time.Time `json:"first_seen_at"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
 }
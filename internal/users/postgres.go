@@ -2,7 +2,10 @@ package users
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -23,7 +26,7 @@ func (p *UsersPostgresRepository) CreateUser(ctx context.Context, email string,
 	query := `
 	INSERT INTO users(email, password_hash, salt)
 	VALUES($1, $2, $3)
-	RETURNING id, email, password_hash, salt, created_at, updated_at
+	RETURNING id, email, password_hash, salt, sessions_revoked_at, must_change_password, created_at, updated_at
 	`
 	var user UserDB
 
@@ -32,6 +35,8 @@ func (p *UsersPostgresRepository) CreateUser(ctx context.Context, email string,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Salt,
+		&user.SessionsRevokedAt,
+		&user.MustChangePassword,
 		&user.CreatedAt,
 		&user.UpdatedAt)
 
@@ -45,7 +50,7 @@ func (p *UsersPostgresRepository) CreateUser(ctx context.Context, email string,
 // GetByEmail retrieves a user from the database by their email
 func (p *UsersPostgresRepository) GetByEmail(ctx context.Context, email string) (*UserDB, error) {
 	query := `
-	SELECT id, email, password_hash, salt, created_at, updated_at
+	SELECT id, email, password_hash, salt, sessions_revoked_at, must_change_password, created_at, updated_at
 	FROM users
 	WHERE email = $1
 	`
@@ -57,6 +62,8 @@ func (p *UsersPostgresRepository) GetByEmail(ctx context.Context, email string)
 		&user.Email,
 		&user.PasswordHash,
 		&user.Salt,
+		&user.SessionsRevokedAt,
+		&user.MustChangePassword,
 		&user.CreatedAt,
 		&user.UpdatedAt)
 
@@ -89,3 +96,285 @@ func (p *UsersPostgresRepository) GetByID(ctx context.Context, id string) (*User
 
 	return &user, nil
 }
+
+// GetAuthByID retrieves a user including their password hash by ID
+func (p *UsersPostgresRepository) GetAuthByID(ctx context.Context, id string) (*UserDB, error) {
+	query := `
+	SELECT id, email, password_hash, salt, sessions_revoked_at, must_change_password, created_at, updated_at
+	FROM users
+	WHERE id = $1
+	`
+
+	var user UserDB
+
+	err := p.db.QueryRow(ctx, query, id).Scan(
+		&user.Id,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Salt,
+		&user.SessionsRevokedAt,
+		&user.MustChangePassword,
+		&user.CreatedAt,
+		&user.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdatePassword stores a new password hash, clears any forced password change
+// and revokes every token issued before now
+func (p *UsersPostgresRepository) UpdatePassword(ctx context.Context, id string, passwordHash string) error {
+	query := `
+	UPDATE users
+	SET password_hash = $2, must_change_password = FALSE, sessions_revoked_at = NOW(), updated_at = NOW()
+	WHERE id = $1
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// RevokeSessions invalidates every token issued before now and forces a password change
+func (p *UsersPostgresRepository) RevokeSessions(ctx context.Context, id string) error {
+	query := `
+	UPDATE users
+	SET sessions_revoked_at = NOW(), must_change_password = TRUE, updated_at = NOW()
+	WHERE id = $1
+	`
+
+	cmd, err := p.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// ------ Account Recovery ------
+
+// LockForRecovery handles an opened "this wasn't me" link, identified by the device it reports, in one
+// transaction: the link is used up, the device is forgotten, every session is revoked, a password change
+// is forced and a reset token replaces any earlier one. It reports false when the link was already used.
+func (p *UsersPostgresRepository) LockForRecovery(ctx context.Context, userID, deviceID string, linkExpiresAt time.Time, resetHash []byte, resetExpiresAt time.Time) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM used_report_links WHERE expires_at < NOW()`); err != nil {
+		return false, err
+	}
+	cmd, err := tx.Exec(ctx, `
+	INSERT INTO used_report_links(id, user_id, expires_at)
+	VALUES($1, $2, $3)
+	ON CONFLICT (id) DO NOTHING
+	`, deviceID, userID, linkExpiresAt)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_devices WHERE id = $1 AND user_id = $2`, deviceID, userID); err != nil {
+		return false, err
+	}
+
+	cmd, err = tx.Exec(ctx, `
+	UPDATE users
+	SET sessions_revoked_at = NOW(), must_change_password = TRUE, updated_at = NOW()
+	WHERE id = $1
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, errors.New("user not found")
+	}
+
+	if err := replacePasswordReset(ctx, tx, userID, resetHash, resetExpiresAt); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// RenewPasswordReset replaces the reset token of an account locked for recovery, so a lost or
+// expired token doesn't keep the account locked. It reports false when the account isn't locked
+// or already got a token after issuedAfter.
+func (p *UsersPostgresRepository) RenewPasswordReset(ctx context.Context, userID string, issuedAfter time.Time, resetHash []byte, resetExpiresAt time.Time) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked, recent bool
+	err = tx.QueryRow(ctx, `
+	SELECT must_change_password,
+		EXISTS (SELECT 1 FROM password_resets WHERE user_id = users.id AND created_at > $2)
+	FROM users
+	WHERE id = $1
+	FOR UPDATE
+	`, userID, issuedAfter).Scan(&locked, &recent)
+	if err != nil {
+		return false, err
+	}
+	if !locked || recent {
+		return false, nil
+	}
+
+	if err := replacePasswordReset(ctx, tx, userID, resetHash, resetExpiresAt); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// replacePasswordReset stores a reset token for a user in place of any earlier one
+func replacePasswordReset(ctx context.Context, tx pgx.Tx, userID string, resetHash []byte, resetExpiresAt time.Time) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM password_resets WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+	INSERT INTO password_resets(token_hash, user_id, expires_at)
+	VALUES($1, $2, $3)
+	`, resetHash, userID, resetExpiresAt)
+	return err
+}
+
+// ResetPassword stores a new password hash like UpdatePassword when resetHash is the unexpired
+// reset token of the user, using it up. It reports false when it isn't.
+func (p *UsersPostgresRepository) ResetPassword(ctx context.Context, id string, resetHash []byte, passwordHash string) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, `
+	DELETE FROM password_resets
+	WHERE token_hash = $1 AND user_id = $2 AND expires_at > NOW()
+	`, resetHash, id)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE users
+	SET password_hash = $2, must_change_password = FALSE, sessions_revoked_at = NOW(), updated_at = NOW()
+	WHERE id = $1
+	`, id, passwordHash)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// ------ Known Devices ------
+
+// CountDevices returns the number of devices remembered for a user
+func (p *UsersPostgresRepository) CountDevices(ctx context.Context, userID string) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM user_devices
+	WHERE user_id = $1
+	`
+
+	var count int
+	err := p.db.QueryRow(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// TouchDevice remembers a device for a user, or refreshes its last-seen time if already known.
+// It reports whether the device was seen for the first time.
+func (p *UsersPostgresRepository) TouchDevice(ctx context.Context, device *Device) (bool, error) {
+	query := `
+	INSERT INTO user_devices(user_id, fingerprint, user_agent_family, ip_prefix)
+	VALUES($1, $2, $3, $4)
+	ON CONFLICT (user_id, fingerprint)
+	DO UPDATE SET last_seen_at = NOW()
+	RETURNING id, first_seen_at, last_seen_at, (xmax = 0) AS inserted
+	`
+
+	var inserted bool
+
+	err := p.db.QueryRow(ctx, query,
+		device.UserID,
+		device.Fingerprint,
+		device.UserAgentFamily,
+		device.IPPrefix,
+	).Scan(&device.ID, &device.FirstSeenAt, &device.LastSeenAt, &inserted)
+
+	if err != nil {
+		return false, err
+	}
+
+	return inserted, nil
+}
+
+// ListDevices lists the devices remembered for a user, most recently used first
+func (p *UsersPostgresRepository) ListDevices(ctx context.Context, userID string) ([]*Device, error) {
+	query := `
+	SELECT id, user_id, fingerprint, user_agent_family, ip_prefix, first_seen_at, last_seen_at
+	FROM user_devices
+	WHERE user_id = $1
+	ORDER BY last_seen_at DESC
+	`
+
+	rows, err := p.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []*Device{}
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Fingerprint, &d.UserAgentFamily, &d.IPPrefix, &d.FirstSeenAt, &d.LastSeenAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, &d)
+	}
+
+	return devices, rows.Err()
+}
+
+// DeleteDevice forgets a device so the next sign-in from it is treated as new
+func (p *UsersPostgresRepository) DeleteDevice(ctx context.Context, userID string, deviceID string) error {
+	query := `
+	DELETE FROM user_devices
+	WHERE id = $1 AND user_id = $2
+	`
+
+	cmd, err := p.db.Exec(ctx, query, deviceID, userID)
+	if err != nil {
+		return err
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return errors.New("device not found")
+	}
+
+	return nil
+}
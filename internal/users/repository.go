@@ -1,10 +1,24 @@
 package users
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // UsersRepository defines the interface for user-related database operations
 type UsersRepository interface {
 	CreateUser(ctx context.Context, email string, passwordHash string, salt []byte) (*UserDB, error)
 	GetByEmail(ctx context.Context, email string) (*UserDB, error)
 	GetByID(ctx context.Context, id string) (*User, error)
+	GetAuthByID(ctx context.Context, id string) (*UserDB, error)
+	UpdatePassword(ctx context.Context, id string, passwordHash string) error
+	RevokeSessions(ctx context.Context, id string) error
+	LockForRecovery(ctx context.Context, userID, deviceID string, linkExpiresAt time.Time, resetHash []byte, resetExpiresAt time.Time) (bool, error)
+	RenewPasswordReset(ctx context.Context, userID string, issuedAfter time.Time, resetHash []byte, resetExpiresAt time.Time) (bool, error)
+	ResetPassword(ctx context.Context, id string, resetHash []byte, passwordHash string) (bool, error)
+
+	CountDevices(ctx context.Context, userID string) (int, error)
+	TouchDevice(ctx context.Context, device *Device) (bool, error)
+	ListDevices(ctx context.Context, userID string) ([]*Device, error)
+	DeleteDevice(ctx context.Context, userID string, deviceID string) error
 }
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag formats the version of a resource as a strong entity tag
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value names the version.
+// "*" matches any version; weak tags are compared by their value.
+func etagMatches(header string, version int64) bool {
+	tag := ETag(version)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" || strings.TrimPrefix(part, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckIfMatch checks the If-Match header of a request against the current version of a resource.
+// ok is false when the precondition fails. expected is the version the write must still find,
+// or 0 when the request isn't conditional on a specific version.
+func CheckIfMatch(r *http.Request, version int64) (expected int64, ok bool) {
+	return MatchIfMatch(r.Header.Get("If-Match"), version)
+}
+
+// MatchIfMatch is CheckIfMatch for an If-Match value given outside of a request header, e.g. in a batch
+func MatchIfMatch(header string, version int64) (expected int64, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if !etagMatches(header, version) {
+		return 0, false
+	}
+	return version, true
+}
+
+// IfNoneMatch reports whether the If-None-Match header of a request names the version, or "*"
+func IfNoneMatch(r *http.Request, version int64) bool {
+	header := r.Header.Get("If-None-Match")
+	return header != "" && etagMatches(header, version)
+}
+
+// CreateOnly reports whether a create request sent If-None-Match: *, asking not to replace an existing resource
+func CreateOnly(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("If-None-Match")) == "*"
+}
+
+// PreconditionFailed answers 412 with the current server copy of the resource and its ETag.
+// current may be nil when the client may not see the resource.
+func PreconditionFailed(w http.ResponseWriter, version int64, current interface{}) {
+	if current == nil {
+		Error(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+
+	w.Header().Set("ETag", ETag(version))
+	JSON(w, http.StatusPreconditionFailed, map[string]interface{}{
+		"status":  strconv.Itoa(http.StatusPreconditionFailed),
+		"message": "the resource was changed, current is the server copy",
+		"current": current,
+	})
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+)
+
+// MergePatchType is the media type of JSON Merge Patch documents (RFC 7396)
+const MergePatchType = "application/merge-patch+json"
+
+// ErrMergePatchType is returned for a PATCH body that isn't a JSON Merge Patch
+var ErrMergePatchType = errors.New("PATCH requires Content-Type " + MergePatchType)
+
+// ReadMergePatch reads the JSON Merge Patch in the request body, sent as application/merge-patch+json
+// or application/json. The patch must be an object, its members are returned undecoded.
+func ReadMergePatch(r *http.Request) (map[string]json.RawMessage, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != MergePatchType && mediaType != "application/json") {
+		return nil, ErrMergePatchType
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		return nil, NewValidationError("a merge patch must be a JSON object")
+	}
+	return patch, nil
+}
+
+// IsNull reports whether a patch member is null, which removes the member from the target
+func IsNull(value json.RawMessage) bool {
+	return string(value) == "null"
+}
+
+// ApplyMergePatch applies a merge patch to the members of target as RFC 7396 describes:
+// null removes a member, an object is merged into the member recursively and any other value replaces it
+func ApplyMergePatch(target map[string]interface{}, patch map[string]json.RawMessage) error {
+	for name, raw := range patch {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return NewValidationError("invalid JSON in " + name)
+		}
+		if value == nil {
+			delete(target, name)
+			continue
+		}
+		target[name] = mergeValue(target[name], value)
+	}
+	return nil
+}
+
+// mergeValue is the MergePatch function of RFC 7396 for decoded JSON values
+func mergeValue(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = mergeValue(object[name], value)
+	}
+	return object
+}
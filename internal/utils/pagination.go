@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Pagination limits
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// PageRequest holds the pagination, sorting and date filters of a list request
+type PageRequest struct {
+	Limit        int
+	Sort         string // one of the sort keys allowed by the endpoint
+	Desc         bool
+	Cursor       *Cursor
+	IncludeTotal bool
+
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+}
+
+// Cursor marks the last item of a page; the next page continues after it.
+// Ranked lists page by offset instead, Value is then the offset of the next page and ID is empty.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`           // sort key value of the last item
+	ID    string `json:"id"`          // tie-breaker for equal sort values
+	Group *int   `json:"g,omitempty"` // leading group value of the last item, see AddGroupedKeyset
+}
+
+// timeSortKeys are the sort keys of the lists whose cursor values are timestamps, see FormatCursorTime
+var timeSortKeys = []string{"created", "updated", "deleted"}
+
+// Page is one page of a list response
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	Total      *int
+}
+
+// ParsePageRequest reads limit, cursor, sort, order, include_total and the
+// created_/updated_ from/to filters from the query string of a list paged by keyset.
+// sortKeys lists the allowed sort keys, the first one is the default.
+func ParsePageRequest(q url.Values, sortKeys ...string) (*PageRequest, error) {
+	return parsePageRequest(q, false, sortKeys)
+}
+
+// ParseOffsetPageRequest is ParsePageRequest for a ranked list paged by offset, see Offset
+func ParseOffsetPageRequest(q url.Values, sortKeys ...string) (*PageRequest, error) {
+	return parsePageRequest(q, true, sortKeys)
+}
+
+func parsePageRequest(q url.Values, offset bool, sortKeys []string) (*PageRequest, error) {
+	p := &PageRequest{
+		Limit:        DefaultPageLimit,
+		Sort:         sortKeys[0],
+		Desc:         true,
+		IncludeTotal: q.Get("include_total") == "true",
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return nil, NewValidationError(fmt.Sprintf("limit must be between 1 and %d", MaxPageLimit))
+		}
+		p.Limit = limit
+	}
+
+	if v := q.Get("sort"); v != "" {
+		if !contains(sortKeys, v) {
+			return nil, NewValidationError("sort must be one of: " + strings.Join(sortKeys, ", "))
+		}
+		p.Sort = v
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+		p.Desc = true
+	case "asc":
+		p.Desc = false
+	default:
+		return nil, NewValidationError("order must be asc or desc")
+	}
+
+	var err error
+	if p.CreatedFrom, err = parseDateParam(q, "created_from"); err != nil {
+		return nil, err
+	}
+	if p.CreatedTo, err = parseDateParam(q, "created_to"); err != nil {
+		return nil, err
+	}
+	if p.UpdatedFrom, err = parseDateParam(q, "updated_from"); err != nil {
+		return nil, err
+	}
+	if p.UpdatedTo, err = parseDateParam(q, "updated_to"); err != nil {
+		return nil, err
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := DecodeCursor(v)
+		if err != nil {
+			return nil, NewValidationError("invalid cursor")
+		}
+		// A cursor only makes sense for the ordering it was created with
+		if c.Sort != p.Sort || c.Desc != p.Desc {
+			return nil, NewValidationError("cursor does not match sort and order")
+		}
+		if !validCursor(c, offset) {
+			return nil, NewValidationError("invalid cursor")
+		}
+		p.Cursor = c
+	}
+
+	return p, nil
+}
+
+// validCursor checks the values of a cursor are what the queries of its kind of list expect,
+// an offset or the sort value and ID of the last item
+func validCursor(c *Cursor, offset bool) bool {
+	if offset {
+		n, err := strconv.Atoi(c.Value)
+		return err == nil && n >= 0 && c.ID == "" && c.Group == nil
+	}
+
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return false
+	}
+	if c.Group != nil || !contains(timeSortKeys, c.Sort) {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339Nano, c.Value)
+	return err == nil
+}
+
+// Offset returns the offset of the page of a list paged by offset, see ParseOffsetPageRequest
+func (p *PageRequest) Offset() int {
+	if p.Cursor == nil {
+		return 0
+	}
+	offset, _ := strconv.Atoi(p.Cursor.Value)
+	return offset
+}
+
+// NextOffsetCursor encodes the cursor of the page of a list paged by offset that starts at offset
+func (p *PageRequest) NextOffsetCursor(offset int) string {
+	return p.NextCursor(strconv.Itoa(offset), "")
+}
+
+// NextCursor encodes the cursor continuing after an item with the given sort value and ID
+func (p *PageRequest) NextCursor(value, id string) string {
+	data, _ := json.Marshal(Cursor{Sort: p.Sort, Desc: p.Desc, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// NextGroupCursor encodes the cursor continuing after an item of a leading group, see AddGroupedKeyset
+func (p *PageRequest) NextGroupCursor(group int, id string) string {
+	data, _ := json.Marshal(Cursor{Sort: p.Sort, Desc: p.Desc, ID: id, Group: &group})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Direction returns the SQL sort direction
+func (p *PageRequest) Direction() string {
+	if p.Desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// AddDateFilters adds the created/updated range filters on created_at and updated_at
+func (p *PageRequest) AddDateFilters(w *Where) {
+	if p.CreatedFrom != nil {
+		w.Add("created_at >= ?", *p.CreatedFrom)
+	}
+	if p.CreatedTo != nil {
+		w.Add("created_at < ?", *p.CreatedTo)
+	}
+	if p.UpdatedFrom != nil {
+		w.Add("updated_at >= ?", *p.UpdatedFrom)
+	}
+	if p.UpdatedTo != nil {
+		w.Add("updated_at < ?", *p.UpdatedTo)
+	}
+}
+
+// AddKeyset adds the condition continuing after the cursor, for rows ordered by (column, id).
+// cast is the SQL type of column, used to compare against the string cursor value.
+func (p *PageRequest) AddKeyset(w *Where, column, cast string) {
+	if p.Cursor == nil {
+		return
+	}
+	op := ">"
+	if p.Desc {
+		op = "<"
+	}
+	w.Add(fmt.Sprintf("(%s, id) %s (?::%s, ?::uuid)", column, op, cast), p.Cursor.Value, p.Cursor.ID)
+}
+
+// AddGroupedKeyset adds the keyset condition for rows ordered by (groupColumn ASC NULLS LAST, column, id):
+// rows with a unique non-NULL groupColumn come first, the others follow in the requested order.
+func (p *PageRequest) AddGroupedKeyset(w *Where, groupColumn, column, cast string) {
+	if p.Cursor == nil {
+		return
+	}
+	if p.Cursor.Group != nil {
+		w.Add(fmt.Sprintf("(%s > ? OR %s IS NULL)", groupColumn, groupColumn), *p.Cursor.Group)
+		return
+	}
+	w.Add(groupColumn + " IS NULL")
+	p.AddKeyset(w, column, cast)
+}
+
+// FormatCursorTime formats a timestamp sort value for a cursor without losing precision
+func FormatCursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseDateParam parses an RFC 3339 timestamp or YYYY-MM-DD date query parameter
+func parseDateParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return &t, nil
+	}
+	return nil, NewValidationError(name + " must be an RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+// DecodeCursor decodes an opaque cursor string, e.g. the NextCursor of a page to fetch the next one
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
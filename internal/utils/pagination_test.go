@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+)
+
+func encodeCursor(json string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(json))
+}
+
+func TestParsePageRequestCursor(t *testing.T) {
+	const id = "6f1c2a3e-8d4b-4f5a-9c7e-0b1d2e3f4a5b"
+
+	tests := []struct {
+		name    string
+		offset  bool
+		sort    string
+		cursor  string
+		wantErr bool
+	}{
+		{"time value", false, "updated", encodeCursor(`{"s":"updated","d":true,"v":"2026-01-02T03:04:05.123456Z","id":"` + id + `"}`), false},
+		{"title value", false, "title", encodeCursor(`{"s":"title","d":true,"v":"any title","id":"` + id + `"}`), false},
+		{"grouped value", false, "updated", encodeCursor(`{"s":"updated","d":true,"v":"pinned","id":"` + id + `","g":1}`), false},
+		{"offset", true, "rank", encodeCursor(`{"s":"rank","d":true,"v":"40"}`), false},
+		{"not base64", false, "updated", "%%%", true},
+		{"not json", false, "updated", encodeCursor(`not json`), true},
+		{"other sort", false, "updated", encodeCursor(`{"s":"created","d":true,"v":"2026-01-02T03:04:05Z","id":"` + id + `"}`), true},
+		{"other order", false, "updated", encodeCursor(`{"s":"updated","d":false,"v":"2026-01-02T03:04:05Z","id":"` + id + `"}`), true},
+		{"malformed time", false, "updated", encodeCursor(`{"s":"updated","d":true,"v":"yesterday","id":"` + id + `"}`), true},
+		{"malformed id", false, "updated", encodeCursor(`{"s":"updated","d":true,"v":"2026-01-02T03:04:05Z","id":"42"}`), true},
+		{"offset cursor on a keyset list", false, "updated", encodeCursor(`{"s":"updated","d":true,"v":"40"}`), true},
+		{"negative offset", true, "rank", encodeCursor(`{"s":"rank","d":true,"v":"-5"}`), true},
+		{"non-numeric offset", true, "rank", encodeCursor(`{"s":"rank","d":true,"v":"abc"}`), true},
+		{"keyset cursor on an offset list", true, "rank", encodeCursor(`{"s":"rank","d":true,"v":"40","id":"` + id + `"}`), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"cursor": {tt.cursor}}
+			var err error
+			if tt.offset {
+				_, err = ParseOffsetPageRequest(q, tt.sort)
+			} else {
+				_, err = ParsePageRequest(q, tt.sort, "title")
+			}
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil && !IsValidationError(err) {
+				t.Errorf("error = %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestNextCursorRoundTrip(t *testing.T) {
+	const id = "6f1c2a3e-8d4b-4f5a-9c7e-0b1d2e3f4a5b"
+
+	first, err := ParsePageRequest(url.Values{"order": {"asc"}}, "created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := "2026-01-02T03:04:05.123456Z"
+	next, err := ParsePageRequest(url.Values{"order": {"asc"}, "cursor": {first.NextCursor(value, id)}}, "created")
+	if err != nil {
+		t.Fatalf("ParsePageRequest() of NextCursor error = %v", err)
+	}
+	if c := next.Cursor; c.Sort != "created" || c.Desc || c.Value != value || c.ID != id {
+		t.Errorf("cursor = %+v, want created ascending after %s %s", c, value, id)
+	}
+
+	first, err = ParseOffsetPageRequest(url.Values{}, "rank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Offset() != 0 {
+		t.Errorf("Offset() of the first page = %d, want 0", first.Offset())
+	}
+	next, err = ParseOffsetPageRequest(url.Values{"cursor": {first.NextOffsetCursor(40)}}, "rank")
+	if err != nil {
+		t.Fatalf("ParseOffsetPageRequest() of NextOffsetCursor error = %v", err)
+	}
+	if next.Offset() != 40 {
+		t.Errorf("Offset() = %d, want 40", next.Offset())
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Where accumulates SQL conditions joined by AND together with their positional arguments.
+// Conditions use ? placeholders which are numbered ($1, $2, ...) as they are added.
+type Where struct {
+	conds []string
+	Args  []interface{}
+}
+
+// NewWhere starts a condition list with an initial condition
+func NewWhere(cond string, args ...interface{}) *Where {
+	w := &Where{}
+	w.Add(cond, args...)
+	return w
+}
+
+// Add appends a condition, replacing each ? with the next positional parameter
+func (w *Where) Add(cond string, args ...interface{}) {
+	var b strings.Builder
+	for _, r := range cond {
+		if r == '?' {
+			w.Args = append(w.Args, args[0])
+			args = args[1:]
+			b.WriteString("$" + strconv.Itoa(len(w.Args)))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	w.conds = append(w.conds, b.String())
+}
+
+// Arg appends a positional argument that is not tied to a condition and returns its placeholder
+func (w *Where) Arg(arg interface{}) string {
+	w.Args = append(w.Args, arg)
+	return "$" + strconv.Itoa(len(w.Args))
+}
+
+// SQL returns the conditions joined by AND, without the WHERE keyword
+func (w *Where) SQL() string {
+	return strings.Join(w.conds, " AND ")
+}
+
+// Clone copies the condition list so it can be extended independently
+func (w *Where) Clone() *Where {
+	return &Where{
+		conds: append([]string(nil), w.conds...),
+		Args:  append([]interface{}(nil), w.Args...),
+	}
+}
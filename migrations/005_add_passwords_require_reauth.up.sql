@@ -0,0 +1,4 @@
+ALTER TABLE passwords
+ADD COLUMN IF NOT EXISTS require_reauth BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN passwords.require_reauth IS 'Ciphertext is only returned to recently reauthenticated sessions';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS notifications CASCADE;
+DROP TABLE IF EXISTS user_devices CASCADE;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS must_change_password,
+DROP COLUMN IF EXISTS sessions_revoked_at;
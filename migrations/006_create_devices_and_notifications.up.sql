@@ -0,0 +1,61 @@
+-- Session state used to revoke tokens and force a password change
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN users.sessions_revoked_at IS 'Tokens issued before this time are rejected';
+COMMENT ON COLUMN users.must_change_password IS 'User must change their password before using the API again';
+
+CREATE TABLE IF NOT EXISTS user_devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    fingerprint TEXT NOT NULL,
+    user_agent_family TEXT NOT NULL,
+    ip_prefix TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraint with cascade delete
+    CONSTRAINT fk_user_devices_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+
+    -- A device is remembered once per user
+    CONSTRAINT user_devices_user_fingerprint_unique UNIQUE (user_id, fingerprint)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraint with cascade delete
+    CONSTRAINT fk_notifications_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+
+    -- Data validation constraints
+    CONSTRAINT notifications_kind_not_empty CHECK (kind != ''),
+    CONSTRAINT notifications_title_not_empty CHECK (title != '')
+);
+
+-- Index for user's notification list, newest first
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created
+ON notifications(user_id, created_at DESC);
+
+-- Comments for documentation
+COMMENT ON TABLE user_devices IS 'Devices each user has signed in from';
+COMMENT ON COLUMN user_devices.fingerprint IS 'SHA-256 of user agent family and IP prefix';
+COMMENT ON COLUMN user_devices.user_agent_family IS 'Browser/client and OS family, e.g. "Firefox on Linux"';
+COMMENT ON COLUMN user_devices.ip_prefix IS 'Network prefix of the sign-in IP (/24 for IPv4, /48 for IPv6)';
+COMMENT ON TABLE notifications IS 'In-app notifications shown to users';
+COMMENT ON COLUMN notifications.kind IS 'Notification type, e.g. "new_sign_in"';
+COMMENT ON COLUMN notifications.data IS 'Kind-specific payload';
+COMMENT ON COLUMN notifications.read_at IS 'When the user marked the notification as read';
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS client_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    match_type TEXT NOT NULL,
+    match_value TEXT NOT NULL,
+    user_id UUID,
+    service_name TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraint with cascade delete
+    CONSTRAINT fk_client_identities_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+
+    -- Data validation constraints
+    CONSTRAINT client_identities_match_type_valid CHECK (match_type IN ('subject', 'san_uri')),
+    CONSTRAINT client_identities_match_value_not_empty CHECK (match_value != ''),
+    CONSTRAINT client_identities_principal_present CHECK (user_id IS NOT NULL OR service_name IS NOT NULL),
+    CONSTRAINT client_identities_match_unique UNIQUE (match_type, match_value)
+);
+
+-- Comments for documentation
+COMMENT ON TABLE client_identities IS 'Maps verified TLS client certificates to users or service principals';
+COMMENT ON COLUMN client_identities.match_type IS '"subject" matches the RFC 2253 subject DN, "san_uri" a URI SAN';
+COMMENT ON COLUMN client_identities.match_value IS 'Exact subject DN (e.g. CN=backup-01,O=Shub) or URI (e.g. spiffe://shub/backup)';
+COMMENT ON COLUMN client_identities.user_id IS 'User the certificate acts as (NULL for pure service principals)';
+COMMENT ON COLUMN client_identities.service_name IS 'Service principal name, e.g. "backup-daemon"';
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_passwords_user_name_id;
+DROP INDEX IF EXISTS idx_passwords_user_updated_id;
+DROP INDEX IF EXISTS idx_passwords_user_created_id;
+DROP INDEX IF EXISTS idx_notes_user_title_id;
+DROP INDEX IF EXISTS idx_notes_user_updated_id;
+DROP INDEX IF EXISTS idx_notes_user_created_id;
+
+CREATE INDEX IF NOT EXISTS idx_notes_user_created
+ON notes(user_id, created_at DESC);
@@ -0,0 +1,23 @@
+-- Keyset pagination orders by (sort column, id) within a user's rows.
+-- Btree indexes can be scanned in both directions, so one index serves asc and desc.
+
+-- Superseded by idx_notes_user_created_id
+DROP INDEX IF EXISTS idx_notes_user_created;
+
+CREATE INDEX IF NOT EXISTS idx_notes_user_created_id
+ON notes(user_id, created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_notes_user_updated_id
+ON notes(user_id, updated_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_notes_user_title_id
+ON notes(user_id, title, id);
+
+CREATE INDEX IF NOT EXISTS idx_passwords_user_created_id
+ON passwords(user_id, created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_passwords_user_updated_id
+ON passwords(user_id, updated_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_passwords_user_name_id
+ON passwords(user_id, name, id);
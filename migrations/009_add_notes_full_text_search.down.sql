@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_notes_content_trgm;
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+DROP COLUMN IF EXISTS search_vector,
+DROP COLUMN IF EXISTS search_language;
@@ -0,0 +1,25 @@
+-- Text search configuration each note is indexed with
+ALTER TABLE notes
+ADD COLUMN IF NOT EXISTS search_language REGCONFIG NOT NULL DEFAULT 'english';
+
+-- Weighted search document: title matches rank above content matches
+ALTER TABLE notes
+ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+GENERATED ALWAYS AS (
+    setweight(to_tsvector(search_language, title), 'A') ||
+    setweight(to_tsvector(search_language, content), 'B')
+) STORED;
+
+-- Full-text index for search queries
+CREATE INDEX IF NOT EXISTS idx_notes_search_vector
+ON notes
+USING gin (search_vector);
+
+-- Trigram index on content for the typo-tolerant fallback
+CREATE INDEX IF NOT EXISTS idx_notes_content_trgm
+ON notes
+USING gin (content gin_trgm_ops);
+
+-- Comments for documentation
+COMMENT ON COLUMN notes.search_language IS 'Text search configuration used to index the note';
+COMMENT ON COLUMN notes.search_vector IS 'Generated full-text document (title weight A, content weight B)';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS note_tags CASCADE;
+DROP TABLE IF EXISTS tags CASCADE;
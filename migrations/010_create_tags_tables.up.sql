@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    color TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraint with cascade delete
+    CONSTRAINT fk_tags_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+
+    -- Data validation constraints
+    CONSTRAINT tag_name_not_empty CHECK (name != ''),
+    CONSTRAINT tag_name_max_length CHECK (LENGTH(name) <= 64),
+    CONSTRAINT tag_color_format CHECK (color IS NULL OR color ~ '^#[0-9a-fA-F]{6}$')
+);
+
+-- Tag names are unique per user, ignoring case
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name
+ON tags(user_id, LOWER(name));
+
+CREATE TABLE IF NOT EXISTS note_tags (
+    note_id UUID NOT NULL,
+    tag_id UUID NOT NULL,
+
+    PRIMARY KEY (note_id, tag_id),
+
+    -- Foreign key constraints with cascade delete
+    CONSTRAINT fk_note_tags_note_id
+        FOREIGN KEY (note_id)
+        REFERENCES notes(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_note_tags_tag_id
+        FOREIGN KEY (tag_id)
+        REFERENCES tags(id)
+        ON DELETE CASCADE
+);
+
+-- Index for filtering notes by tag
+CREATE INDEX IF NOT EXISTS idx_note_tags_tag_id
+ON note_tags(tag_id);
+
+-- Comments for documentation
+COMMENT ON TABLE tags IS 'User-defined labels for notes';
+COMMENT ON COLUMN tags.name IS 'Tag name (max 64 characters, unique per user ignoring case)';
+COMMENT ON COLUMN tags.color IS 'Optional display color as #rrggbb';
+COMMENT ON TABLE note_tags IS 'Many-to-many link between notes and tags';
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS notebooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    parent_id UUID,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraints with cascade delete
+    CONSTRAINT fk_notebooks_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_notebooks_parent_id
+        FOREIGN KEY (parent_id)
+        REFERENCES notebooks(id)
+        ON DELETE CASCADE,
+
+    -- Data validation constraints
+    CONSTRAINT notebook_name_not_empty CHECK (name != ''),
+    CONSTRAINT notebook_name_max_length CHECK (LENGTH(name) <= 255),
+    CONSTRAINT notebook_not_own_parent CHECK (parent_id IS NULL OR parent_id != id),
+    CONSTRAINT notebook_position_not_negative CHECK (position >= 0)
+);
+
+-- Index for listing the children of a notebook in order
+CREATE INDEX IF NOT EXISTS idx_notebooks_user_parent_position
+ON notebooks(user_id, parent_id, position);
+
+-- A note belongs to at most one notebook
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS notebook_id UUID
+    CONSTRAINT fk_notes_notebook_id
+        REFERENCES notebooks(id)
+        ON DELETE SET NULL;
+
+-- Index for filtering notes by notebook
+CREATE INDEX IF NOT EXISTS idx_notes_notebook_id
+ON notes(notebook_id);
+
+-- Comments for documentation
+COMMENT ON TABLE notebooks IS 'Nested folders grouping notes';
+COMMENT ON COLUMN notebooks.parent_id IS 'Parent notebook, NULL for top-level notebooks';
+COMMENT ON COLUMN notebooks.position IS 'Order among the notebooks sharing the same parent';
+COMMENT ON COLUMN notes.notebook_id IS 'Notebook containing the note, NULL when not filed';
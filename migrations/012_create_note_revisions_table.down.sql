@@ -0,0 +1,2 @@
+ALTER TABLE notes DROP COLUMN IF EXISTS revision;
+DROP TABLE IF EXISTS note_revisions CASCADE;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS note_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    note_id UUID NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraint with cascade delete
+    CONSTRAINT fk_note_revisions_note_id
+        FOREIGN KEY (note_id)
+        REFERENCES notes(id)
+        ON DELETE CASCADE,
+
+    -- Revision numbers increase per note and are never reused
+    CONSTRAINT note_revisions_note_revision_unique UNIQUE (note_id, revision)
+);
+
+-- Revision number of the current content of each note
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+
+-- Index for pruning old revisions
+CREATE INDEX IF NOT EXISTS idx_note_revisions_created_at
+ON note_revisions(created_at);
+
+-- Comments for documentation
+COMMENT ON TABLE note_revisions IS 'Snapshots of previous versions of notes';
+COMMENT ON COLUMN note_revisions.revision IS 'Revision number, increasing per note';
+COMMENT ON COLUMN notes.revision IS 'Revision number of the current title and content';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_passwords_trash;
+DROP INDEX IF EXISTS idx_notes_trash;
+ALTER TABLE passwords DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,16 @@
+-- Deleted notes and vault items stay in the trash until restored or purged
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Indexes for listing and purging the trash
+CREATE INDEX IF NOT EXISTS idx_notes_trash
+ON notes(user_id, deleted_at)
+WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_passwords_trash
+ON passwords(user_id, deleted_at)
+WHERE deleted_at IS NOT NULL;
+
+-- Comments for documentation
+COMMENT ON COLUMN notes.deleted_at IS 'When the note was moved to the trash, NULL if not deleted';
+COMMENT ON COLUMN passwords.deleted_at IS 'When the entry was moved to the trash, NULL if not deleted';
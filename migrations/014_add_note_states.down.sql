@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_notes_user_pin_order;
+ALTER TABLE notes DROP COLUMN IF EXISTS favorite;
+ALTER TABLE notes DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS pin_order;
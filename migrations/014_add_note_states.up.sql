@@ -0,0 +1,15 @@
+-- Pinned notes are listed first, in the order they were pinned
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS pin_order INTEGER;
+-- Archived notes are hidden from default lists but still searchable
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS favorite BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Pin positions are unique per user, which keeps the pinned order stable
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notes_user_pin_order
+ON notes(user_id, pin_order)
+WHERE pin_order IS NOT NULL;
+
+-- Comments for documentation
+COMMENT ON COLUMN notes.pin_order IS 'Position among the pinned notes of the user, NULL when not pinned';
+COMMENT ON COLUMN notes.archived_at IS 'When the note was archived, NULL when not archived';
+COMMENT ON COLUMN notes.favorite IS 'Whether the user marked the note as a favorite';
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_attachments_track_storage ON attachments;
+DROP FUNCTION IF EXISTS attachments_track_storage();
+DROP TABLE IF EXISTS blob_deletions CASCADE;
+DROP TABLE IF EXISTS user_storage CASCADE;
+DROP TABLE IF EXISTS attachments CASCADE;
@@ -0,0 +1,103 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    note_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    blob_key TEXT NOT NULL,
+    thumbnail_key TEXT,
+    thumbnail_size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    -- Foreign key constraints with cascade delete
+    CONSTRAINT fk_attachments_note_id
+        FOREIGN KEY (note_id)
+        REFERENCES notes(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_attachments_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+
+    -- Data validation constraints
+    CONSTRAINT attachment_filename_not_empty CHECK (filename != ''),
+    CONSTRAINT attachment_filename_max_length CHECK (LENGTH(filename) <= 255),
+    CONSTRAINT attachment_size_not_negative CHECK (size >= 0 AND thumbnail_size >= 0)
+);
+
+-- Index for listing the attachments of a note
+CREATE INDEX IF NOT EXISTS idx_attachments_note_id
+ON attachments(note_id, created_at);
+
+-- Attachment storage used by each user, maintained by trigger
+CREATE TABLE IF NOT EXISTS user_storage (
+    user_id UUID PRIMARY KEY,
+    bytes_used BIGINT NOT NULL DEFAULT 0,
+    attachment_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_user_storage_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+-- Blobs whose attachment row is gone, removed from the blob store by a background job
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    blob_key TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Keeps user_storage and blob_deletions in sync with attachments, including rows
+-- removed by cascades when notes are purged from the trash or users are deleted
+CREATE OR REPLACE FUNCTION attachments_track_storage() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO user_storage(user_id, bytes_used, attachment_count)
+        VALUES (NEW.user_id, NEW.size + NEW.thumbnail_size, 1)
+        ON CONFLICT (user_id) DO UPDATE
+        SET bytes_used = user_storage.bytes_used + EXCLUDED.bytes_used,
+            attachment_count = user_storage.attachment_count + 1,
+            updated_at = NOW();
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'UPDATE' THEN
+        UPDATE user_storage
+        SET bytes_used = bytes_used + (NEW.size + NEW.thumbnail_size) - (OLD.size + OLD.thumbnail_size),
+            updated_at = NOW()
+        WHERE user_id = NEW.user_id;
+
+        IF OLD.thumbnail_key IS NOT NULL AND OLD.thumbnail_key IS DISTINCT FROM NEW.thumbnail_key THEN
+            INSERT INTO blob_deletions(blob_key) VALUES (OLD.thumbnail_key) ON CONFLICT DO NOTHING;
+        END IF;
+        RETURN NEW;
+    END IF;
+
+    UPDATE user_storage
+    SET bytes_used = bytes_used - (OLD.size + OLD.thumbnail_size),
+        attachment_count = attachment_count - 1,
+        updated_at = NOW()
+    WHERE user_id = OLD.user_id;
+
+    INSERT INTO blob_deletions(blob_key) VALUES (OLD.blob_key) ON CONFLICT DO NOTHING;
+    IF OLD.thumbnail_key IS NOT NULL THEN
+        INSERT INTO blob_deletions(blob_key) VALUES (OLD.thumbnail_key) ON CONFLICT DO NOTHING;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_attachments_track_storage ON attachments;
+CREATE TRIGGER trg_attachments_track_storage
+AFTER INSERT OR DELETE OR UPDATE OF size, thumbnail_size, thumbnail_key ON attachments
+FOR EACH ROW EXECUTE FUNCTION attachments_track_storage();
+
+-- Comments for documentation
+COMMENT ON TABLE attachments IS 'Files attached to notes, the bytes live in the blob store';
+COMMENT ON COLUMN attachments.blob_key IS 'Key of the file in the blob store';
+COMMENT ON COLUMN attachments.thumbnail_key IS 'Key of the generated thumbnail of an image, NULL if none';
+COMMENT ON TABLE user_storage IS 'Attachment storage used per user, including thumbnails';
+COMMENT ON TABLE blob_deletions IS 'Blob store keys waiting to be deleted';
@@ -0,0 +1,20 @@
+-- Notes shared with other users, the owner of a note stays in notes.user_id
+CREATE TABLE IF NOT EXISTS note_shares (
+    note_id UUID NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (note_id, user_id),
+    CONSTRAINT note_share_permission_valid CHECK (permission IN ('viewer', 'editor'))
+);
+
+-- Index for listing the notes shared with a user
+CREATE INDEX IF NOT EXISTS idx_note_shares_user_id ON note_shares(user_id, created_at DESC);
+
+-- Index for looking up recipients by email without regard to case
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(LOWER(email));
+
+-- Comments for documentation
+COMMENT ON TABLE note_shares IS 'Users a note is shared with, besides its owner';
+COMMENT ON COLUMN note_shares.permission IS 'viewer can read the note, editor can also change its title and content';
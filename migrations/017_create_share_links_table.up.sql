@@ -0,0 +1,23 @@
+-- Public read-only links to a note, for people without an account
+CREATE TABLE IF NOT EXISTS share_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    note_id UUID NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    password_hash TEXT,
+    expires_at TIMESTAMPTZ,
+    max_views INTEGER,
+    view_count INTEGER NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT share_link_max_views_positive CHECK (max_views IS NULL OR max_views > 0)
+);
+
+-- Index for listing the links of a note
+CREATE INDEX IF NOT EXISTS idx_share_links_note_id ON share_links(note_id, created_at DESC);
+
+-- Comments for documentation
+COMMENT ON TABLE share_links IS 'Unauthenticated read-only links to notes, served at /s/{token}';
+COMMENT ON COLUMN share_links.token_hash IS 'SHA-256 of the link token, the token itself is only shown once';
+COMMENT ON COLUMN share_links.password_hash IS 'bcrypt hash of the optional link password';
@@ -0,0 +1,21 @@
+-- Encrypted notes can't be turned back into plaintext on the server, refuse instead of losing them
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM notes WHERE encrypted) THEN
+        RAISE EXCEPTION 'cannot roll back: encrypted notes exist, export and delete them first';
+    END IF;
+END
+$$;
+
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS note_encryption_valid;
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS title_not_empty;
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS content_not_empty;
+ALTER TABLE notes ADD CONSTRAINT title_not_empty CHECK (title != '');
+ALTER TABLE notes ADD CONSTRAINT content_not_empty CHECK (content != '');
+
+ALTER TABLE notes DROP COLUMN IF EXISTS title_nonce;
+ALTER TABLE notes DROP COLUMN IF EXISTS title_ciphertext;
+ALTER TABLE notes DROP COLUMN IF EXISTS encrypt_version;
+ALTER TABLE notes DROP COLUMN IF EXISTS nonce;
+ALTER TABLE notes DROP COLUMN IF EXISTS ciphertext;
+ALTER TABLE notes DROP COLUMN IF EXISTS encrypted;
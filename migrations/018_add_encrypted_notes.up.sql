@@ -0,0 +1,35 @@
+-- End-to-end encrypted notes use the same envelope as the vault: the client sends
+-- an AES-256-GCM ciphertext with its nonce and the server never decrypts it
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS ciphertext BYTEA;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS nonce BYTEA;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS encrypt_version INT;
+-- The title is encrypted separately, when the user chooses to
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS title_ciphertext BYTEA;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS title_nonce BYTEA;
+
+-- Encrypted notes keep no plaintext, so their content (and encrypted title) is empty
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS content_not_empty;
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS title_not_empty;
+ALTER TABLE notes ADD CONSTRAINT content_not_empty CHECK (encrypted OR content != '');
+ALTER TABLE notes ADD CONSTRAINT title_not_empty CHECK (title_ciphertext IS NOT NULL OR title != '');
+
+ALTER TABLE notes ADD CONSTRAINT note_encryption_valid CHECK (
+    (NOT encrypted AND ciphertext IS NULL AND nonce IS NULL AND encrypt_version IS NULL AND title_ciphertext IS NULL AND title_nonce IS NULL)
+    OR (
+        encrypted AND content = ''
+        AND OCTET_LENGTH(ciphertext) BETWEEN 1 AND 1048576 -- 1 MB
+        AND OCTET_LENGTH(nonce) = 12 -- GCM standard: 96 bits
+        AND encrypt_version IS NOT NULL
+        AND (title_ciphertext IS NULL) = (title_nonce IS NULL)
+        AND (title_ciphertext IS NULL OR (title = '' AND OCTET_LENGTH(title_ciphertext) BETWEEN 1 AND 1048576 AND OCTET_LENGTH(title_nonce) = 12))
+    )
+);
+
+-- Comments for documentation
+COMMENT ON COLUMN notes.encrypted IS 'Whether the note is end-to-end encrypted, content is then empty';
+COMMENT ON COLUMN notes.ciphertext IS 'AES-256-GCM encrypted content of an encrypted note (max 1 MB)';
+COMMENT ON COLUMN notes.nonce IS 'Encryption nonce of the content - exactly 12 bytes for GCM mode';
+COMMENT ON COLUMN notes.encrypt_version IS 'Encryption algorithm version (for future migrations)';
+COMMENT ON COLUMN notes.title_ciphertext IS 'Encrypted title, NULL when the title is stored in plaintext';
+COMMENT ON COLUMN notes.title_nonce IS 'Encryption nonce of the title';
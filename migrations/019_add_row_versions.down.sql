@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_passwords_bump_version ON passwords;
+DROP TRIGGER IF EXISTS trg_notes_bump_version ON notes;
+DROP FUNCTION IF EXISTS bump_row_version();
+ALTER TABLE passwords DROP COLUMN IF EXISTS version;
+ALTER TABLE notes DROP COLUMN IF EXISTS version;
@@ -0,0 +1,25 @@
+-- Versions for optimistic concurrency, exposed to clients as ETags.
+-- They increase with every update of the row, whichever code path writes it.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_row_version() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_notes_bump_version ON notes;
+CREATE TRIGGER trg_notes_bump_version
+BEFORE UPDATE ON notes
+FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS trg_passwords_bump_version ON passwords;
+CREATE TRIGGER trg_passwords_bump_version
+BEFORE UPDATE ON passwords
+FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+
+-- Comments for documentation
+COMMENT ON COLUMN notes.version IS 'Increases with every update, sent as the ETag of the note';
+COMMENT ON COLUMN passwords.version IS 'Increases with every update, sent as the ETag of the entry';
@@ -0,0 +1,35 @@
+-- Imports from other note apps, run in the background by any server instance
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    data BYTEA,
+    total INTEGER NOT NULL DEFAULT 0,
+    processed INTEGER NOT NULL DEFAULT 0,
+    report JSONB,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    claim_token UUID,
+    heartbeat_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+
+    CONSTRAINT import_job_source_valid CHECK (source IN ('enex', 'keep')),
+    CONSTRAINT import_job_status_valid CHECK (status IN ('queued', 'running', 'completed', 'failed'))
+);
+
+-- Index for listing the imports of a user
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs(user_id, created_at DESC);
+
+-- Index for workers looking for jobs to run
+CREATE INDEX IF NOT EXISTS idx_import_jobs_pending ON import_jobs(created_at)
+WHERE status IN ('queued', 'running');
+
+-- Comments for documentation
+COMMENT ON TABLE import_jobs IS 'Background imports of Evernote and Google Keep exports';
+COMMENT ON COLUMN import_jobs.data IS 'Uploaded export, cleared when the job finishes';
+COMMENT ON COLUMN import_jobs.processed IS 'Items of the export handled so far, a resumed job continues after them';
+COMMENT ON COLUMN import_jobs.claim_token IS 'Identifies the worker running the job, progress of any other worker is refused';
+COMMENT ON COLUMN import_jobs.heartbeat_at IS 'Last progress of a running job, a stale job is taken over by another worker';
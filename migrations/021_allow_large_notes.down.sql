@@ -0,0 +1,21 @@
+DROP INDEX IF EXISTS idx_notes_search_vector;
+ALTER TABLE notes DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE notes
+ADD COLUMN search_vector TSVECTOR
+GENERATED ALWAYS AS (
+    setweight(to_tsvector(search_language, title), 'A') ||
+    setweight(to_tsvector(search_language, content), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_notes_search_vector
+ON notes
+USING gin (search_vector);
+
+ALTER TABLE note_revisions ALTER COLUMN content SET COMPRESSION default;
+ALTER TABLE notes ALTER COLUMN content SET COMPRESSION default;
+
+-- Notes over the old limit stay, only new and changed content is checked again
+ALTER TABLE notes ADD CONSTRAINT content_max_length CHECK (LENGTH(content) <= 5000) NOT VALID;
+
+COMMENT ON COLUMN notes.content IS 'Note content (max 5000 characters)';
+COMMENT ON COLUMN notes.search_vector IS 'Generated full-text document (title weight A, content weight B)';
@@ -0,0 +1,26 @@
+-- Notes are no longer limited to 5000 characters, the server enforces a configurable limit
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS content_max_length;
+
+-- Large content is compressed out of line (TOAST) with lz4, faster than the default pglz.
+-- Needs PostgreSQL 14 or later built with lz4, like the official images.
+ALTER TABLE notes ALTER COLUMN content SET COMPRESSION lz4;
+ALTER TABLE note_revisions ALTER COLUMN content SET COMPRESSION lz4;
+
+-- A tsvector is limited to 1 MB, so only the first 100,000 characters of the content are indexed
+-- for full-text search. The trigram fallback still covers all of it.
+DROP INDEX IF EXISTS idx_notes_search_vector;
+ALTER TABLE notes DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE notes
+ADD COLUMN search_vector TSVECTOR
+GENERATED ALWAYS AS (
+    setweight(to_tsvector(search_language, title), 'A') ||
+    setweight(to_tsvector(search_language, LEFT(content, 100000)), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_notes_search_vector
+ON notes
+USING gin (search_vector);
+
+-- Comments for documentation
+COMMENT ON COLUMN notes.content IS 'Note content, compressed when large; its size is limited by NOTE_MAX_CONTENT_MB';
+COMMENT ON COLUMN notes.search_vector IS 'Generated full-text document (title weight A, first 100,000 characters of content weight B)';
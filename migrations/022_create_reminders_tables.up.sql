@@ -0,0 +1,64 @@
+-- Reminders on notes, one-off or recurring. Occurrences are computed in the reminder's
+-- time zone, so a daily 9:00 reminder stays at 9:00 across daylight saving changes.
+CREATE TABLE IF NOT EXISTS reminders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    note_id UUID NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message TEXT NOT NULL DEFAULT '',
+    due_at TIMESTAMPTZ NOT NULL,
+    timezone TEXT NOT NULL,
+    rrule TEXT,
+    channels TEXT[] NOT NULL,
+    webhook_url TEXT,
+    webhook_secret TEXT,
+    next_fire_at TIMESTAMPTZ,
+    last_fired_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT reminder_message_max_length CHECK (LENGTH(message) <= 500),
+    CONSTRAINT reminder_channels_valid CHECK (
+        CARDINALITY(channels) > 0 AND channels <@ ARRAY['email', 'in_app', 'webhook']
+    ),
+    CONSTRAINT reminder_webhook_valid CHECK (NOT ('webhook' = ANY(channels)) OR webhook_url IS NOT NULL)
+);
+
+-- Index for the reminders of a note and of a user
+CREATE INDEX IF NOT EXISTS idx_reminders_note_id ON reminders(note_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_user_next ON reminders(user_id, next_fire_at);
+
+-- Index for the scheduler looking for due reminders
+CREATE INDEX IF NOT EXISTS idx_reminders_next_fire_at ON reminders(next_fire_at)
+WHERE next_fire_at IS NOT NULL;
+
+-- Every fired occurrence is queued once per channel and delivered from here, so firing
+-- and delivery survive restarts. The unique key keeps an occurrence from firing twice.
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reminder_id UUID NOT NULL REFERENCES reminders(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL,
+    occurrence_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+
+    CONSTRAINT reminder_delivery_unique UNIQUE (reminder_id, occurrence_at, channel),
+    CONSTRAINT reminder_delivery_status_valid CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+-- Index for the scheduler looking for deliveries to send
+CREATE INDEX IF NOT EXISTS idx_reminder_deliveries_pending ON reminder_deliveries(next_attempt_at)
+WHERE status = 'pending';
+
+-- Comments for documentation
+COMMENT ON TABLE reminders IS 'One-off and recurring reminders users set on notes';
+COMMENT ON COLUMN reminders.due_at IS 'First occurrence, the DTSTART of a recurring reminder';
+COMMENT ON COLUMN reminders.timezone IS 'IANA time zone the occurrences are computed in, e.g. Europe/Berlin';
+COMMENT ON COLUMN reminders.rrule IS 'RFC 5545 recurrence rule without DTSTART, NULL for a one-off reminder';
+COMMENT ON COLUMN reminders.next_fire_at IS 'Next occurrence to fire, NULL once the reminder is over';
+COMMENT ON COLUMN reminders.webhook_secret IS 'Key of the HMAC-SHA256 signature sent with webhook deliveries';
+COMMENT ON TABLE reminder_deliveries IS 'Fired reminder occurrences queued for delivery, one row per channel';
+COMMENT ON COLUMN reminder_deliveries.next_attempt_at IS 'When the delivery is sent or retried, pushed back while a worker is sending it';
@@ -0,0 +1,28 @@
+-- Checklist items of notes, kept apart from the content so they can be checked, added and
+-- reordered without rewriting it. Items are ordered among their siblings; a top-level item
+-- can have children, which can't have children of their own.
+CREATE TABLE IF NOT EXISTS checklist_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    note_id UUID NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES checklist_items(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    checked BOOLEAN NOT NULL DEFAULT FALSE,
+    checked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT checklist_item_text_length CHECK (LENGTH(text) BETWEEN 1 AND 1000)
+);
+
+-- Index for loading and counting the checklist of a note in order
+CREATE INDEX IF NOT EXISTS idx_checklist_items_note_id ON checklist_items(note_id, parent_id, position);
+
+-- Index for the cascade from a parent item to its children
+CREATE INDEX IF NOT EXISTS idx_checklist_items_parent_id ON checklist_items(parent_id)
+WHERE parent_id IS NOT NULL;
+
+-- Comments for documentation
+COMMENT ON TABLE checklist_items IS 'Ordered, checkable items of the checklist of a note, nested one level';
+COMMENT ON COLUMN checklist_items.parent_id IS 'Top-level item this item is nested under, NULL for top-level items';
+COMMENT ON COLUMN checklist_items.position IS 'Position among the items with the same parent, from 0';
@@ -0,0 +1,31 @@
+-- Wiki links between notes, [[Note Title]] or [[note-id]] in the content of the source note.
+-- Links are resolved among the notes of the owner of the source note when it is saved;
+-- a link no note matches, or whose note was deleted, is broken and keeps a NULL target.
+CREATE TABLE IF NOT EXISTS note_links (
+    source_id UUID NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    target_text TEXT NOT NULL,
+    target_id UUID REFERENCES notes(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (source_id, kind, target_text),
+    CONSTRAINT note_link_kind CHECK (kind IN ('id', 'title'))
+);
+
+-- Index for the backlinks of a note and the links to rewrite when it is renamed
+CREATE INDEX IF NOT EXISTS idx_note_links_target_id ON note_links(target_id)
+WHERE target_id IS NOT NULL;
+
+-- Index for resolving the broken links of a user when a note gets their title
+CREATE INDEX IF NOT EXISTS idx_note_links_broken ON note_links(LOWER(target_text))
+WHERE target_id IS NULL;
+
+-- Index for resolving title links, titles match case-insensitively
+CREATE INDEX IF NOT EXISTS idx_notes_user_id_lower_title ON notes(user_id, LOWER(title))
+WHERE deleted_at IS NULL;
+
+-- Comments for documentation
+COMMENT ON TABLE note_links IS 'Wiki links from the content of a note to other notes of its owner';
+COMMENT ON COLUMN note_links.kind IS 'id for [[note-id]] links, title for [[Note Title]] links';
+COMMENT ON COLUMN note_links.target_text IS 'Note ID or title as written in the link, titles match case-insensitively';
+COMMENT ON COLUMN note_links.target_id IS 'Note the link resolves to, NULL for broken links';
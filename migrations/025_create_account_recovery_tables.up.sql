@@ -0,0 +1,24 @@
+-- "This wasn't me" links of new sign-in alerts that were opened, each link locks the account only once
+CREATE TABLE IF NOT EXISTS used_report_links (
+    id TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Single-use tokens handed out by an opened report link, needed to set a new password on the locked account
+CREATE TABLE IF NOT EXISTS password_resets (
+    token_hash BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Index for replacing the reset token of a user
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);
+
+-- Comments for documentation
+COMMENT ON TABLE used_report_links IS 'Opened report links, kept until the link expires';
+COMMENT ON COLUMN used_report_links.id IS 'Reported device, the jti of the link token';
+COMMENT ON TABLE password_resets IS 'Unused password reset tokens of locked accounts';
+COMMENT ON COLUMN password_resets.token_hash IS 'SHA-256 of the token, the token itself is only sent to the user';
@@ -0,0 +1,12 @@
+-- Notes written before wiki links were stored have no note_links yet. They are queued here
+-- and a background job saves their links, removing each note from the queue once done.
+CREATE TABLE IF NOT EXISTS note_links_backfill (
+    note_id UUID PRIMARY KEY REFERENCES notes(id) ON DELETE CASCADE
+);
+
+INSERT INTO note_links_backfill(note_id)
+SELECT id FROM notes WHERE NOT encrypted
+ON CONFLICT DO NOTHING;
+
+-- Comments for documentation
+COMMENT ON TABLE note_links_backfill IS 'Notes whose wiki links still have to be saved to note_links';